@@ -0,0 +1,302 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//defaultAdminTimeout is used for admin requests with a context without deadline
+const defaultAdminTimeout = 30 * time.Second
+
+//TopicAdmin administrates topics and configs with a single admin client
+type TopicAdmin struct {
+	AdminClient *kafka.AdminClient
+	Timeout     time.Duration
+}
+
+//TopicSpec describes a topic to create
+type TopicSpec struct {
+	Topic             string            `json:"topic"`
+	Partitions        int               `json:"partitions"`
+	ReplicationFactor int               `json:"replicationFactor"`
+	Config            map[string]string `json:"config,omitempty"`
+}
+
+//TopicResult holds the outcome of an operation for a single topic
+type TopicResult struct {
+	Topic string
+	Error error
+}
+
+//ConfigValue holds a single config entry of a topic or broker
+type ConfigValue struct {
+	Value     string
+	Source    string
+	Default   bool
+	ReadOnly  bool
+	Sensitive bool
+}
+
+//ConfigResult holds the config of a topic or broker
+type ConfigResult struct {
+	Type   string
+	Name   string
+	Config map[string]ConfigValue
+	Error  error
+}
+
+func newTopicAdmin() (*TopicAdmin, error) {
+	adminClient, err := kafka.NewAdminClient(
+		&kafka.ConfigMap{
+			"bootstrap.servers": bootstrapServers,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create admin client error [%#v]", err)
+	}
+	return &TopicAdmin{
+		AdminClient: adminClient,
+		Timeout:     defaultAdminTimeout,
+	}, nil
+}
+
+//Close closes the admin client
+func (a *TopicAdmin) Close() {
+	a.AdminClient.Close()
+}
+
+//withTimeout applies the admin timeout to a context without deadline
+func (a *TopicAdmin) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, a.Timeout)
+}
+
+//operationTimeoutShare is the part of the remaining time the broker may wait for an operation
+//the rest is left for the request and the response
+const operationTimeoutShare = 0.5
+
+//operationTimeout is the time the broker waits for the operation to complete
+func operationTimeout(ctx context.Context) time.Duration {
+	remaining := defaultAdminTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining = time.Until(deadline)
+	}
+	timeout := time.Duration(float64(remaining) * operationTimeoutShare)
+	if timeout < time.Millisecond {
+		return time.Millisecond
+	}
+	return timeout
+}
+
+//CreateTopic creates a single topic
+func (a *TopicAdmin) CreateTopic(ctx context.Context, spec TopicSpec) error {
+	results, err := a.CreateTopics(ctx, spec)
+	if err != nil {
+		return err
+	}
+	return firstTopicError(results)
+}
+
+//CreateTopics creates the topics and returns the result per topic
+func (a *TopicAdmin) CreateTopics(ctx context.Context, specs ...TopicSpec) ([]TopicResult, error) {
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+
+	topics := make([]kafka.TopicSpecification, len(specs))
+	for i, spec := range specs {
+		topics[i] = kafka.TopicSpecification{
+			Topic:             spec.Topic,
+			NumPartitions:     spec.Partitions,
+			ReplicationFactor: spec.ReplicationFactor,
+			Config:            spec.Config,
+		}
+	}
+	results, err := a.AdminClient.CreateTopics(ctx, topics, kafka.SetAdminOperationTimeout(operationTimeout(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create topics error [%v]", err)
+	}
+	return newTopicResults(results), nil
+}
+
+//DeleteTopics deletes the topics and returns the result per topic
+func (a *TopicAdmin) DeleteTopics(ctx context.Context, topics ...string) ([]TopicResult, error) {
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+
+	results, err := a.AdminClient.DeleteTopics(ctx, topics, kafka.SetAdminOperationTimeout(operationTimeout(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot delete topics error [%v]", err)
+	}
+	return newTopicResults(results), nil
+}
+
+//CreatePartitions increases the partition count of the topics to the given total count
+func (a *TopicAdmin) CreatePartitions(ctx context.Context, partitionCounts map[string]int) ([]TopicResult, error) {
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+
+	var partitions []kafka.PartitionsSpecification
+	for topic, count := range partitionCounts {
+		partitions = append(partitions, kafka.PartitionsSpecification{
+			Topic:      topic,
+			IncreaseTo: count,
+		})
+	}
+	results, err := a.AdminClient.CreatePartitions(ctx, partitions, kafka.SetAdminOperationTimeout(operationTimeout(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create partitions error [%v]", err)
+	}
+	return newTopicResults(results), nil
+}
+
+//DescribeTopicConfig returns the config of the topic
+func (a *TopicAdmin) DescribeTopicConfig(ctx context.Context, topic string) (ConfigResult, error) {
+	return a.describeConfig(ctx, kafka.ResourceTopic, topic)
+}
+
+//DescribeBrokerConfig returns the config of the broker
+func (a *TopicAdmin) DescribeBrokerConfig(ctx context.Context, brokerID int32) (ConfigResult, error) {
+	return a.describeConfig(ctx, kafka.ResourceBroker, strconv.Itoa(int(brokerID)))
+}
+
+func (a *TopicAdmin) describeConfig(ctx context.Context, resourceType kafka.ResourceType, name string) (ConfigResult, error) {
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+
+	results, err := a.AdminClient.DescribeConfigs(ctx, []kafka.ConfigResource{{Type: resourceType, Name: name}})
+	if err != nil {
+		return ConfigResult{}, fmt.Errorf("cannot describe config [%s] [%s] error [%v]", resourceType, name, err)
+	}
+	if len(results) != 1 {
+		return ConfigResult{}, fmt.Errorf("describe config [%s] [%s] expected [1] result but was [%d]", resourceType, name, len(results))
+	}
+	result := newConfigResult(results[0])
+	return result, result.Error
+}
+
+//AlterTopicConfig sets the config entries of the topic, other dynamic topic configs are kept
+//sensitive dynamic topic configs must be given as their values cannot be read back
+func (a *TopicAdmin) AlterTopicConfig(ctx context.Context, topic string, config map[string]string) error {
+	return a.alterConfig(ctx, kafka.ResourceTopic, topic, config, kafka.ConfigSourceDynamicTopic)
+}
+
+//AlterBrokerConfig sets the config entries of the broker, other dynamic broker configs are kept
+//sensitive dynamic broker configs must be given as their values cannot be read back
+func (a *TopicAdmin) AlterBrokerConfig(ctx context.Context, brokerID int32, config map[string]string) error {
+	return a.alterConfig(ctx, kafka.ResourceBroker, strconv.Itoa(int(brokerID)), config, kafka.ConfigSourceDynamicBroker)
+}
+
+//alterConfig merges the changes into the current dynamic config as alter configs replaces the whole config set
+func (a *TopicAdmin) alterConfig(ctx context.Context, resourceType kafka.ResourceType, name string, config map[string]string, dynamicSource kafka.ConfigSource) error {
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+
+	current, err := a.AdminClient.DescribeConfigs(ctx, []kafka.ConfigResource{{Type: resourceType, Name: name}})
+	if err != nil {
+		return fmt.Errorf("cannot describe config [%s] [%s] error [%v]", resourceType, name, err)
+	}
+	merged, err := mergeDynamicConfig(resourceType, name, current, config, dynamicSource)
+	if err != nil {
+		return err
+	}
+
+	results, err := a.AdminClient.AlterConfigs(ctx, []kafka.ConfigResource{{
+		Type:   resourceType,
+		Name:   name,
+		Config: kafka.StringMapToConfigEntries(merged, kafka.AlterOperationSet),
+	}})
+	if err != nil {
+		return fmt.Errorf("cannot alter config [%s] [%s] error [%v]", resourceType, name, err)
+	}
+	for _, result := range results {
+		if result.Error.Code() != kafka.ErrNoError {
+			return fmt.Errorf("cannot alter config [%s] [%s] error [%v]", resourceType, name, result.Error)
+		}
+	}
+	return nil
+}
+
+//mergeDynamicConfig returns the current dynamic config with the changes applied
+//sensitive values are not returned by describe configs so they must be part of the changes otherwise the alter would drop them
+func mergeDynamicConfig(resourceType kafka.ResourceType, name string, current []kafka.ConfigResourceResult, config map[string]string, dynamicSource kafka.ConfigSource) (map[string]string, error) {
+	merged := map[string]string{}
+	var missing []string
+	for _, result := range current {
+		if result.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("cannot describe config [%s] [%s] error [%v]", resourceType, name, result.Error)
+		}
+		for entryName, entry := range result.Config {
+			if entry.Source != dynamicSource {
+				continue
+			}
+			if !entry.IsSensitive {
+				merged[entryName] = entry.Value
+			} else if _, ok := config[entryName]; !ok {
+				missing = append(missing, entryName)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("cannot alter config [%s] [%s] sensitive dynamic entries [%s] must be given as the alter replaces the whole config", resourceType, name, strings.Join(missing, ","))
+	}
+	for entryName, value := range config {
+		merged[entryName] = value
+	}
+	return merged, nil
+}
+
+func newTopicResults(results []kafka.TopicResult) []TopicResult {
+	topicResults := make([]TopicResult, len(results))
+	for i, result := range results {
+		topicResults[i].Topic = result.Topic
+		if result.Error.Code() != kafka.ErrNoError {
+			topicResults[i].Error = result.Error
+		}
+	}
+	return topicResults
+}
+
+func newConfigResult(result kafka.ConfigResourceResult) ConfigResult {
+	configResult := ConfigResult{
+		Type:   result.Type.String(),
+		Name:   result.Name,
+		Config: map[string]ConfigValue{},
+	}
+	if result.Error.Code() != kafka.ErrNoError {
+		configResult.Error = fmt.Errorf("describe config [%s] [%s] error [%v]", result.Type, result.Name, result.Error)
+	}
+	for name, entry := range result.Config {
+		configResult.Config[name] = ConfigValue{
+			Value:     entry.Value,
+			Source:    entry.Source.String(),
+			Default:   entry.Source == kafka.ConfigSourceDefault,
+			ReadOnly:  entry.IsReadOnly,
+			Sensitive: entry.IsSensitive,
+		}
+	}
+	return configResult
+}
+
+func firstTopicError(results []TopicResult) error {
+	for _, result := range results {
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+//IsTopicAlreadyExists returns true if the error reports an existing topic
+func IsTopicAlreadyExists(err error) bool {
+	kafkaErr, ok := err.(kafka.Error)
+	return ok && kafkaErr.Code() == kafka.ErrTopicAlreadyExists
+}
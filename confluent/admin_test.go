@@ -0,0 +1,63 @@
+package confluent
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+func TestMergeDynamicConfig(t *testing.T) {
+	current := []kafka.ConfigResourceResult{{
+		Type: kafka.ResourceTopic,
+		Name: "orders",
+		Config: map[string]kafka.ConfigEntryResult{
+			"retention.ms":   {Name: "retention.ms", Value: "1000", Source: kafka.ConfigSourceDynamicTopic},
+			"cleanup.policy": {Name: "cleanup.policy", Value: "compact", Source: kafka.ConfigSourceDynamicTopic},
+			"segment.ms":     {Name: "segment.ms", Value: "60000", Source: kafka.ConfigSourceDefault},
+		},
+	}}
+	merged, err := mergeDynamicConfig(kafka.ResourceTopic, "orders", current, map[string]string{"retention.ms": "2000"}, kafka.ConfigSourceDynamicTopic)
+	if err != nil {
+		t.Fatalf("cannot merge config error [%v]", err)
+	}
+	expected := map[string]string{"retention.ms": "2000", "cleanup.policy": "compact"}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("merged config expected %v but was %v", expected, merged)
+	}
+
+	current[0].Config["sasl.password"] = kafka.ConfigEntryResult{Name: "sasl.password", Source: kafka.ConfigSourceDynamicTopic, IsSensitive: true}
+	current[0].Config["ssl.key.password"] = kafka.ConfigEntryResult{Name: "ssl.key.password", Source: kafka.ConfigSourceDynamicTopic, IsSensitive: true}
+	_, err = mergeDynamicConfig(kafka.ResourceTopic, "orders", current, map[string]string{"retention.ms": "2000"}, kafka.ConfigSourceDynamicTopic)
+	if err == nil || !strings.Contains(err.Error(), "[sasl.password,ssl.key.password]") {
+		t.Errorf("missing sensitive entries expected to refuse the alter but was [%v]", err)
+	}
+
+	merged, err = mergeDynamicConfig(kafka.ResourceTopic, "orders", current, map[string]string{"sasl.password": "a", "ssl.key.password": "b"}, kafka.ConfigSourceDynamicTopic)
+	if err != nil {
+		t.Fatalf("cannot merge config with sensitive entries error [%v]", err)
+	}
+	expected = map[string]string{"retention.ms": "1000", "cleanup.policy": "compact", "sasl.password": "a", "ssl.key.password": "b"}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("merged config expected %v but was %v", expected, merged)
+	}
+}
+
+func TestOperationTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if timeout := operationTimeout(ctx); timeout < 4*time.Second || timeout > 5*time.Second {
+		t.Errorf("operation timeout expected half of the remaining time but was [%v]", timeout)
+	}
+	if timeout := operationTimeout(context.Background()); timeout != defaultAdminTimeout/2 {
+		t.Errorf("operation timeout without deadline expected half of the admin timeout but was [%v]", timeout)
+	}
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+	if timeout := operationTimeout(expired); timeout != time.Millisecond {
+		t.Errorf("operation timeout of an expired context expected [1ms] but was [%v]", timeout)
+	}
+}
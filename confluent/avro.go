@@ -0,0 +1,89 @@
+package confluent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+//AvroCodec decodes and encodes avro binary data with a schema using goavro
+//values are goavro native values: records and maps are maps, unions other than null are wrapped as {"type": value}
+//json is the avro json encoding like the confluent console clients use it
+type AvroCodec struct {
+	Schema string
+	codec  *goavro.Codec
+}
+
+//NewAvroCodec parses the avro schema
+func NewAvroCodec(schema string) (*AvroCodec, error) {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse avro schema error [%v]", err)
+	}
+	return &AvroCodec{Schema: schema, codec: codec}, nil
+}
+
+//decodeJSON decodes json keeping numbers as json.Number
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	return value, err
+}
+
+//Decode decodes the avro value from the rest of the reader
+func (c *AvroCodec) Decode(reader io.Reader) (interface{}, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read avro data error [%v]", err)
+	}
+	return c.DecodeBytes(data)
+}
+
+//DecodeBytes decodes the avro value in the buffer, bytes after the value are an error
+func (c *AvroCodec) DecodeBytes(data []byte) (interface{}, error) {
+	value, rest, err := c.codec.NativeFromBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("avro data has [%d] bytes after the value", len(rest))
+	}
+	return value, nil
+}
+
+//DecodeJSON decodes the avro binary data to the avro json encoding
+func (c *AvroCodec) DecodeJSON(data []byte) ([]byte, error) {
+	value, err := c.DecodeBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.codec.TextualFromNative(nil, value)
+}
+
+//Encode encodes the goavro native value to avro binary and writes it to the writer
+func (c *AvroCodec) Encode(value interface{}, writer io.Writer) error {
+	encoded, err := c.codec.BinaryFromNative(nil, value)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(encoded)
+	return err
+}
+
+//EncodeJSON encodes the document in the avro json encoding to avro binary
+func (c *AvroCodec) EncodeJSON(data []byte) ([]byte, error) {
+	value, rest, err := c.codec.NativeFromTextual(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, fmt.Errorf("json has [%d] bytes after the value", len(rest))
+	}
+	return c.codec.BinaryFromNative(nil, value)
+}
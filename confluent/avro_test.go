@@ -0,0 +1,140 @@
+package confluent
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//avroRoundTrip encodes the value and expects the decoded value to be equal
+func avroRoundTrip(t *testing.T, schema string, value interface{}) []byte {
+	codec, err := NewAvroCodec(schema)
+	if err != nil {
+		t.Fatalf("cannot parse schema [%s] error [%v]", schema, err)
+	}
+	var buffer bytes.Buffer
+	err = codec.Encode(value, &buffer)
+	if err != nil {
+		t.Fatalf("cannot encode [%v] with schema [%s] error [%v]", value, schema, err)
+	}
+	encoded := buffer.Bytes()
+	decoded, err := codec.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("cannot decode [%v] with schema [%s] error [%v]", value, schema, err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("schema [%s] expected [%#v] but was [%#v]", schema, value, decoded)
+	}
+	return encoded
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	cases := []struct {
+		schema string
+		value  interface{}
+	}{
+		{`"null"`, nil},
+		{`"boolean"`, true},
+		{`"int"`, int32(math.MinInt32)},
+		{`"long"`, int64(math.MaxInt64)},
+		{`"double"`, -2.25},
+		{`"bytes"`, []byte{0, 1, 255}},
+		{`"string"`, "okfw"},
+		{`{"type": "enum", "name": "color", "symbols": ["red", "green"]}`, "green"},
+		{`["null", "string"]`, nil},
+		{`["null", "string"]`, map[string]interface{}{"string": "value"}},
+		{`{"type": "array", "items": "long"}`, []interface{}{int64(1), int64(-2)}},
+		{`{"type": "map", "values": "int"}`, map[string]interface{}{"a": int32(1), "b": int32(2)}},
+		{`{"type": "record", "name": "user", "namespace": "okfw", "fields": [
+			{"name": "name", "type": "string"},
+			{"name": "age", "type": ["null", "int"]},
+			{"name": "address", "type": {"type": "record", "name": "address", "fields": [{"name": "city", "type": "string"}]}},
+			{"name": "previous", "type": ["null", "address"]}
+		]}`, map[string]interface{}{
+			"name":     "user",
+			"age":      map[string]interface{}{"int": int32(42)},
+			"address":  map[string]interface{}{"city": "Berlin"},
+			"previous": map[string]interface{}{"okfw.address": map[string]interface{}{"city": "Munich"}},
+		}},
+	}
+	for _, c := range cases {
+		avroRoundTrip(t, c.schema, c.value)
+	}
+}
+
+func TestAvroJSON(t *testing.T) {
+	codec, err := NewAvroCodec(`{"type": "record", "name": "r", "fields": [
+		{"name": "id", "type": "long"},
+		{"name": "data", "type": "bytes"},
+		{"name": "choice", "type": ["null", "string", "long"]},
+		{"name": "defaulted", "type": "int", "default": 7}
+	]}`)
+	if err != nil {
+		t.Fatalf("cannot parse schema error [%v]", err)
+	}
+	encoded, err := codec.EncodeJSON([]byte(`{"id": 5, "data": "\u0000\u0001\u00ff", "choice": {"long": 9}}`))
+	if err != nil {
+		t.Fatalf("cannot encode json error [%v]", err)
+	}
+	decoded, err := codec.DecodeBytes(encoded)
+	if err != nil {
+		t.Fatalf("cannot decode error [%v]", err)
+	}
+	expected := map[string]interface{}{"id": int64(5), "data": []byte{0, 1, 255}, "choice": map[string]interface{}{"long": int64(9)}, "defaulted": int32(7)}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("expected [%#v] but was [%#v]", expected, decoded)
+	}
+
+	//the json of the decoder is accepted by the encoder
+	text, err := codec.DecodeJSON(encoded)
+	if err != nil {
+		t.Fatalf("cannot decode to json error [%v]", err)
+	}
+	again, err := codec.EncodeJSON(text)
+	if err != nil || !bytes.Equal(again, encoded) {
+		t.Errorf("json [%s] expected to encode to the same data error [%v]", text, err)
+	}
+}
+
+func TestAvroInvalid(t *testing.T) {
+	for _, schema := range []string{`{`, `"unknown"`, `{"type": "record", "fields": []}`, `{"type": "fixed", "name": "f"}`} {
+		if _, err := NewAvroCodec(schema); err == nil {
+			t.Errorf("schema [%s] expected error", schema)
+		}
+	}
+
+	codec, _ := NewAvroCodec(`"int"`)
+	if err := codec.Encode(int64(math.MaxInt32)+1, &bytes.Buffer{}); err == nil {
+		t.Errorf("int out of range expected encode error")
+	}
+	if _, err := codec.DecodeBytes([]byte{2, 4}); err == nil || !strings.Contains(err.Error(), "after the value") {
+		t.Errorf("bytes after the value expected error but was [%v]", err)
+	}
+	if _, err := codec.DecodeBytes([]byte{0x80}); err == nil {
+		t.Errorf("truncated int expected error")
+	}
+	if _, err := codec.EncodeJSON([]byte(`1 2`)); err == nil {
+		t.Errorf("json after the value expected error")
+	}
+}
+
+func TestSetSchemaRegistryURLConcurrent(t *testing.T) {
+	defer SetSchemaRegistryURL(getSchemaRegistryURL())
+	var wait sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for j := 0; j < 100; j++ {
+				SetSchemaRegistryURL("http://registry:8081")
+				if getKafkaSchemaClient() == nil {
+					t.Errorf("registry client expected")
+				}
+			}
+		}()
+	}
+	wait.Wait()
+}
@@ -1,40 +1,146 @@
 package confluent
 
-import "github.com/confluentinc/confluent-kafka-go/kafka"
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//defaultBacklogTimeout is the time GetBacklog waits for committed offsets and watermarks
+const defaultBacklogTimeout = 5 * time.Second
+
+//PartitionBacklog holds the backlog of a single partition
+type PartitionBacklog struct {
+	Topic     string
+	Partition int32
+	Committed int64
+	Low       int64
+	High      int64
+	Lag       int64
+	Error     error
+
+	LastProcessedTimestamp time.Time
+	LatestTimestamp        time.Time
+	TimeLag                time.Duration
+}
+
+//BacklogReport holds the backlog of all assigned partitions
+type BacklogReport struct {
+	Partitions []PartitionBacklog
+	Total      int64
+	MaxTimeLag time.Duration
+}
+
+//FirstError returns the first partition query error
+func (r *BacklogReport) FirstError() error {
+	for _, partition := range r.Partitions {
+		if partition.Error != nil {
+			return partition.Error
+		}
+	}
+	return nil
+}
 
 //GetBacklog returns the messages left in the partition
 func (kc *MessageConsumer) GetBacklog() (int, error) {
-	var n int
+	ctx, cancel := context.WithTimeout(context.Background(), kc.BacklogTimeout)
+	defer cancel()
 
+	report, err := kc.GetBacklogReport(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int(report.Total), report.FirstError()
+}
+
+//GetBacklogReport returns the backlog per assigned partition, watermarks are queried concurrently until the context is done
+func (kc *MessageConsumer) GetBacklogReport(ctx context.Context) (*BacklogReport, error) {
 	// Get the current assigned partitions.
 	toppars, err := kc.Consumer.Assignment()
 	if err != nil {
-		return n, err
+		return nil, err
 	}
 
 	// Get the current offset for each partition, assigned to this consumer group.
-	toppars, err = kc.Consumer.Committed(toppars, 5000)
+	toppars, err = kc.Consumer.Committed(toppars, remainingMs(ctx))
 	if err != nil {
-		return n, err
+		return nil, err
 	}
 
-	// Loop over the topic partitions, get the high watermark for each toppar, and
-	// subtract the current offset from that number, to get the total "lag". We
-	// combine this value for each toppar to get the final backlog integer.
-	var l, h int64
-	for i := range toppars {
-		l, h, err = kc.Consumer.QueryWatermarkOffsets(*toppars[i].Topic, toppars[i].Partition, 5000)
-		if err != nil {
-			return n, err
-		}
+	return queryBacklog(ctx, kc.Consumer, toppars), nil
+}
 
-		o := int64(toppars[i].Offset)
-		if toppars[i].Offset == kafka.OffsetInvalid {
-			o = l
-		}
+//watermarkClient is implemented by the kafka consumer and producer
+type watermarkClient interface {
+	QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error)
+}
 
-		n = n + int(h-o)
+//queryBacklog queries the watermarks of the partitions concurrently and subtracts the committed offsets
+func queryBacklog(ctx context.Context, client watermarkClient, toppars []kafka.TopicPartition) *BacklogReport {
+	results := make(chan PartitionBacklog, len(toppars))
+	for _, toppar := range toppars {
+		go func(toppar kafka.TopicPartition) {
+			backlog := PartitionBacklog{
+				Topic:     *toppar.Topic,
+				Partition: toppar.Partition,
+				Committed: int64(toppar.Offset),
+			}
+			backlog.Low, backlog.High, backlog.Error = client.QueryWatermarkOffsets(*toppar.Topic, toppar.Partition, remainingMs(ctx))
+			if backlog.Error == nil {
+				o := backlog.Committed
+				if toppar.Offset == kafka.OffsetInvalid {
+					o = backlog.Low
+				}
+				backlog.Lag = backlog.High - o
+			}
+			results <- backlog
+		}(toppar)
 	}
 
-	return n, nil
+	report := &BacklogReport{}
+	pending := map[PartitionRef]kafka.TopicPartition{}
+	for _, toppar := range toppars {
+		pending[PartitionRef{Topic: *toppar.Topic, Partition: toppar.Partition}] = toppar
+	}
+	for len(pending) > 0 {
+		select {
+		case backlog := <-results:
+			delete(pending, PartitionRef{Topic: backlog.Topic, Partition: backlog.Partition})
+			report.Partitions = append(report.Partitions, backlog)
+			report.Total += backlog.Lag
+		case <-ctx.Done():
+			for _, toppar := range pending {
+				report.Partitions = append(report.Partitions, PartitionBacklog{
+					Topic:     *toppar.Topic,
+					Partition: toppar.Partition,
+					Committed: int64(toppar.Offset),
+					Error:     fmt.Errorf("watermark query [%s] error [%v]", toppar, ctx.Err()),
+				})
+			}
+			pending = nil
+		}
+	}
+	sort.Slice(report.Partitions, func(i, j int) bool {
+		if report.Partitions[i].Topic != report.Partitions[j].Topic {
+			return report.Partitions[i].Topic < report.Partitions[j].Topic
+		}
+		return report.Partitions[i].Partition < report.Partitions[j].Partition
+	})
+	return report
+}
+
+//remainingMs returns the time left until the context deadline in milliseconds
+func remainingMs(ctx context.Context) int {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return int(defaultBacklogTimeout / time.Millisecond)
+	}
+	remaining := int(time.Until(deadline) / time.Millisecond)
+	if remaining < 1 {
+		return 1
+	}
+	return remaining
 }
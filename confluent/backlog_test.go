@@ -0,0 +1,145 @@
+package confluent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//watermarks are the low and high watermark of a partition or the query error, delay holds the query
+type watermarks struct {
+	low   int64
+	high  int64
+	err   error
+	delay time.Duration
+}
+
+//fakeWatermarkClient answers the watermark queries and records the timeouts
+type fakeWatermarkClient struct {
+	mutex      sync.Mutex
+	partitions map[PartitionRef]watermarks
+	timeouts   []int
+}
+
+func (c *fakeWatermarkClient) QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (int64, int64, error) {
+	c.mutex.Lock()
+	c.timeouts = append(c.timeouts, timeoutMs)
+	w, ok := c.partitions[PartitionRef{Topic: topic, Partition: partition}]
+	c.mutex.Unlock()
+	if !ok {
+		return 0, 0, kafka.NewError(kafka.ErrUnknownPartition, "Broker: Unknown partition", false)
+	}
+	time.Sleep(w.delay)
+	return w.low, w.high, w.err
+}
+
+func testTopicPartitions(offsets map[PartitionRef]kafka.Offset) []kafka.TopicPartition {
+	var toppars []kafka.TopicPartition
+	for ref, offset := range offsets {
+		topic := ref.Topic
+		toppars = append(toppars, kafka.TopicPartition{Topic: &topic, Partition: ref.Partition, Offset: offset})
+	}
+	return toppars
+}
+
+func TestQueryBacklog(t *testing.T) {
+	client := &fakeWatermarkClient{partitions: map[PartitionRef]watermarks{
+		{"orders", 0}: {low: 0, high: 10},
+		{"orders", 1}: {low: 5, high: 20},
+		{"orders", 2}: {err: kafka.NewError(kafka.ErrLeaderNotAvailable, "Broker: Leader not available", false)},
+		{"audit", 0}:  {low: 3, high: 3},
+	}}
+	toppars := testTopicPartitions(map[PartitionRef]kafka.Offset{
+		{"orders", 0}: 4,
+		{"orders", 1}: kafka.OffsetInvalid,
+		{"orders", 2}: 7,
+		{"audit", 0}:  kafka.OffsetInvalid,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report := queryBacklog(ctx, client, toppars)
+
+	expected := []PartitionBacklog{
+		{Topic: "audit", Partition: 0, Committed: int64(kafka.OffsetInvalid), Low: 3, High: 3, Lag: 0},
+		{Topic: "orders", Partition: 0, Committed: 4, Low: 0, High: 10, Lag: 6},
+		{Topic: "orders", Partition: 1, Committed: int64(kafka.OffsetInvalid), Low: 5, High: 20, Lag: 15},
+		{Topic: "orders", Partition: 2, Committed: 7},
+	}
+	if len(report.Partitions) != len(expected) {
+		t.Fatalf("expected [%d] partitions but was %+v", len(expected), report.Partitions)
+	}
+	for i, backlog := range report.Partitions {
+		backlog.Error = nil
+		if backlog != expected[i] {
+			t.Errorf("partition [%d] expected %+v but was %+v", i, expected[i], backlog)
+		}
+	}
+	if report.Total != 21 {
+		t.Errorf("expected total [21] without the failed partition but was [%d]", report.Total)
+	}
+	if err := report.FirstError(); err == nil || !strings.Contains(err.Error(), "Leader not available") {
+		t.Errorf("expected the error of orders[2] but was [%v]", err)
+	}
+	for _, timeout := range client.timeouts {
+		if timeout <= 0 || timeout > 5000 {
+			t.Errorf("query timeout expected from the context deadline but was [%d]", timeout)
+		}
+	}
+}
+
+func TestQueryBacklogConcurrent(t *testing.T) {
+	client := &fakeWatermarkClient{partitions: map[PartitionRef]watermarks{}}
+	offsets := map[PartitionRef]kafka.Offset{}
+	for partition := int32(0); partition < 8; partition++ {
+		ref := PartitionRef{Topic: "orders", Partition: partition}
+		client.partitions[ref] = watermarks{high: 1, delay: 100 * time.Millisecond}
+		offsets[ref] = 0
+	}
+	//a partition that does not answer in time is reported with the context error
+	client.partitions[PartitionRef{"orders", 8}] = watermarks{high: 1, delay: 2 * time.Second}
+	offsets[PartitionRef{"orders", 8}] = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	report := queryBacklog(ctx, client, testTopicPartitions(offsets))
+	elapsed := time.Since(started)
+	if elapsed > time.Second {
+		t.Errorf("queries expected to run concurrently and end with the context but took [%v]", elapsed)
+	}
+	if len(report.Partitions) != 9 || report.Total != 8 {
+		t.Fatalf("expected [9] partitions with total [8] but was [%d] with [%d]", len(report.Partitions), report.Total)
+	}
+	slow := report.Partitions[8]
+	if slow.Partition != 8 || slow.Error == nil || !strings.Contains(slow.Error.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("slow partition expected deadline error but was %+v", slow)
+	}
+	for _, backlog := range report.Partitions[:8] {
+		if backlog.Error != nil || backlog.Lag != 1 {
+			t.Errorf("partition [%d] expected lag [1] but was %+v", backlog.Partition, backlog)
+		}
+	}
+}
+
+func TestRemainingMs(t *testing.T) {
+	if remaining := remainingMs(context.Background()); remaining != int(defaultBacklogTimeout/time.Millisecond) {
+		t.Errorf("context without deadline expected the default timeout but was [%d]", remaining)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if remaining := remainingMs(ctx); remaining <= 900 || remaining > 1000 {
+		t.Errorf("expected about [1000] ms but was [%d]", remaining)
+	}
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+	if remaining := remainingMs(expired); remaining != 1 {
+		t.Errorf("expired context expected [1] ms but was [%d]", remaining)
+	}
+	if report := queryBacklog(context.Background(), &fakeWatermarkClient{}, nil); len(report.Partitions) != 0 || report.FirstError() != nil {
+		t.Errorf("no partitions expected an empty report but was %+v", report)
+	}
+}
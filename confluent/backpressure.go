@@ -0,0 +1,131 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//queueFullPollMs is the time to serve delivery reports while waiting for free queue space
+const queueFullPollMs = 10
+
+//maxRetryBackoff limits the exponential backoff of the retry policy
+const maxRetryBackoff = 5 * time.Second
+
+//defaults of the queue full config for zero values
+const (
+	defaultQueueFullTimeout = 30 * time.Second
+	defaultQueueFullRetries = 3
+	defaultRetryBackoff     = 10 * time.Millisecond
+)
+
+//QueueFullPolicy defines the behaviour when the local librdkafka queue is full
+type QueueFullPolicy int
+
+const (
+	//QueueFullFail returns the queue full error immediately
+	QueueFullFail QueueFullPolicy = iota
+	//QueueFullBlock serves delivery reports until there is space in the queue or the timeout expired
+	QueueFullBlock
+	//QueueFullRetry retries with exponential backoff
+	QueueFullRetry
+)
+
+//QueueFullConfig configures the send behaviour when the local librdkafka queue is full
+//zero values are replaced by the defaults, Timeout 30s for the block policy, MaxRetries 3 and RetryBackoff 10ms for the retry policy
+type QueueFullConfig struct {
+	Policy       QueueFullPolicy
+	Timeout      time.Duration
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+//SetQueueFullConfig sets the policy used when the local queue is full, sends in progress use the previous one
+func (tp *TopicProducer) SetQueueFullConfig(config QueueFullConfig) error {
+	config, err := config.withDefaults()
+	if err != nil {
+		return err
+	}
+	tp.configMutex.Lock()
+	defer tp.configMutex.Unlock()
+	tp.queueFull = config
+	return nil
+}
+
+func (tp *TopicProducer) getQueueFullConfig() QueueFullConfig {
+	tp.configMutex.RLock()
+	defer tp.configMutex.RUnlock()
+	return tp.queueFull
+}
+
+//withDefaults rejects negative values and replaces zero values by the defaults of the policy
+func (config QueueFullConfig) withDefaults() (QueueFullConfig, error) {
+	if config.Policy < QueueFullFail || config.Policy > QueueFullRetry {
+		return config, fmt.Errorf("queue full policy invalid [%d]", config.Policy)
+	}
+	if config.Timeout < 0 || config.MaxRetries < 0 || config.RetryBackoff < 0 {
+		return config, fmt.Errorf("queue full config negative timeout [%v] retries [%d] backoff [%v]", config.Timeout, config.MaxRetries, config.RetryBackoff)
+	}
+	switch config.Policy {
+	case QueueFullBlock:
+		if config.Timeout == 0 {
+			config.Timeout = defaultQueueFullTimeout
+		}
+	case QueueFullRetry:
+		if config.MaxRetries == 0 {
+			config.MaxRetries = defaultQueueFullRetries
+		}
+		if config.RetryBackoff == 0 {
+			config.RetryBackoff = defaultRetryBackoff
+		}
+	}
+	return config, nil
+}
+
+//enqueue produces the message and applies the queue full policy
+func (tp *TopicProducer) enqueue(ctx context.Context, m *kafka.Message, config QueueFullConfig) error {
+	if config.Policy == QueueFullBlock && config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	backoff := config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := tp.produceOpen(m)
+		if !isQueueFull(err) || config.Policy == QueueFullFail {
+			return err
+		}
+
+		switch config.Policy {
+		case QueueFullBlock:
+			//polling delivery reports frees space in the queue
+			if tp.flushOpen(queueFullPollMs) < 0 {
+				return fmt.Errorf("producer closed [%s]", tp.ClientID)
+			}
+		case QueueFullRetry:
+			if attempt >= config.MaxRetries {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("send aborted with full local queue [%v] error [%v]", ctx.Err(), err)
+		}
+	}
+}
+
+func isQueueFull(err error) bool {
+	kafkaErr, ok := err.(kafka.Error)
+	return ok && kafkaErr.Code() == kafka.ErrQueueFull
+}
@@ -0,0 +1,134 @@
+package confluent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//fullQueue rejects the first messages with queue full
+type fullQueue struct {
+	mutex    sync.Mutex
+	full     int
+	produced int
+	attempts int
+	flushes  int
+}
+
+func (q *fullQueue) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.attempts++
+	if q.full < 0 || q.attempts <= q.full {
+		return kafka.NewError(kafka.ErrQueueFull, "Local: Queue full", false)
+	}
+	q.produced++
+	return nil
+}
+
+func (q *fullQueue) Flush(timeoutMs int) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.flushes++
+	return 0
+}
+
+func newFullQueueProducer(t *testing.T, full int, config QueueFullConfig) (*TopicProducer, *fullQueue) {
+	queue := &fullQueue{full: full}
+	tp := &TopicProducer{ClientID: "backpressure", partitionCounts: map[string]partitionCount{}, queue: queue}
+	err := tp.SetQueueFullConfig(config)
+	if err != nil {
+		t.Fatalf("cannot set queue full config error [%v]", err)
+	}
+	return tp, queue
+}
+
+func TestQueueFullFail(t *testing.T) {
+	tp, queue := newFullQueueProducer(t, 1, QueueFullConfig{Policy: QueueFullFail})
+	err := tp.Send("orders", 0, []byte("k"), []byte("v"))
+	if !isQueueFull(err) || queue.attempts != 1 || queue.flushes != 0 {
+		t.Errorf("fail policy expected queue full after one attempt but was [%v] attempts [%d] flushes [%d]", err, queue.attempts, queue.flushes)
+	}
+	if tp.GetInFlightCount() != 0 {
+		t.Errorf("rejected message expected not to be in flight but was [%d]", tp.GetInFlightCount())
+	}
+}
+
+func TestQueueFullBlock(t *testing.T) {
+	tp, queue := newFullQueueProducer(t, 3, QueueFullConfig{Policy: QueueFullBlock})
+	err := tp.Send("orders", 0, []byte("k"), []byte("v"))
+	if err != nil || queue.produced != 1 || queue.flushes != 3 {
+		t.Errorf("block policy expected to serve the queue until there is space but was [%v] produced [%d] flushes [%d]", err, queue.produced, queue.flushes)
+	}
+
+	tp, _ = newFullQueueProducer(t, -1, QueueFullConfig{Policy: QueueFullBlock, Timeout: 50 * time.Millisecond})
+	started := time.Now()
+	err = tp.Send("orders", 0, []byte("k"), []byte("v"))
+	if err == nil || !strings.Contains(err.Error(), "full local queue") || time.Since(started) > 5*time.Second {
+		t.Errorf("block policy expected to give up after the timeout but was [%v] after [%v]", err, time.Since(started))
+	}
+
+	tp, _ = newFullQueueProducer(t, -1, QueueFullConfig{Policy: QueueFullBlock, Timeout: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = tp.SendContext(ctx, "orders", 0, []byte("k"), []byte("v"))
+	if err == nil || ctx.Err() == nil {
+		t.Errorf("block policy expected to give up with the context but was [%v]", err)
+	}
+}
+
+func TestQueueFullRetry(t *testing.T) {
+	tp, queue := newFullQueueProducer(t, 2, QueueFullConfig{Policy: QueueFullRetry, MaxRetries: 2, RetryBackoff: time.Millisecond})
+	err := tp.Send("orders", 0, []byte("k"), []byte("v"))
+	if err != nil || queue.attempts != 3 || queue.produced != 1 {
+		t.Errorf("retry policy expected success on the last retry but was [%v] attempts [%d]", err, queue.attempts)
+	}
+
+	tp, queue = newFullQueueProducer(t, -1, QueueFullConfig{Policy: QueueFullRetry, MaxRetries: 2, RetryBackoff: time.Millisecond})
+	err = tp.Send("orders", 0, []byte("k"), []byte("v"))
+	if !isQueueFull(err) || queue.attempts != 3 {
+		t.Errorf("retry policy expected queue full after the retries but was [%v] attempts [%d]", err, queue.attempts)
+	}
+
+	//the default backoff does not spin
+	tp, queue = newFullQueueProducer(t, -1, QueueFullConfig{Policy: QueueFullRetry})
+	started := time.Now()
+	err = tp.Send("orders", 0, []byte("k"), []byte("v"))
+	elapsed := time.Since(started)
+	if !isQueueFull(err) || queue.attempts != defaultQueueFullRetries+1 || elapsed < defaultRetryBackoff*(1+2+4) {
+		t.Errorf("retry policy expected default retries with backoff but was [%v] attempts [%d] after [%v]", err, queue.attempts, elapsed)
+	}
+}
+
+func TestQueueFullConfigDefaults(t *testing.T) {
+	tests := []struct {
+		config   QueueFullConfig
+		expected QueueFullConfig
+		valid    bool
+	}{
+		{QueueFullConfig{}, QueueFullConfig{}, true},
+		{QueueFullConfig{Policy: QueueFullBlock}, QueueFullConfig{Policy: QueueFullBlock, Timeout: defaultQueueFullTimeout}, true},
+		{QueueFullConfig{Policy: QueueFullBlock, Timeout: time.Second}, QueueFullConfig{Policy: QueueFullBlock, Timeout: time.Second}, true},
+		{QueueFullConfig{Policy: QueueFullRetry}, QueueFullConfig{Policy: QueueFullRetry, MaxRetries: defaultQueueFullRetries, RetryBackoff: defaultRetryBackoff}, true},
+		{QueueFullConfig{Policy: QueueFullRetry, MaxRetries: 7, RetryBackoff: time.Second}, QueueFullConfig{Policy: QueueFullRetry, MaxRetries: 7, RetryBackoff: time.Second}, true},
+		{QueueFullConfig{Policy: QueueFullBlock, Timeout: -time.Second}, QueueFullConfig{}, false},
+		{QueueFullConfig{Policy: QueueFullRetry, MaxRetries: -1}, QueueFullConfig{}, false},
+		{QueueFullConfig{Policy: QueueFullRetry, RetryBackoff: -time.Second}, QueueFullConfig{}, false},
+		{QueueFullConfig{Policy: QueueFullPolicy(9)}, QueueFullConfig{}, false},
+	}
+	for _, test := range tests {
+		tp := &TopicProducer{}
+		err := tp.SetQueueFullConfig(test.config)
+		if (err == nil) != test.valid {
+			t.Errorf("config %+v expected valid [%t] but was error [%v]", test.config, test.valid, err)
+			continue
+		}
+		if test.valid && tp.getQueueFullConfig() != test.expected {
+			t.Errorf("config %+v expected %+v but was %+v", test.config, test.expected, tp.getQueueFullConfig())
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//backupPollMs is the poll timeout of the backup reader
+const backupPollMs = 100
+
+//backupProgressInterval is the minimum time between two progress reports
+const backupProgressInterval = time.Second
+
+//BackupProgress is the state of a running backup or restore
+//Total is the number of messages expected, for a backup it is an upper bound as compacted offsets are skipped
+type BackupProgress struct {
+	Topic    string
+	Messages int64
+	Total    int64
+	Done     bool
+}
+
+//BackupProgressFunc is called about once per second and when the backup or restore is done
+type BackupProgressFunc func(progress BackupProgress)
+
+//backupProgressReporter limits the progress reports to the interval
+type backupProgressReporter struct {
+	progress   BackupProgress
+	report     BackupProgressFunc
+	lastReport time.Time
+}
+
+func (r *backupProgressReporter) add() {
+	r.progress.Messages++
+	if r.report != nil && time.Since(r.lastReport) >= backupProgressInterval {
+		r.report(r.progress)
+		r.lastReport = time.Now()
+	}
+}
+
+func (r *backupProgressReporter) done() {
+	r.progress.Done = true
+	if r.report != nil {
+		r.report(r.progress)
+	}
+}
+
+//BackupTopic writes all messages of the topic up to the high watermarks captured at start to the writer
+func BackupTopic(ctx context.Context, topic string, clientID string, writer io.Writer, progress BackupProgressFunc) (int64, error) {
+	reader, err := newTopicReader(topic, clientID, nil, OffsetBeginning)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	reporter := &backupProgressReporter{progress: BackupProgress{Topic: topic}, report: progress, lastReport: time.Now()}
+	ends := map[int32]int64{}
+	for partition := range reader.atEnd {
+		low, high, err := reader.Consumer.QueryWatermarkOffsets(topic, partition, remainingMs(ctx))
+		if err != nil {
+			return 0, fmt.Errorf("cannot query watermarks [%s] error [%v]", PartitionRef{Topic: topic, Partition: partition}, err)
+		}
+		if high > low {
+			ends[partition] = high
+			reporter.progress.Total += high - low
+		}
+	}
+
+	backup, err := NewBackupWriter(writer, topic, int32(len(reader.atEnd)))
+	if err != nil {
+		return 0, err
+	}
+	for len(ends) > 0 {
+		if ctx.Err() != nil {
+			return reporter.progress.Messages, fmt.Errorf("backup of topic [%s] cancelled error [%v]", topic, ctx.Err())
+		}
+		m, err := reader.ReadMessage(backupPollMs)
+		if err != nil {
+			return reporter.progress.Messages, err
+		}
+		if m == nil {
+			//the offsets between the last message and the watermark of a partition at the end are control records
+			for partition := range ends {
+				if reader.isAtEnd(partition) {
+					delete(ends, partition)
+				}
+			}
+			continue
+		}
+
+		partition := m.TopicPartition.Partition
+		offset := int64(m.TopicPartition.Offset)
+		end, ok := ends[partition]
+		if !ok || offset >= end {
+			continue
+		}
+		err = backup.Write(BackupMessage{
+			Partition: partition,
+			Offset:    offset,
+			Timestamp: m.Timestamp,
+			Key:       m.Key,
+			Value:     m.Value,
+			Headers:   m.Headers,
+		})
+		if err != nil {
+			return reporter.progress.Messages, err
+		}
+		reporter.add()
+		if offset+1 >= end {
+			delete(ends, partition)
+		}
+	}
+
+	err = backup.Close()
+	if err != nil {
+		return reporter.progress.Messages, err
+	}
+	reporter.done()
+	return reporter.progress.Messages, nil
+}
+
+//RestoreTopic verifies the backup and replays it to the topic with the original partitions, timestamps and headers
+//the backup is read from the start of the file, the topic needs at least the partitions of the backup, the offsets are assigned by the broker
+func RestoreTopic(ctx context.Context, topic string, clientID string, file io.ReadSeeker, progress BackupProgressFunc) (int64, error) {
+	total, maxPartition, err := verifyBackupFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	producer, err := newTopicProducer(clientID)
+	if err != nil {
+		return 0, err
+	}
+	defer producer.Close()
+	err = producer.SetQueueFullConfig(QueueFullConfig{Policy: QueueFullBlock})
+	if err != nil {
+		return 0, err
+	}
+
+	metadata, err := producer.GetClusterMetadata(ctx, topic)
+	if err != nil {
+		return 0, err
+	}
+	info := metadata.Topics[topic]
+	if info.Error != nil {
+		return 0, fmt.Errorf("topic [%s] metadata error [%v]", topic, info.Error)
+	}
+	if int32(len(info.Partitions)) <= maxPartition {
+		return 0, fmt.Errorf("topic [%s] has [%d] partitions but the backup needs [%d]", topic, len(info.Partitions), maxPartition+1)
+	}
+
+	reader, err := NewBackupReader(file)
+	if err != nil {
+		return 0, err
+	}
+	reporter := &backupProgressReporter{progress: BackupProgress{Topic: topic, Total: total}, report: progress, lastReport: time.Now()}
+	for {
+		m, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return reporter.progress.Messages, err
+		}
+		err = producer.SendMessage(ctx, &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: m.Partition},
+			Key:            m.Key,
+			Value:          m.Value,
+			Timestamp:      m.Timestamp,
+			Headers:        m.Headers,
+		}, nil)
+		if err != nil {
+			return reporter.progress.Messages, fmt.Errorf("cannot restore message [%d] of partition [%d] error [%v]", m.Offset, m.Partition, err)
+		}
+		reporter.add()
+	}
+
+	result := producer.FlushContext(ctx)
+	if len(result.DeliveryErrors) > 0 {
+		return reporter.progress.Messages, fmt.Errorf("restore of topic [%s] failed deliveries [%d] first error [%v]", topic, len(result.DeliveryErrors), result.DeliveryErrors[0])
+	}
+	if result.Undelivered > 0 {
+		return reporter.progress.Messages, fmt.Errorf("restore of topic [%s] undelivered messages [%d]", topic, result.Undelivered)
+	}
+	reporter.done()
+	return reporter.progress.Messages, nil
+}
+
+//verifyBackupFile verifies the backup from the start of the file and rewinds the file for the restore
+func verifyBackupFile(file io.ReadSeeker) (int64, int32, error) {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot rewind backup error [%v]", err)
+	}
+	total, maxPartition, err := verifyBackup(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot rewind backup error [%v]", err)
+	}
+	return total, maxPartition, nil
+}
+
+//verifyBackup reads the whole backup and returns the message count and the highest partition
+func verifyBackup(file io.Reader) (int64, int32, error) {
+	reader, err := NewBackupReader(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	maxPartition := int32(-1)
+	for {
+		m, err := reader.Read()
+		if err == io.EOF {
+			return reader.Messages(), maxPartition, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if m.Partition > maxPartition {
+			maxPartition = m.Partition
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package confluent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//backupMagic starts a backup file, the last byte is the format version
+var backupMagic = []byte{'O', 'K', 'F', 'W', 'B', 'A', 'K', 1}
+
+//maxBackupRecordBytes limits the record length read before its checksum is verified
+//the message.max.bytes limit of the broker is 1MB by default, the headroom allows for raised limits and the record fields
+const maxBackupRecordBytes = 64 * 1024 * 1024
+
+const (
+	backupRecordHeader  = 8
+	backupRecordTopic   = byte(1)
+	backupRecordMessage = byte(2)
+	backupRecordEnd     = byte(3)
+)
+
+//ErrBackupTruncated is returned when a backup file ends without end record
+var ErrBackupTruncated = errors.New("backup file truncated")
+
+//BackupMessage is a message of a backup file
+type BackupMessage struct {
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+	Key       []byte
+	Value     []byte
+	Headers   []kafka.Header
+}
+
+//BackupWriter writes a backup file
+//every record is prefixed with its length and crc32, the end record holds the message count
+type BackupWriter struct {
+	writer   *bufio.Writer
+	messages int64
+}
+
+//NewBackupWriter writes the file header for the topic with the partition count
+func NewBackupWriter(writer io.Writer, topic string, partitions int32) (*BackupWriter, error) {
+	w := &BackupWriter{writer: bufio.NewWriter(writer)}
+	_, err := w.writer.Write(backupMagic)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write backup header error [%v]", err)
+	}
+	body := []byte{backupRecordTopic}
+	body = appendInt64(body, time.Now().UnixNano()/int64(time.Millisecond))
+	body = appendInt32(body, partitions)
+	body = appendBytes(body, []byte(topic))
+	return w, w.writeRecord(body)
+}
+
+//Write appends the message
+func (w *BackupWriter) Write(m BackupMessage) error {
+	body := []byte{backupRecordMessage}
+	body = appendInt32(body, m.Partition)
+	body = appendInt64(body, m.Offset)
+	body = appendInt64(body, timestampMs(m.Timestamp))
+	body = appendBytes(body, m.Key)
+	body = appendBytes(body, m.Value)
+	body = appendHeaders(body, m.Headers)
+	err := w.writeRecord(body)
+	if err != nil {
+		return err
+	}
+	w.messages++
+	return nil
+}
+
+//Close writes the end record and flushes the file, the underlying writer is not closed
+func (w *BackupWriter) Close() error {
+	body := appendInt64([]byte{backupRecordEnd}, w.messages)
+	err := w.writeRecord(body)
+	if err != nil {
+		return err
+	}
+	err = w.writer.Flush()
+	if err != nil {
+		return fmt.Errorf("cannot flush backup error [%v]", err)
+	}
+	return nil
+}
+
+func (w *BackupWriter) writeRecord(body []byte) error {
+	if len(body) > maxBackupRecordBytes {
+		return fmt.Errorf("backup record length [%d] exceeds the limit [%d]", len(body), maxBackupRecordBytes)
+	}
+	var header [backupRecordHeader]byte
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(body))
+	_, err := w.writer.Write(header[:])
+	if err == nil {
+		_, err = w.writer.Write(body)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write backup record error [%v]", err)
+	}
+	return nil
+}
+
+//BackupReader reads a backup file and verifies the checksums
+type BackupReader struct {
+	Topic      string
+	Partitions int32
+	Created    time.Time
+	reader     *bufio.Reader
+	messages   int64
+	ended      bool
+}
+
+//NewBackupReader reads the file header
+func NewBackupReader(reader io.Reader) (*BackupReader, error) {
+	r := &BackupReader{reader: bufio.NewReader(reader)}
+	magic := make([]byte, len(backupMagic))
+	_, err := io.ReadFull(r.reader, magic)
+	if err != nil || string(magic[:len(magic)-1]) != string(backupMagic[:len(backupMagic)-1]) {
+		return nil, fmt.Errorf("not a backup file")
+	}
+	if magic[len(magic)-1] != backupMagic[len(backupMagic)-1] {
+		return nil, fmt.Errorf("backup file version unknown [%d]", magic[len(magic)-1])
+	}
+
+	body, err := r.readRecord()
+	if err != nil {
+		return nil, err
+	}
+	if body[0] != backupRecordTopic || len(body) < 13 {
+		return nil, fmt.Errorf("backup topic record missing")
+	}
+	r.Created = msToTime(int64(binary.BigEndian.Uint64(body[1:9])))
+	r.Partitions = int32(binary.BigEndian.Uint32(body[9:13]))
+	topic, _, err := readBytes(body[13:])
+	if err != nil {
+		return nil, fmt.Errorf("backup topic record invalid error [%v]", err)
+	}
+	r.Topic = string(topic)
+	return r, nil
+}
+
+//Read returns the next message, io.EOF after the end record and ErrBackupTruncated if the end record is missing
+func (r *BackupReader) Read() (*BackupMessage, error) {
+	if r.ended {
+		return nil, io.EOF
+	}
+	body, err := r.readRecord()
+	if err != nil {
+		return nil, err
+	}
+	switch body[0] {
+	case backupRecordMessage:
+		m, err := decodeBackupMessage(body[1:])
+		if err != nil {
+			return nil, fmt.Errorf("backup message [%d] invalid error [%v]", r.messages, err)
+		}
+		r.messages++
+		return m, nil
+	case backupRecordEnd:
+		if len(body) < 9 {
+			return nil, fmt.Errorf("backup end record invalid")
+		}
+		count := int64(binary.BigEndian.Uint64(body[1:9]))
+		if count != r.messages {
+			return nil, fmt.Errorf("backup message count expected [%d] but was [%d]", count, r.messages)
+		}
+		r.ended = true
+		return nil, io.EOF
+	}
+	return nil, fmt.Errorf("backup record type unknown [%d]", body[0])
+}
+
+//Messages returns the number of messages read
+func (r *BackupReader) Messages() int64 {
+	return r.messages
+}
+
+func (r *BackupReader) readRecord() ([]byte, error) {
+	var header [backupRecordHeader]byte
+	_, err := io.ReadFull(r.reader, header[:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrBackupTruncated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read backup record error [%v]", err)
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length == 0 || length > maxBackupRecordBytes {
+		return nil, fmt.Errorf("backup record length invalid [%d] after message [%d]", length, r.messages)
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r.reader, body)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrBackupTruncated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read backup record error [%v]", err)
+	}
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("backup record checksum mismatch after message [%d]", r.messages)
+	}
+	return body, nil
+}
+
+func decodeBackupMessage(body []byte) (*BackupMessage, error) {
+	if len(body) < 20 {
+		return nil, fmt.Errorf("message truncated")
+	}
+	m := &BackupMessage{
+		Partition: int32(binary.BigEndian.Uint32(body[0:4])),
+		Offset:    int64(binary.BigEndian.Uint64(body[4:12])),
+		Timestamp: msToTime(int64(binary.BigEndian.Uint64(body[12:20]))),
+	}
+	var err error
+	body = body[20:]
+	m.Key, body, err = readBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	m.Value, body, err = readBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	m.Headers, _, err = readHeaders(body)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func appendInt64(buffer []byte, value int64) []byte {
+	var encoded [8]byte
+	binary.BigEndian.PutUint64(encoded[:], uint64(value))
+	return append(buffer, encoded[:]...)
+}
+
+//timestampMs returns the unix milliseconds, -1 for a zero time
+func timestampMs(timestamp time.Time) int64 {
+	if timestamp.IsZero() {
+		return -1
+	}
+	return timestamp.UnixNano() / int64(time.Millisecond)
+}
+
+func msToTime(ms int64) time.Time {
+	if ms < 0 {
+		return time.Time{}
+	}
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+}
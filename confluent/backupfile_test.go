@@ -0,0 +1,190 @@
+package confluent
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+var testBackupMessages = []BackupMessage{
+	{Partition: 0, Offset: 0, Timestamp: time.Unix(1553000000, 123000000), Key: []byte("k1"), Value: []byte("v1")},
+	{Partition: 2, Offset: 7, Timestamp: time.Unix(1553000001, 0), Key: []byte("k2"), Value: nil, Headers: []kafka.Header{{Key: "h1", Value: []byte("x")}, {Key: "h2", Value: nil}}},
+	{Partition: 1, Offset: 3, Key: nil, Value: []byte{}},
+}
+
+func writeTestBackup(t *testing.T, messages []BackupMessage) []byte {
+	var buffer bytes.Buffer
+	w, err := NewBackupWriter(&buffer, "backup-topic", 3)
+	if err != nil {
+		t.Fatalf("cannot create backup writer error [%v]", err)
+	}
+	for _, m := range messages {
+		err = w.Write(m)
+		if err != nil {
+			t.Fatalf("cannot write backup message error [%v]", err)
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("cannot close backup writer error [%v]", err)
+	}
+	return buffer.Bytes()
+}
+
+//readTestBackup reads all messages and returns the error ending the backup, nil after the end record
+func readTestBackup(data []byte) ([]BackupMessage, error) {
+	r, err := NewBackupReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var messages []BackupMessage
+	for {
+		m, err := r.Read()
+		if err == io.EOF {
+			return messages, nil
+		}
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, *m)
+	}
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	data := writeTestBackup(t, testBackupMessages)
+
+	r, err := NewBackupReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot read backup header error [%v]", err)
+	}
+	if r.Topic != "backup-topic" || r.Partitions != 3 || r.Created.IsZero() {
+		t.Errorf("backup header unexpected topic [%s] partitions [%d] created [%v]", r.Topic, r.Partitions, r.Created)
+	}
+
+	messages, err := readTestBackup(data)
+	if err != nil {
+		t.Fatalf("cannot read backup error [%v]", err)
+	}
+	if !reflect.DeepEqual(messages, testBackupMessages) {
+		t.Errorf("backup messages expected [%v] but was [%v]", testBackupMessages, messages)
+	}
+}
+
+func TestBackupEmpty(t *testing.T) {
+	messages, err := readTestBackup(writeTestBackup(t, nil))
+	if err != nil || len(messages) != 0 {
+		t.Errorf("empty backup expected no messages but was [%v] error [%v]", messages, err)
+	}
+}
+
+func TestVerifyBackupFileRewinds(t *testing.T) {
+	file := bytes.NewReader(writeTestBackup(t, testBackupMessages))
+	//the cli reads the header for the topic before the restore
+	_, err := NewBackupReader(file)
+	if err != nil {
+		t.Fatalf("cannot read backup header error [%v]", err)
+	}
+
+	total, maxPartition, err := verifyBackupFile(file)
+	if err != nil {
+		t.Fatalf("cannot verify backup error [%v]", err)
+	}
+	if total != 3 || maxPartition != 2 {
+		t.Errorf("verify expected [3] messages and max partition [2] but was [%d] [%d]", total, maxPartition)
+	}
+	messages, _, err := verifyBackup(file)
+	if err != nil || messages != 3 {
+		t.Errorf("backup not rewound after verify messages [%d] error [%v]", messages, err)
+	}
+}
+
+func TestBackupChecksumMismatch(t *testing.T) {
+	data := writeTestBackup(t, testBackupMessages)
+	//flip a byte of the value of the first message
+	index := bytes.Index(data, []byte("v1"))
+	data[index] ^= 0xff
+
+	messages, err := readTestBackup(data)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum error but was [%v]", err)
+	}
+	if len(messages) != 0 {
+		t.Errorf("expected no messages before the corrupt record but was [%d]", len(messages))
+	}
+	_, _, err = verifyBackup(bytes.NewReader(data))
+	if err == nil {
+		t.Errorf("verify of corrupt backup expected error")
+	}
+}
+
+func TestBackupTruncated(t *testing.T) {
+	data := writeTestBackup(t, testBackupMessages)
+	headerEnd := len(writeTestBackup(t, nil)) - backupRecordHeader - 9
+	for length := headerEnd; length < len(data); length++ {
+		_, err := readTestBackup(data[:length])
+		if err != ErrBackupTruncated {
+			t.Errorf("backup truncated at [%d/%d] expected [%v] but was [%v]", length, len(data), ErrBackupTruncated, err)
+		}
+	}
+}
+
+func TestBackupHeaderInvalid(t *testing.T) {
+	data := writeTestBackup(t, nil)
+	cases := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "not a backup file"},
+		{"magic", append([]byte("NOTOKFW!"), data[len(backupMagic):]...), "not a backup file"},
+		{"version", append(append([]byte{}, backupMagic[:len(backupMagic)-1]...), append([]byte{99}, data[len(backupMagic):]...)...), "version unknown"},
+		{"topic record", data[:len(backupMagic)+3], ErrBackupTruncated.Error()},
+	}
+	for _, c := range cases {
+		_, err := NewBackupReader(bytes.NewReader(c.data))
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("header [%s] expected error [%s] but was [%v]", c.name, c.err, err)
+		}
+	}
+}
+
+func TestBackupMessageCountMismatch(t *testing.T) {
+	var buffer bytes.Buffer
+	w, err := NewBackupWriter(&buffer, "backup-topic", 1)
+	if err != nil {
+		t.Fatalf("cannot create backup writer error [%v]", err)
+	}
+	w.messages = 5
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("cannot close backup writer error [%v]", err)
+	}
+	_, err = readTestBackup(buffer.Bytes())
+	if err == nil || !strings.Contains(err.Error(), "message count") {
+		t.Errorf("expected message count error but was [%v]", err)
+	}
+}
+
+func TestBackupRecordLengthLimit(t *testing.T) {
+	data := writeTestBackup(t, testBackupMessages)
+	//the length of the first message record claims 4GB
+	index := bytes.Index(data, []byte("k1")) - 4 - 21 - backupRecordHeader
+	copy(data[index:], []byte{0xff, 0xff, 0xff, 0xff})
+
+	_, err := readTestBackup(data)
+	if err == nil || !strings.Contains(err.Error(), "length invalid") {
+		t.Errorf("expected length error but was [%v]", err)
+	}
+
+	var buffer bytes.Buffer
+	w, _ := NewBackupWriter(&buffer, "backup-topic", 1)
+	err = w.Write(BackupMessage{Value: make([]byte, maxBackupRecordBytes)})
+	if err == nil {
+		t.Errorf("message above the record limit expected error")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/rbock44/okfw-confluent-go/confluent"
+)
+
+func runBackup(args []string) error {
+	var cluster clusterFlags
+	flags := newFlagSet("backup", &cluster)
+	topic := flags.String("topic", "", "topic to back up")
+	file := flags.String("file", "", "backup file to write")
+	clientID := flags.String("client-id", "okfw-cli", "client id used for the reader group")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *topic == "" || *file == "" {
+		return fmt.Errorf("topic and file are required")
+	}
+	cluster.apply()
+
+	output, err := os.Create(*file)
+	if err != nil {
+		return fmt.Errorf("cannot create backup file [%s] error [%v]", *file, err)
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	_, err = confluent.BackupTopic(ctx, *topic, *clientID, output, printProgress("backup"))
+	if err == nil {
+		err = output.Sync()
+	}
+	closeErr := output.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*file)
+		return err
+	}
+	return nil
+}
+
+func runRestore(args []string) error {
+	var cluster clusterFlags
+	flags := newFlagSet("restore", &cluster)
+	topic := flags.String("topic", "", "topic to restore to, the topic of the backup if empty")
+	file := flags.String("file", "", "backup file to read")
+	clientID := flags.String("client-id", "okfw-cli", "client id of the producer")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("file is required")
+	}
+	cluster.apply()
+
+	input, err := os.Open(*file)
+	if err != nil {
+		return fmt.Errorf("cannot open backup file [%s] error [%v]", *file, err)
+	}
+	defer input.Close()
+	target := *topic
+	if target == "" {
+		reader, err := confluent.NewBackupReader(input)
+		if err != nil {
+			return err
+		}
+		target = reader.Topic
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	_, err = confluent.RestoreTopic(ctx, target, *clientID, input, printProgress("restore"))
+	return err
+}
+
+//printProgress prints the backup or restore progress to stderr
+func printProgress(action string) confluent.BackupProgressFunc {
+	return func(progress confluent.BackupProgress) {
+		state := "running"
+		if progress.Done {
+			state = "done"
+		}
+		fmt.Fprintf(os.Stderr, "%s of topic [%s] %s messages [%d/%d]\n", action, progress.Topic, state, progress.Messages, progress.Total)
+	}
+}
+
+//interruptContext returns a context cancelled by an interrupt signal
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(interrupt)
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rbock44/okfw-confluent-go/confluent"
+)
+
+//consumePollMs is the poll timeout of the consume command
+const consumePollMs = 500
+
+//consumedMessage is the json output of a consumed message
+type consumedMessage struct {
+	Topic         string      `json:"topic"`
+	Partition     int32       `json:"partition"`
+	Offset        int64       `json:"offset"`
+	Timestamp     time.Time   `json:"timestamp"`
+	KeySchemaID   int         `json:"keySchemaId,omitempty"`
+	Key           interface{} `json:"key"`
+	ValueSchemaID int         `json:"valueSchemaId,omitempty"`
+	Value         interface{} `json:"value"`
+}
+
+func runConsume(args []string) error {
+	var cluster clusterFlags
+	flags := newFlagSet("consume", &cluster)
+	topic := flags.String("topic", "", "topic to consume")
+	partitions := flags.String("partitions", "", "comma separated partitions, all partitions if empty")
+	offset := flags.String("offset", "earliest", "start offset: earliest, latest or an offset")
+	limit := flags.Int("limit", 0, "stop after n messages, 0 for no limit")
+	follow := flags.Bool("follow", false, "wait for new messages at the end of the partitions")
+	format := flags.String("format", "json", "output format: json (message with metadata), value (decoded value) or raw (key and value as text)")
+	clientID := flags.String("client-id", "okfw-cli", "client id used for the reader group")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	if *format != "json" && *format != "value" && *format != "raw" {
+		return fmt.Errorf("output format unknown [%s]", *format)
+	}
+	startOffset, err := parseStartOffset(*offset)
+	if err != nil {
+		return err
+	}
+	partitionList, err := parsePartitions(*partitions)
+	if err != nil {
+		return err
+	}
+	cluster.apply()
+
+	factory := confluent.NewFrameworkFactory()
+	reader, err := factory.NewTopicReader(*topic, *clientID, partitionList, startOffset)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	codec := factory.NewSchemaCodec()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	encoder := json.NewEncoder(os.Stdout)
+	count := 0
+	for *limit == 0 || count < *limit {
+		select {
+		case <-interrupt:
+			return nil
+		default:
+		}
+		if !*follow && reader.AtEnd() {
+			return nil
+		}
+		m, err := reader.ReadMessage(consumePollMs)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			continue
+		}
+		count++
+
+		if *format == "raw" {
+			fmt.Printf("%s\t%s\n", m.Key, m.Value)
+			continue
+		}
+		keySchemaID, key := decodePayload(codec, m.Key)
+		valueSchemaID, value := decodePayload(codec, m.Value)
+		if *format == "value" {
+			err = encoder.Encode(value)
+		} else {
+			err = encoder.Encode(consumedMessage{
+				Topic:         *m.TopicPartition.Topic,
+				Partition:     m.TopicPartition.Partition,
+				Offset:        int64(m.TopicPartition.Offset),
+				Timestamp:     m.Timestamp,
+				KeySchemaID:   keySchemaID,
+				Key:           key,
+				ValueSchemaID: valueSchemaID,
+				Value:         value,
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("cannot write message [%s] error [%v]", m.TopicPartition, err)
+		}
+	}
+	return nil
+}
+
+//decodePayload decodes wire format data with the registry, other data is returned as text
+func decodePayload(codec *confluent.SchemaCodec, data []byte) (int, interface{}) {
+	if data == nil {
+		return 0, nil
+	}
+	if !confluent.IsWireFormat(data) {
+		return 0, string(data)
+	}
+	schemaID, value, err := codec.DecodeJSON(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return schemaID, string(data)
+	}
+	return schemaID, json.RawMessage(value)
+}
+
+func parseStartOffset(offset string) (int64, error) {
+	switch offset {
+	case "earliest":
+		return confluent.OffsetBeginning, nil
+	case "latest":
+		return confluent.OffsetEnd, nil
+	}
+	value, err := strconv.ParseInt(offset, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("offset must be earliest, latest or a positive number but was [%s]", offset)
+	}
+	return value, nil
+}
+
+func parsePartitions(list string) ([]int32, error) {
+	var partitions []int32
+	for _, value := range splitList(list) {
+		partition, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+		if err != nil || partition < 0 {
+			return nil, fmt.Errorf("partition invalid [%s]", value)
+		}
+		partitions = append(partitions, int32(partition))
+	}
+	return partitions, nil
+}
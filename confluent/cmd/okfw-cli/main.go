@@ -0,0 +1,93 @@
+//okfw-cli administrates kafka clusters used by okfw services with the confluent implementation
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rbock44/okfw-confluent-go/confluent"
+)
+
+//command runs a sub command with its arguments
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"backup":  {usage: "write all messages of a topic to a backup file", run: runBackup},
+	"consume": {usage: "print messages of a topic as json decoded with the schema registry", run: runConsume},
+	"offsets": {usage: "show, reset or copy committed offsets of a consumer group", run: runOffsets},
+	"produce": {usage: "send json lines encoded with the schema of a subject", run: runProduce},
+	"restore": {usage: "replay a backup file to a topic with the original partitions and timestamps", run: runRestore},
+	"schema":  {usage: "list, show, register, test, diff and delete schemas and set compatibility levels", run: runSchema},
+	"topics":  {usage: "plan or apply the topics of a spec file", run: runTopics},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command [%s]\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	err := cmd.run(os.Args[2:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: okfw-cli <command> [flags]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
+//clusterFlags are the connection flags shared by all commands
+type clusterFlags struct {
+	brokers  string
+	registry string
+	timeout  time.Duration
+}
+
+func newFlagSet(name string, cluster *clusterFlags) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&cluster.brokers, "brokers", "localhost", "kafka bootstrap servers")
+	flags.StringVar(&cluster.registry, "registry", "", "schema registry url, the registry default if empty")
+	flags.DurationVar(&cluster.timeout, "timeout", 30*time.Second, "timeout of cluster requests")
+	return flags
+}
+
+//apply sets the cluster connection for the clients created afterwards
+func (c *clusterFlags) apply() {
+	confluent.SetBootstrapServers(c.brokers)
+	if c.registry != "" {
+		confluent.SetSchemaRegistryURL(c.registry)
+	}
+}
+
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rbock44/okfw-confluent-go/confluent"
+)
+
+func runOffsets(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: okfw-cli offsets show|reset|copy -group <group> -topics <topic,...> [flags]")
+	}
+	action := args[0]
+
+	var cluster clusterFlags
+	flags := newFlagSet("offsets "+action, &cluster)
+	group := flags.String("group", "", "consumer group")
+	topics := flags.String("topics", "", "comma separated topics")
+	execute := flags.Bool("execute", false, "commit the offsets, without the changes are only shown (dry run)")
+	toEarliest := flags.Bool("to-earliest", false, "reset to the earliest offset")
+	toLatest := flags.Bool("to-latest", false, "reset to the latest offset")
+	toDatetime := flags.String("to-datetime", "", "reset to the first offset at or after the RFC3339 time")
+	toOffset := flags.Int64("to-offset", -1, "reset to the offset")
+	shiftBy := flags.Int64("shift-by", 0, "shift the current offsets by n")
+	from := flags.String("from-group", "", "group to copy the offsets from")
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	if *group == "" || *topics == "" {
+		return fmt.Errorf("group and topics are required")
+	}
+	cluster.apply()
+
+	manager, err := confluent.NewFrameworkFactory().NewOffsetManager(*group)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cluster.timeout)
+	defer cancel()
+
+	var changes []confluent.OffsetChange
+	switch action {
+	case "show":
+		changes, err = manager.GetCommittedOffsets(ctx, splitList(*topics)...)
+		if err != nil {
+			return err
+		}
+		writeOffsets(changes, false)
+		return nil
+	case "reset":
+		var reset confluent.OffsetReset
+		reset, err = parseOffsetReset(*toEarliest, *toLatest, *toDatetime, *toOffset, *shiftBy)
+		if err != nil {
+			return err
+		}
+		changes, err = manager.PlanReset(ctx, reset, splitList(*topics)...)
+	case "copy":
+		if *from == "" {
+			return fmt.Errorf("from-group is required to copy offsets")
+		}
+		changes, err = manager.PlanCopy(ctx, *from, splitList(*topics)...)
+	default:
+		return fmt.Errorf("unknown offsets action [%s]", action)
+	}
+	if err != nil {
+		return err
+	}
+
+	writeOffsets(changes, true)
+	if !*execute {
+		fmt.Printf("dry run, use -execute to commit the offsets of group [%s]\n", *group)
+		return nil
+	}
+	err = manager.Commit(ctx, changes)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("offsets of group [%s] committed\n", *group)
+	return nil
+}
+
+func parseOffsetReset(toEarliest bool, toLatest bool, toDatetime string, toOffset int64, shiftBy int64) (confluent.OffsetReset, error) {
+	var resets []confluent.OffsetReset
+	if toEarliest {
+		resets = append(resets, confluent.OffsetReset{Mode: confluent.ResetToEarliest})
+	}
+	if toLatest {
+		resets = append(resets, confluent.OffsetReset{Mode: confluent.ResetToLatest})
+	}
+	if toDatetime != "" {
+		timestamp, err := time.Parse(time.RFC3339, toDatetime)
+		if err != nil {
+			return confluent.OffsetReset{}, fmt.Errorf("cannot parse datetime [%s] error [%v]", toDatetime, err)
+		}
+		resets = append(resets, confluent.OffsetReset{Mode: confluent.ResetToTimestamp, Timestamp: timestamp})
+	}
+	if toOffset >= 0 {
+		resets = append(resets, confluent.OffsetReset{Mode: confluent.ResetToOffset, Offset: toOffset})
+	}
+	if shiftBy != 0 {
+		resets = append(resets, confluent.OffsetReset{Mode: confluent.ResetShiftBy, Shift: shiftBy})
+	}
+	if len(resets) != 1 {
+		return confluent.OffsetReset{}, fmt.Errorf("exactly one of to-earliest, to-latest, to-datetime, to-offset or shift-by is required")
+	}
+	return resets[0], nil
+}
+
+func writeOffsets(changes []confluent.OffsetChange, withTarget bool) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if withTarget {
+		fmt.Fprintf(writer, "TOPIC\tPARTITION\tLOW\tHIGH\tCURRENT\tTARGET\n")
+	} else {
+		fmt.Fprintf(writer, "TOPIC\tPARTITION\tLOW\tHIGH\tCURRENT\tLAG\n")
+	}
+	for _, change := range changes {
+		current := "-"
+		lag := change.High - change.Low
+		if change.Current >= 0 {
+			current = fmt.Sprintf("%d", change.Current)
+			lag = change.High - change.Current
+		}
+		if withTarget {
+			fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%s\t%d\n", change.Topic, change.Partition, change.Low, change.High, current, change.Target)
+		} else {
+			fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%s\t%d\n", change.Topic, change.Partition, change.Low, change.High, current, lag)
+		}
+	}
+	writer.Flush()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/rbock44/okfw-confluent-go/confluent"
+)
+
+//maxLineBytes limits the size of a json line read by the produce command
+const maxLineBytes = 16 * 1024 * 1024
+
+//producedRecord is a json line of the record input format, a null value sends a tombstone
+type producedRecord struct {
+	Key   json.RawMessage `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+func runProduce(args []string) error {
+	var cluster clusterFlags
+	flags := newFlagSet("produce", &cluster)
+	topic := flags.String("topic", "", "topic to send to")
+	partition := flags.Int("partition", int(confluent.PartitionAny), "partition, -1 lets the partitioner select the partition")
+	keySubject := flags.String("key-subject", "", "subject of the key schema, keys are sent as text if empty")
+	valueSubject := flags.String("value-subject", "", "subject of the value schema, values are sent as text if empty")
+	format := flags.String("format", "value", "input format: value (each line is a value) or record (each line is {\"key\":..., \"value\":...})")
+	key := flags.String("key", "", "key of all messages in the value format, json if a key subject is given")
+	input := flags.String("file", "", "file with json lines, stdin if empty")
+	clientID := flags.String("client-id", "okfw-cli", "client id of the producer")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	if *format != "value" && *format != "record" {
+		return fmt.Errorf("input format unknown [%s]", *format)
+	}
+
+	var reader io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return fmt.Errorf("cannot open input [%s] error [%v]", *input, err)
+		}
+		defer file.Close()
+		reader = file
+	}
+	cluster.apply()
+
+	factory := confluent.NewFrameworkFactory()
+	producer, err := factory.NewTopicProducer(*clientID)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+	//reading the input is faster than the broker accepts messages, wait for queue space instead of failing
+	err = producer.SetQueueFullConfig(confluent.QueueFullConfig{Policy: confluent.QueueFullBlock, Timeout: cluster.timeout})
+	if err != nil {
+		return err
+	}
+	codec := factory.NewSchemaCodec()
+
+	var fixedKey []byte
+	if *key != "" && *keySubject == "" {
+		fixedKey = []byte(*key)
+	} else if *key != "" {
+		fixedKey, err = codec.EncodeJSON(*keySubject, []byte(*key))
+		if err != nil {
+			return err
+		}
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		record := producedRecord{Value: data}
+		if *format == "record" {
+			err = json.Unmarshal(data, &record)
+			if err != nil {
+				return fmt.Errorf("cannot parse record in line [%d] error [%v]", line, err)
+			}
+		}
+		messageKey := fixedKey
+		if record.Key != nil {
+			messageKey, err = encodePayload(codec, *keySubject, record.Key)
+			if err != nil {
+				return fmt.Errorf("cannot encode key in line [%d] error [%v]", line, err)
+			}
+		}
+		value, err := encodePayload(codec, *valueSubject, record.Value)
+		if err != nil {
+			return fmt.Errorf("cannot encode value in line [%d] error [%v]", line, err)
+		}
+		err = producer.Send(*topic, int32(*partition), messageKey, value)
+		if err != nil {
+			return fmt.Errorf("cannot send line [%d] error [%v]", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read input error [%v]", err)
+	}
+
+	result := producer.Flush(cluster.timeout)
+	for _, err := range result.DeliveryErrors {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+	if result.Undelivered > 0 || len(result.DeliveryErrors) > 0 {
+		return fmt.Errorf("messages undelivered [%d] failed [%d]", result.Undelivered, len(result.DeliveryErrors))
+	}
+	fmt.Fprintf(os.Stderr, "messages sent [%d]\n", atomic.LoadInt64(&producer.SuccessCount))
+	return nil
+}
+
+//encodePayload encodes json with the latest schema of the subject, without subject json strings are sent as text
+//and other json as is, a missing or null payload is nil
+func encodePayload(codec *confluent.SchemaCodec, subject string, data json.RawMessage) ([]byte, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	if subject != "" {
+		return codec.EncodeJSON(subject, data)
+	}
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		return []byte(text), nil
+	}
+	return []byte(data), nil
+}
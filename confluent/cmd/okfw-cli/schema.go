@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/rbock44/okfw-confluent-go/confluent"
+)
+
+//compatibilityResult is the output of the compatibility test
+type compatibilityResult struct {
+	Subject    string `json:"subject"`
+	Compatible bool   `json:"compatible"`
+}
+
+//diffResult is the output of the schema diff
+type diffResult struct {
+	Subject    string `json:"subject"`
+	Version    int    `json:"version"`
+	ID         int    `json:"id"`
+	Equal      bool   `json:"equal"`
+	Registered string `json:"registered,omitempty"`
+	Local      string `json:"local,omitempty"`
+}
+
+func runSchema(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: okfw-cli schema subjects|versions|show|register|test|diff|compatibility|delete [flags]")
+	}
+	action := args[0]
+
+	var cluster clusterFlags
+	flags := newFlagSet("schema "+action, &cluster)
+	subject := flags.String("subject", "", "subject")
+	version := flags.Int("version", 0, "schema version, 0 for the latest version")
+	id := flags.Int("id", 0, "schema id")
+	file := flags.String("file", "", "avro schema file (.avsc)")
+	level := flags.String("level", "", "compatibility level to set, the current level is shown if empty")
+	output := flags.String("output", "text", "output format: text or json")
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("output format unknown [%s]", *output)
+	}
+	cluster.apply()
+
+	admin := confluent.NewFrameworkFactory().NewSchemaAdmin()
+	admin.HTTPClient.Timeout = cluster.timeout
+	out := &schemaOutput{json: *output == "json"}
+
+	switch action {
+	case "subjects":
+		subjects, err := admin.Subjects()
+		if err != nil {
+			return err
+		}
+		return out.write(subjects, func() {
+			for _, subject := range subjects {
+				fmt.Println(subject)
+			}
+		})
+	case "versions":
+		if *subject == "" {
+			return fmt.Errorf("subject is required")
+		}
+		versions, err := admin.Versions(*subject)
+		if err != nil {
+			return err
+		}
+		return out.write(versions, func() {
+			for _, version := range versions {
+				fmt.Println(version)
+			}
+		})
+	case "show":
+		var schema confluent.RegisteredSchema
+		switch {
+		case *id > 0:
+			schema, err = admin.GetSchemaByID(*id)
+		case *subject != "":
+			schema, err = admin.GetSchema(*subject, *version)
+		default:
+			return fmt.Errorf("id or subject is required")
+		}
+		if err != nil {
+			return err
+		}
+		return out.write(schema, func() {
+			normalized, err := confluent.NormalizeSchema(schema.Schema)
+			if err != nil {
+				normalized = schema.Schema
+			}
+			if schema.Subject != "" {
+				fmt.Printf("subject [%s] version [%d] id [%d]\n", schema.Subject, schema.Version, schema.ID)
+			}
+			fmt.Println(normalized)
+		})
+	case "register":
+		schema, err := readSchemaFile(*subject, *file)
+		if err != nil {
+			return err
+		}
+		schemaID, err := admin.Register(*subject, schema)
+		if err != nil {
+			return err
+		}
+		registered := confluent.RegisteredSchema{Subject: *subject, ID: schemaID, Schema: schema}
+		return out.write(registered, func() {
+			fmt.Printf("schema registered for subject [%s] with id [%d]\n", *subject, schemaID)
+		})
+	case "test":
+		schema, err := readSchemaFile(*subject, *file)
+		if err != nil {
+			return err
+		}
+		compatible, err := admin.TestCompatibility(*subject, *version, schema)
+		if err != nil {
+			return err
+		}
+		err = out.write(compatibilityResult{Subject: *subject, Compatible: compatible}, func() {
+			fmt.Printf("schema compatible with subject [%s] [%t]\n", *subject, compatible)
+		})
+		if err == nil && !compatible {
+			return fmt.Errorf("schema is not compatible with subject [%s]", *subject)
+		}
+		return err
+	case "diff":
+		return diffSchema(admin, out, *subject, *version, *file)
+	case "compatibility":
+		if *level != "" {
+			err = admin.SetCompatibility(*subject, *level)
+			if err != nil {
+				return err
+			}
+		}
+		current, err := admin.GetCompatibility(*subject)
+		if err != nil {
+			return err
+		}
+		return out.write(map[string]string{"subject": *subject, "compatibility": current}, func() {
+			fmt.Println(current)
+		})
+	case "delete":
+		if *subject == "" {
+			return fmt.Errorf("subject is required")
+		}
+		versions, err := admin.DeleteSubject(*subject)
+		if err != nil {
+			return err
+		}
+		return out.write(versions, func() {
+			fmt.Printf("subject [%s] soft deleted versions %v\n", *subject, versions)
+		})
+	}
+	return fmt.Errorf("unknown schema action [%s]", action)
+}
+
+//diffSchema compares the schema file with the registered version, a difference fails the command
+func diffSchema(admin *confluent.SchemaAdmin, out *schemaOutput, subject string, version int, file string) error {
+	local, err := readSchemaFile(subject, file)
+	if err != nil {
+		return err
+	}
+	registered, err := admin.GetSchema(subject, version)
+	if err != nil {
+		return err
+	}
+	registeredSchema, err := confluent.NormalizeSchema(registered.Schema)
+	if err != nil {
+		return err
+	}
+	localSchema, err := confluent.NormalizeSchema(local)
+	if err != nil {
+		return err
+	}
+
+	result := diffResult{Subject: subject, Version: registered.Version, ID: registered.ID, Equal: registeredSchema == localSchema}
+	if !result.Equal {
+		result.Registered = registeredSchema
+		result.Local = localSchema
+	}
+	err = out.write(result, func() {
+		if result.Equal {
+			fmt.Printf("schema equal to subject [%s] version [%d]\n", subject, registered.Version)
+			return
+		}
+		fmt.Printf("--- registered subject [%s] version [%d] id [%d]\n%s\n+++ local [%s]\n%s\n", subject, registered.Version, registered.ID, registeredSchema, file, localSchema)
+	})
+	if err == nil && !result.Equal {
+		return fmt.Errorf("schema differs from subject [%s] version [%d]", subject, registered.Version)
+	}
+	return err
+}
+
+func readSchemaFile(subject string, file string) (string, error) {
+	if subject == "" || file == "" {
+		return "", fmt.Errorf("subject and file are required")
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("cannot read schema file [%s] error [%v]", file, err)
+	}
+	_, err = confluent.NewAvroCodec(string(content))
+	if err != nil {
+		return "", fmt.Errorf("schema file invalid [%s] error [%v]", file, err)
+	}
+	return string(content), nil
+}
+
+//schemaOutput writes results as text or json
+type schemaOutput struct {
+	json bool
+}
+
+func (o *schemaOutput) write(value interface{}, text func()) error {
+	if !o.json {
+		text()
+		return nil
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rbock44/okfw-confluent-go/confluent"
+)
+
+func runTopics(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: okfw-cli topics plan|apply -file <topics.yaml> [flags]")
+	}
+	action := args[0]
+	if action != "plan" && action != "apply" {
+		return fmt.Errorf("unknown topics action [%s]", action)
+	}
+
+	var cluster clusterFlags
+	flags := newFlagSet("topics "+action, &cluster)
+	file := flags.String("file", "", "topic spec file, yaml if ending with .yaml or .yml, json otherwise")
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("file is required")
+	}
+	specs, err := confluent.LoadTopicSpecs(*file)
+	if err != nil {
+		return err
+	}
+	cluster.apply()
+
+	admin, err := confluent.NewFrameworkFactory().NewTopicAdmin()
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cluster.timeout)
+	defer cancel()
+
+	plan, err := admin.PlanTopics(ctx, specs)
+	if err != nil {
+		return err
+	}
+	plan.Write(os.Stdout)
+	if action == "plan" || !plan.HasChanges() && len(plan.Refused) == 0 {
+		return nil
+	}
+	err = admin.ApplyTopicPlan(ctx, plan)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("topic plan applied\n")
+	return nil
+}
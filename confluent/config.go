@@ -0,0 +1,47 @@
+package confluent
+
+import (
+	"sync/atomic"
+	"time"
+
+	schemaregistry "github.com/landoop/schema-registry"
+)
+
+//bootstrapServers is the broker list used by all kafka clients
+var bootstrapServers = "localhost"
+
+//schemaRegistryURL is the url of the schema registry
+var schemaRegistryURL = schemaregistry.DefaultUrl
+
+//statisticsIntervalMs is the interval of the librdkafka statistics, 0 disables the statistics
+var statisticsIntervalMs = 0
+
+//lagCacheTTL is the time the metrics keep the queried consumer lag
+var lagCacheTTL = int64(5 * time.Second)
+
+//SetBootstrapServers sets the broker list used by the kafka clients created afterwards
+func SetBootstrapServers(servers string) {
+	bootstrapServers = servers
+}
+
+//SetSchemaRegistryURL sets the url of the schema registry and drops the current registry client
+func SetSchemaRegistryURL(url string) {
+	schemaClientMutex.Lock()
+	defer schemaClientMutex.Unlock()
+	schemaRegistryURL = url
+	schemaClient = nil
+}
+
+//SetStatisticsInterval enables the librdkafka statistics of the producers and consumers created afterwards, 0 disables them
+func SetStatisticsInterval(interval time.Duration) {
+	statisticsIntervalMs = int(interval / time.Millisecond)
+}
+
+//SetLagCacheTTL sets the time the metrics keep the queried consumer lag before querying the brokers again, 0 queries on every scrape
+func SetLagCacheTTL(ttl time.Duration) {
+	atomic.StoreInt64(&lagCacheTTL, int64(ttl))
+}
+
+func getLagCacheTTL() time.Duration {
+	return time.Duration(atomic.LoadInt64(&lagCacheTTL))
+}
@@ -0,0 +1,44 @@
+package confluent
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rbock44/okfw-confluent-go/confluent/providertest"
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+//TestConformance runs the provider checks against the cluster of OKFW_KAFKA_BROKERS
+//the cluster must create topics automatically, OKFW_SCHEMA_REGISTRY enables the schema checks
+func TestConformance(t *testing.T) {
+	brokers := os.Getenv("OKFW_KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("OKFW_KAFKA_BROKERS not set")
+	}
+	SetBootstrapServers(brokers)
+	registry := os.Getenv("OKFW_SCHEMA_REGISTRY")
+	if registry != "" {
+		SetSchemaRegistryURL(registry)
+	}
+
+	providertest.Run(t, providertest.Config{
+		NewProvider: func(t *testing.T) okfwkafka.Provider {
+			return NewFrameworkFactory()
+		},
+		SkipSchemas: registry == "",
+	})
+}
+
+//TestInvalidArguments expects the argument checks of the conformance suite without a cluster
+func TestInvalidArguments(t *testing.T) {
+	factory := NewFrameworkFactory()
+	if _, err := factory.NewConsumer("topic", "client", nil); err == nil {
+		t.Errorf("consumer without handler without error")
+	}
+	if _, err := factory.NewConsumer("", "client", &nopHandler{}); err == nil {
+		t.Errorf("consumer without topic without error")
+	}
+	if _, err := factory.NewProducer("", "client"); err == nil {
+		t.Errorf("producer without topic without error")
+	}
+}
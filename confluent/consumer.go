@@ -1,8 +1,10 @@
 package confluent
 
 import (
-	"bytes"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
@@ -12,29 +14,51 @@ import (
 type MessageConsumer struct {
 	Topic          string
 	ClientID       string
+	GroupID        string
 	Consumer       *kafka.Consumer
 	FailedCount    int64
 	IgnoredCount   int64
 	DeliveredCount int64
 	Handler        okfwkafka.MessageHandler
+	BacklogTimeout time.Duration
+	lastProcessed  partitionTimestamps
+	probeMutex     sync.Mutex
+	probe          *timestampProbe
+	metrics        atomic.Value
+	stats          statsRecorder
+	events         *eventLogger
+	health         healthState
+	latency        latencyTracker
+	closeOnce      sync.Once
+	closed         int32
 }
 
 func newMessageConsumer(topic string, clientID string, handler okfwkafka.MessageHandler) (*MessageConsumer, error) {
-	kc := MessageConsumer{Topic: topic, ClientID: clientID, Handler: handler}
+	if handler == nil {
+		return nil, fmt.Errorf("consumer message handler missing")
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("consumer topic missing")
+	}
+	kc := MessageConsumer{Topic: topic, ClientID: clientID, GroupID: "segmenter", Handler: handler, BacklogTimeout: defaultBacklogTimeout}
+	kc.events = newEventLogger(clientID)
 
 	var err error
 	kc.Consumer, err = kafka.NewConsumer(
 		&kafka.ConfigMap{
-			"bootstrap.servers":  "localhost",
-			"group.id":           "segmenter",
-			"session.timeout.ms": 6000,
-			"auto.offset.reset":  "earliest",
+			"bootstrap.servers":      bootstrapServers,
+			"group.id":               kc.GroupID,
+			"session.timeout.ms":     6000,
+			"auto.offset.reset":      "earliest",
+			"statistics.interval.ms": statisticsIntervalMs,
+			"go.logs.channel.enable": true,
 		})
 	if err != nil {
 		return nil, fmt.Errorf("cannot create kafka consumer error [%#v]", err)
 	}
+	go kc.events.forwardLogs(kc.Consumer.Logs())
 
-	err = kc.Consumer.Subscribe(kc.Topic, nil)
+	err = kc.Consumer.Subscribe(kc.Topic, kc.rebalanced)
 	if err != nil {
 		return nil, fmt.Errorf("cannot subcribe to topic [%s] error [%#v]", kc.Topic, err)
 	}
@@ -44,38 +68,123 @@ func newMessageConsumer(topic string, clientID string, handler okfwkafka.Message
 
 //Process poll the consumer and call the message handler
 func (kc *MessageConsumer) Process(timeoutMs int) error {
+	if atomic.LoadInt32(&kc.closed) == 1 {
+		return fmt.Errorf("consumer closed [%s]", kc.ClientID)
+	}
 	ev := kc.Consumer.Poll(timeoutMs)
+	kc.health.polled(time.Now())
 	switch e := ev.(type) {
 	case *kafka.Message:
+		kc.health.succeeded(time.Now())
 		kc.DeliveredCount++
-		keyBuffer := &bytes.Buffer{}
-		keyBuffer.Write(e.Key)
-		valueBuffer := &bytes.Buffer{}
-		valueBuffer.Write(e.Value)
-		context := &okfwkafka.MessageContext{
-			Timestamp: e.Timestamp,
-		}
-		kc.Handler.Handle(context, keyBuffer.Bytes(), valueBuffer.Bytes())
+		kc.handleMessage(e)
 		return nil
 	case kafka.Error:
 		kc.FailedCount++
+		kc.events.logEvent(e)
+		kc.health.failed(time.Now(), e)
+		if metrics := kc.getMetrics(); metrics != nil {
+			metrics.pollError(kc)
+		}
 		return fmt.Errorf("consumer poll error [%#v]", e)
+	case *kafka.Stats:
+		stats := kc.stats.handle(e.String())
+		kc.events.logThrottle(stats)
+		kc.health.statsReceived(stats)
+		return nil
 	case nil:
 		//polling just indicated that there is no message
 		return nil
 	default:
-		//other kafka message types are ignored
+		//other kafka message types are only logged
+		kc.events.logEvent(ev)
 		kc.IgnoredCount++
 		return nil
 	}
 }
 
+//rebalanced logs the partition assignment, librdkafka assigns the partitions itself as the callback does not assign
+func (kc *MessageConsumer) rebalanced(consumer *kafka.Consumer, event kafka.Event) error {
+	kc.events.logEvent(event)
+	switch e := event.(type) {
+	case kafka.AssignedPartitions:
+		kc.health.assignedPartitions(len(e.Partitions))
+	case kafka.RevokedPartitions:
+		kc.health.assignedPartitions(0)
+		kc.lastProcessed.remove(e.Partitions)
+	}
+	return nil
+}
+
+//handleMessage passes a copy of key and value to the handler, a nil value marks a tombstone
+func (kc *MessageConsumer) handleMessage(m *kafka.Message) {
+	received := time.Now()
+	key := copyBytes(m.Key)
+	value := copyBytes(m.Value)
+	context := &MessageContext{
+		MessageContext: okfwkafka.MessageContext{
+			Timestamp: m.Timestamp,
+		},
+		Partition:    m.TopicPartition.Partition,
+		Offset:       int64(m.TopicPartition.Offset),
+		Tombstone:    IsTombstone(m.Value),
+		TraceContext: extractTraceContext(m.Headers),
+	}
+	if m.TopicPartition.Topic != nil {
+		context.Topic = *m.TopicPartition.Topic
+	}
+
+	span := startConsumerSpan(context, kc.ClientID, kc.GroupID)
+	if handler, ok := kc.Handler.(MessageContextHandler); ok {
+		handler.HandleMessage(context, key, value)
+	} else {
+		kc.Handler.Handle(&context.MessageContext, key, value)
+	}
+	if span != nil {
+		span.End()
+	}
+	handled := time.Now()
+
+	//messages without timestamp do not count for the time lag and the end to end latency
+	timestamp := m.Timestamp
+	if m.TimestampType == kafka.TimestampNotAvailable {
+		timestamp = time.Time{}
+	} else {
+		kc.lastProcessed.set(context.Topic, context.Partition, timestamp)
+	}
+	endToEnd, ok := kc.latency.record(context.Topic, context.Partition, timestamp, received, handled)
+	if metrics := kc.getMetrics(); metrics != nil {
+		metrics.consumed(kc, context.Topic)
+		metrics.consumerLatency(kc, context.Topic, endToEnd, ok, handled.Sub(received))
+	}
+}
+
+//copyBytes copies the buffer and keeps nil to distinguish tombstones from empty values
+func copyBytes(buffer []byte) []byte {
+	if buffer == nil {
+		return nil
+	}
+	copied := make([]byte, len(buffer))
+	copy(copied, buffer)
+	return copied
+}
+
 //GetMessageCounter get the message counter
 func (kc *MessageConsumer) GetMessageCounter() *int64 {
 	return &kc.DeliveredCount
 }
 
-//Close close the consumer
+//Close close the consumer, closing again has no effect
 func (kc *MessageConsumer) Close() {
-	kc.Consumer.Close()
+	kc.closeOnce.Do(func() {
+		atomic.StoreInt32(&kc.closed, 1)
+		kc.Consumer.Close()
+		kc.health.close()
+		kc.probeMutex.Lock()
+		defer kc.probeMutex.Unlock()
+		if kc.probe != nil {
+			kc.probe.close()
+			kc.probe = nil
+		}
+	})
 }
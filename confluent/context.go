@@ -0,0 +1,26 @@
+package confluent
+
+import (
+	"context"
+
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+//MessageContext extends the okfw message context with the confluent message details
+type MessageContext struct {
+	okfwkafka.MessageContext
+	Topic     string
+	Partition int32
+	Offset    int64
+	Tombstone bool
+	//TraceContext is the trace context extracted from the message headers
+	TraceContext SpanContext
+	//Context carries the consumer span if a tracer is set
+	Context context.Context
+}
+
+//MessageContextHandler is implemented by message handlers that need the confluent message context
+//the consumer calls HandleMessage instead of Handle for such handlers
+type MessageContextHandler interface {
+	HandleMessage(context *MessageContext, key []byte, value []byte)
+}
@@ -19,6 +19,41 @@ func (p *FrameworkFactory) NewProducer(topic string, clientID string) (kafka.Mes
 	return newMessageProducer(topic, clientID)
 }
 
+//NewTopicProducer creates a new confluent producer that sends to any topic
+func (p *FrameworkFactory) NewTopicProducer(clientID string) (*TopicProducer, error) {
+	return newTopicProducer(clientID)
+}
+
+//NewTopicAdmin creates a new confluent admin client for topics and configs
+func (p *FrameworkFactory) NewTopicAdmin() (*TopicAdmin, error) {
+	return newTopicAdmin()
+}
+
+//NewLagInspector creates a lag inspector for the consumer group
+func (p *FrameworkFactory) NewLagInspector(groupID string) (*LagInspector, error) {
+	return newLagInspector(groupID)
+}
+
+//NewOffsetManager creates an offset manager for the consumer group
+func (p *FrameworkFactory) NewOffsetManager(groupID string) (*OffsetManager, error) {
+	return newOffsetManager(groupID)
+}
+
+//NewTopicReader creates a reader for the partitions of the topic starting at the offset, no partitions means all partitions
+func (p *FrameworkFactory) NewTopicReader(topic string, clientID string, partitions []int32, offset int64) (*TopicReader, error) {
+	return newTopicReader(topic, clientID, partitions, offset)
+}
+
+//NewSchemaCodec creates a codec for the confluent wire format with the schemas of the registry
+func (p *FrameworkFactory) NewSchemaCodec() *SchemaCodec {
+	return newSchemaCodec()
+}
+
+//NewSchemaAdmin creates an admin client for subjects, schemas and compatibility levels of the schema registry
+func (p *FrameworkFactory) NewSchemaAdmin() *SchemaAdmin {
+	return newSchemaAdmin()
+}
+
 //NewSchemaResolver creates a new registry
 func (p *FrameworkFactory) NewSchemaResolver() (kafka.SchemaResolver, error) {
 	_, err := getKafkaSchemaClient().Subjects()
@@ -1,11 +1,14 @@
 module github.com/rbock44/okfw-confluent-go/confluent
 
 require (
-	github.com/confluentinc/confluent-kafka-go v0.11.6
+	github.com/confluentinc/confluent-kafka-go v1.9.2
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang/mock v1.2.0
+	github.com/golang/snappy v0.0.1 // indirect
 	github.com/landoop/schema-registry v0.0.0-20181115093143-9861c67a815b
+	github.com/linkedin/goavro/v2 v2.9.7
 	github.com/rbock44/okfw-kafka-go/kafka v0.0.0-20190327105815-6b4e3eb82dff
 	github.com/rbock44/okfw-logapi-go v0.0.0-20190326141108-b9175eb2e46e
 	github.com/stretchr/objx v0.1.1 // indirect
+	gopkg.in/yaml.v2 v2.2.2
 )
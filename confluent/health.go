@@ -0,0 +1,394 @@
+package confluent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//maxHealthErrors is the number of recent errors kept per client
+const maxHealthErrors = 10
+
+//HealthPolicy holds the thresholds of the health checks, a zero threshold disables its check
+type HealthPolicy struct {
+	//MaxPollInterval is the time a consumer may not call Process before it is not live
+	MaxPollInterval time.Duration
+	//MaxDeliveryInterval is the time a producer with messages in flight may get no delivery report before it is not live
+	MaxDeliveryInterval time.Duration
+	//ErrorWindow is the time a fatal client error makes the client not ready
+	ErrorWindow time.Duration
+	//MaxLag is the total consumer lag above which a consumer is not ready
+	MaxLag int64
+	//RequireAssignment makes a consumer without assigned partitions not ready
+	RequireAssignment bool
+	//Timeout limits the lag and connection queries of the readiness check
+	Timeout time.Duration
+}
+
+//DefaultHealthPolicy is the policy of NewHealth, the delivery interval exceeds the default librdkafka message timeout
+var DefaultHealthPolicy = HealthPolicy{
+	MaxPollInterval:     time.Minute,
+	MaxDeliveryInterval: 10 * time.Minute,
+	ErrorWindow:         time.Minute,
+	Timeout:             5 * time.Second,
+}
+
+//HealthError is a recent error of a client
+type HealthError struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+	Fatal bool      `json:"fatal"`
+}
+
+//ClientHealth is the health of a producer or consumer
+//LastActivity is the last poll of a consumer or the last delivery report of a producer,
+//LastSuccess is the last consumed or delivered message
+type ClientHealth struct {
+	ClientID           string        `json:"client_id"`
+	Type               string        `json:"type"`
+	Topic              string        `json:"topic,omitempty"`
+	Live               bool          `json:"live"`
+	Ready              bool          `json:"ready"`
+	Connected          bool          `json:"connected"`
+	AssignedPartitions int           `json:"assigned_partitions"`
+	InFlight           int64         `json:"in_flight"`
+	Lag                int64         `json:"lag"`
+	LastActivity       time.Time     `json:"last_activity"`
+	LastSuccess        time.Time     `json:"last_success"`
+	IdleSeconds        float64       `json:"idle_seconds"`
+	Errors             []HealthError `json:"errors,omitempty"`
+	Problems           []string      `json:"problems,omitempty"`
+}
+
+//HealthReport is the health of all registered clients, the service is live or ready if all clients are
+type HealthReport struct {
+	Live    bool           `json:"live"`
+	Ready   bool           `json:"ready"`
+	Clients []ClientHealth `json:"clients"`
+}
+
+//Health checks the liveness and readiness of the registered producers and consumers
+type Health struct {
+	Policy HealthPolicy
+	mutex  sync.Mutex
+	checks []healthCheck
+}
+
+//healthCheck evaluates a client, the readiness check queries the brokers
+type healthCheck func(ctx context.Context, policy HealthPolicy, now time.Time, readiness bool) ClientHealth
+
+//NewHealth creates the health checks with the default policy
+func NewHealth() *Health {
+	return &Health{Policy: DefaultHealthPolicy}
+}
+
+//RegisterProducer adds the producer to the health checks
+func (h *Health) RegisterProducer(tp *TopicProducer) {
+	h.registerProducer(tp, func(ctx context.Context) error {
+		_, err := getClusterMetadata(ctx, tp.Producer)
+		return err
+	})
+}
+
+func (h *Health) registerProducer(tp *TopicProducer, probe func(ctx context.Context) error) {
+	tp.health.start(time.Now())
+	h.addCheck(func(ctx context.Context, policy HealthPolicy, now time.Time, readiness bool) ClientHealth {
+		health := ClientHealth{ClientID: tp.ClientID, Type: "producer", InFlight: tp.GetInFlightCount()}
+		pendingSince := tp.health.evaluate(&health, policy, now)
+		if policy.MaxDeliveryInterval > 0 && health.InFlight > 0 {
+			since := health.LastActivity
+			if pendingSince.After(since) {
+				since = pendingSince
+			}
+			if now.Sub(since) > policy.MaxDeliveryInterval {
+				health.notLive(fmt.Sprintf("no delivery report for [%s] with [%d] messages in flight", now.Sub(since), health.InFlight))
+			}
+		}
+		if readiness {
+			tp.health.probeConnection(ctx, &health, probe)
+		}
+		return health
+	})
+}
+
+//RegisterConsumer adds the consumer to the health checks
+func (h *Health) RegisterConsumer(kc *MessageConsumer) {
+	h.registerConsumer(kc, kc.GetBacklogReport, func(ctx context.Context) error {
+		_, err := getClusterMetadata(ctx, kc.Consumer, kc.Topic)
+		return err
+	})
+}
+
+func (h *Health) registerConsumer(kc *MessageConsumer, backlog func(ctx context.Context) (*BacklogReport, error), probe func(ctx context.Context) error) {
+	kc.health.start(time.Now())
+	h.addCheck(func(ctx context.Context, policy HealthPolicy, now time.Time, readiness bool) ClientHealth {
+		health := ClientHealth{ClientID: kc.ClientID, Type: "consumer", Topic: kc.Topic}
+		kc.health.evaluate(&health, policy, now)
+		if policy.MaxPollInterval > 0 && now.Sub(health.LastActivity) > policy.MaxPollInterval {
+			health.notLive(fmt.Sprintf("not polled for [%s]", now.Sub(health.LastActivity)))
+		}
+		if !readiness {
+			return health
+		}
+		kc.health.probeConnection(ctx, &health, probe)
+		if policy.RequireAssignment && health.AssignedPartitions == 0 {
+			health.notReady("no partitions assigned")
+		}
+		if policy.MaxLag > 0 {
+			report, err := backlog(ctx)
+			if err == nil {
+				err = report.FirstError()
+			}
+			if err != nil {
+				health.notReady(fmt.Sprintf("cannot query lag error [%v]", err))
+			} else {
+				health.Lag = report.Total
+				if health.Lag > policy.MaxLag {
+					health.notReady(fmt.Sprintf("lag [%d] exceeds [%d]", health.Lag, policy.MaxLag))
+				}
+			}
+		}
+		return health
+	})
+}
+
+func (h *Health) addCheck(check healthCheck) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.checks = append(h.checks, check)
+}
+
+//Check evaluates liveness and readiness of all clients, lag and connection are queried until the context or the policy timeout is done
+func (h *Health) Check(ctx context.Context) *HealthReport {
+	return h.check(ctx, true)
+}
+
+//CheckLiveness evaluates only the liveness of all clients without querying the brokers, the report is never ready
+func (h *Health) CheckLiveness() *HealthReport {
+	return h.check(context.Background(), false)
+}
+
+func (h *Health) check(ctx context.Context, readiness bool) *HealthReport {
+	h.mutex.Lock()
+	checks := append([]healthCheck{}, h.checks...)
+	policy := h.Policy
+	h.mutex.Unlock()
+
+	if policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		defer cancel()
+	}
+
+	now := time.Now()
+	report := &HealthReport{Live: true, Ready: readiness, Clients: []ClientHealth{}}
+	for _, check := range checks {
+		health := check(ctx, policy, now, readiness)
+		report.Live = report.Live && health.Live
+		report.Ready = report.Ready && health.Ready
+		report.Clients = append(report.Clients, health)
+	}
+	return report
+}
+
+//LivenessHandler serves the liveness report as json with status 200 if live and 503 otherwise
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.CheckLiveness()
+		writeHealthReport(w, report, report.Live)
+	})
+}
+
+//ReadinessHandler serves the readiness report as json with status 200 if ready and 503 otherwise
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Check(r.Context())
+		writeHealthReport(w, report, report.Ready)
+	})
+}
+
+func writeHealthReport(w http.ResponseWriter, report *HealthReport, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func (c *ClientHealth) notLive(problem string) {
+	c.Live = false
+	c.notReady(problem)
+}
+
+func (c *ClientHealth) notReady(problem string) {
+	c.Ready = false
+	c.Problems = append(c.Problems, problem)
+}
+
+//healthState tracks the client events the health checks are based on
+type healthState struct {
+	mutex        sync.Mutex
+	started      time.Time
+	closed       bool
+	connected    bool
+	assigned     int
+	lastActivity time.Time
+	lastSuccess  time.Time
+	pendingSince time.Time
+	errors       []HealthError
+}
+
+func (s *healthState) start(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.started.IsZero() {
+		s.started = now
+	}
+}
+
+//polled records a returned consumer poll
+func (s *healthState) polled(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastActivity = now
+}
+
+//succeeded records a consumed or delivered message
+func (s *healthState) succeeded(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.connected = true
+	s.lastActivity = now
+	s.lastSuccess = now
+}
+
+//pending records the first message in flight of a producer without messages in flight
+func (s *healthState) pending(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pendingSince = now
+}
+
+//delivered records a delivery report
+func (s *healthState) delivered(now time.Time, err error) {
+	if err == nil {
+		s.succeeded(now)
+		return
+	}
+	s.mutex.Lock()
+	s.lastActivity = now
+	s.mutex.Unlock()
+	s.failed(now, err)
+}
+
+//assignedPartitions records the partition count of a rebalance
+func (s *healthState) assignedPartitions(count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.connected = true
+	s.assigned = count
+}
+
+//failed records a client error, all brokers down marks the client disconnected
+func (s *healthState) failed(now time.Time, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	healthError := HealthError{Time: now, Error: err.Error()}
+	if kafkaErr, ok := err.(kafka.Error); ok {
+		healthError.Fatal = isFatalError(kafkaErr)
+		if kafkaErr.Code() == kafka.ErrAllBrokersDown {
+			s.connected = false
+		}
+	}
+	s.errors = append(s.errors, healthError)
+	if len(s.errors) > maxHealthErrors {
+		s.errors = s.errors[len(s.errors)-maxHealthErrors:]
+	}
+}
+
+//statsReceived takes the connection state from the broker states of the statistics
+func (s *healthState) statsReceived(stats *ClientStats) {
+	if stats == nil || len(stats.Brokers) == 0 {
+		return
+	}
+	up := false
+	for _, broker := range stats.Brokers {
+		up = up || broker.State == "UP"
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.connected = up
+}
+
+func (s *healthState) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+}
+
+//evaluate fills the tracked state into the health and returns the time the producer got messages in flight
+func (s *healthState) evaluate(health *ClientHealth, policy HealthPolicy, now time.Time) time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	health.Live = !s.closed
+	health.Ready = health.Live
+	health.Connected = s.connected
+	health.AssignedPartitions = s.assigned
+	health.LastActivity = s.lastActivity
+	if health.LastActivity.IsZero() {
+		health.LastActivity = s.started
+	}
+	health.LastSuccess = s.lastSuccess
+	idleSince := s.lastSuccess
+	if idleSince.IsZero() {
+		idleSince = s.started
+	}
+	health.IdleSeconds = now.Sub(idleSince).Seconds()
+	health.Errors = append([]HealthError{}, s.errors...)
+	if s.closed {
+		health.Problems = append(health.Problems, "closed")
+	}
+	for _, err := range s.errors {
+		if err.Fatal && policy.ErrorWindow > 0 && now.Sub(err.Time) <= policy.ErrorWindow {
+			health.notReady(fmt.Sprintf("fatal error [%s]", err.Error))
+			break
+		}
+	}
+	return s.pendingSince
+}
+
+//probeConnection queries the metadata if no broker connection was seen yet
+func (s *healthState) probeConnection(ctx context.Context, health *ClientHealth, probe func(ctx context.Context) error) {
+	s.mutex.Lock()
+	closed := s.closed
+	s.mutex.Unlock()
+	if !health.Connected && !closed {
+		err := probe(ctx)
+		if err == nil {
+			s.mutex.Lock()
+			s.connected = true
+			s.mutex.Unlock()
+			health.Connected = true
+		}
+	}
+	if !health.Connected {
+		health.notReady("not connected to the brokers")
+	}
+}
+
+//isFatalError returns true for client errors that will not heal without intervention
+func isFatalError(err kafka.Error) bool {
+	switch err.Code() {
+	case kafka.ErrAllBrokersDown, kafka.ErrAuthentication, kafka.ErrSsl, kafka.ErrCritSysResource, kafka.ErrInvalidArg,
+		kafka.ErrTopicAuthorizationFailed, kafka.ErrGroupAuthorizationFailed:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package confluent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func connectedProbe(ctx context.Context) error {
+	return nil
+}
+
+func failingProbe(ctx context.Context) error {
+	return fmt.Errorf("brokers not reachable")
+}
+
+func backlogOf(total int64) func(ctx context.Context) (*BacklogReport, error) {
+	return func(ctx context.Context) (*BacklogReport, error) {
+		return &BacklogReport{Total: total}, nil
+	}
+}
+
+func expectHealth(t *testing.T, name string, report *HealthReport, live bool, ready bool, problem string) {
+	if report.Live != live || report.Ready != ready {
+		t.Errorf("[%s] expected live [%t] ready [%t] but was %+v", name, live, ready, report)
+	}
+	if problem == "" {
+		return
+	}
+	for _, client := range report.Clients {
+		for _, p := range client.Problems {
+			if strings.Contains(p, problem) {
+				return
+			}
+		}
+	}
+	t.Errorf("[%s] expected problem [%s] but was %+v", name, problem, report.Clients)
+}
+
+func TestHealthConsumerPollInterval(t *testing.T) {
+	h := &Health{Policy: HealthPolicy{MaxPollInterval: time.Minute}}
+	kc := &MessageConsumer{ClientID: "consumer", Topic: "orders"}
+	h.registerConsumer(kc, backlogOf(0), connectedProbe)
+
+	expectHealth(t, "started", h.Check(context.Background()), true, true, "")
+
+	kc.health.polled(time.Now().Add(-2 * time.Minute))
+	expectHealth(t, "not polled", h.Check(context.Background()), false, false, "not polled")
+
+	kc.health.polled(time.Now())
+	expectHealth(t, "polled", h.CheckLiveness(), true, false, "")
+	expectHealth(t, "polled", h.Check(context.Background()), true, true, "")
+}
+
+func TestHealthProducerDeliveryInterval(t *testing.T) {
+	h := &Health{Policy: HealthPolicy{MaxDeliveryInterval: time.Minute}}
+	tp := &TopicProducer{ClientID: "producer"}
+	h.registerProducer(tp, connectedProbe)
+
+	//an idle producer without messages in flight stays live
+	tp.health.started = time.Now().Add(-time.Hour)
+	expectHealth(t, "idle", h.Check(context.Background()), true, true, "")
+
+	tp.MessageCount = 2
+	tp.health.pending(time.Now().Add(-2 * time.Minute))
+	expectHealth(t, "no delivery", h.Check(context.Background()), false, false, "no delivery report")
+
+	tp.health.delivered(time.Now(), nil)
+	expectHealth(t, "delivered", h.Check(context.Background()), true, true, "")
+}
+
+func TestHealthErrorWindow(t *testing.T) {
+	h := &Health{Policy: HealthPolicy{ErrorWindow: time.Minute}}
+	kc := &MessageConsumer{ClientID: "consumer"}
+	h.registerConsumer(kc, backlogOf(0), connectedProbe)
+
+	kc.health.failed(time.Now(), fmt.Errorf("transient"))
+	expectHealth(t, "not fatal", h.Check(context.Background()), true, true, "")
+
+	kc.health.errors = append(kc.health.errors, HealthError{Time: time.Now(), Error: "authentication", Fatal: true})
+	report := h.Check(context.Background())
+	expectHealth(t, "fatal", report, true, false, "fatal error [authentication]")
+	if len(report.Clients[0].Errors) != 2 {
+		t.Errorf("expected [2] recent errors but was %v", report.Clients[0].Errors)
+	}
+
+	kc.health.errors[1].Time = time.Now().Add(-2 * time.Minute)
+	expectHealth(t, "fatal outside window", h.Check(context.Background()), true, true, "")
+}
+
+func TestHealthErrorsLimited(t *testing.T) {
+	var state healthState
+	for i := 0; i < maxHealthErrors+5; i++ {
+		state.failed(time.Now(), fmt.Errorf("error %d", i))
+	}
+	if len(state.errors) != maxHealthErrors || state.errors[0].Error != "error 5" {
+		t.Errorf("expected the last [%d] errors but was %v", maxHealthErrors, state.errors)
+	}
+}
+
+func TestHealthConsumerLag(t *testing.T) {
+	lag := int64(50)
+	backlog := func(ctx context.Context) (*BacklogReport, error) {
+		if lag < 0 {
+			return nil, fmt.Errorf("lag query failed")
+		}
+		return &BacklogReport{Total: lag}, nil
+	}
+	h := &Health{Policy: HealthPolicy{MaxLag: 100}}
+	kc := &MessageConsumer{ClientID: "consumer"}
+	h.registerConsumer(kc, backlog, connectedProbe)
+
+	report := h.Check(context.Background())
+	expectHealth(t, "lag below", report, true, true, "")
+	if report.Clients[0].Lag != 50 {
+		t.Errorf("expected lag [50] but was [%d]", report.Clients[0].Lag)
+	}
+
+	lag = 150
+	expectHealth(t, "lag above", h.Check(context.Background()), true, false, "lag [150] exceeds [100]")
+
+	lag = -1
+	expectHealth(t, "lag failed", h.Check(context.Background()), true, false, "cannot query lag")
+
+	//liveness does not query the lag
+	expectHealth(t, "liveness", h.CheckLiveness(), true, false, "")
+}
+
+func TestHealthConnectionAndAssignment(t *testing.T) {
+	h := &Health{Policy: HealthPolicy{RequireAssignment: true}}
+	kc := &MessageConsumer{ClientID: "consumer"}
+	h.registerConsumer(kc, backlogOf(0), failingProbe)
+
+	report := h.Check(context.Background())
+	expectHealth(t, "not connected", report, true, false, "not connected")
+	expectHealth(t, "not connected", report, true, false, "no partitions assigned")
+
+	kc.health.assignedPartitions(3)
+	report = h.Check(context.Background())
+	expectHealth(t, "assigned", report, true, true, "")
+	if !report.Clients[0].Connected || report.Clients[0].AssignedPartitions != 3 {
+		t.Errorf("expected connected with [3] partitions but was %+v", report.Clients[0])
+	}
+
+	kc.health.statsReceived(&ClientStats{Brokers: map[string]BrokerStats{"kafka:9092": {State: "DOWN"}}})
+	expectHealth(t, "brokers down", h.Check(context.Background()), true, false, "not connected")
+}
+
+func TestHealthClosed(t *testing.T) {
+	h := &Health{Policy: DefaultHealthPolicy}
+	tp := &TopicProducer{ClientID: "producer"}
+	kc := &MessageConsumer{ClientID: "consumer"}
+	h.registerProducer(tp, connectedProbe)
+	h.registerConsumer(kc, backlogOf(0), connectedProbe)
+	expectHealth(t, "open", h.Check(context.Background()), true, true, "")
+
+	kc.health.close()
+	report := h.Check(context.Background())
+	expectHealth(t, "closed", report, false, false, "closed")
+	if !report.Clients[0].Live || report.Clients[1].Live {
+		t.Errorf("expected only the consumer not live but was %+v", report.Clients)
+	}
+}
+
+func TestHealthHandlers(t *testing.T) {
+	h := &Health{Policy: HealthPolicy{MaxLag: 100}}
+	lag := int64(0)
+	kc := &MessageConsumer{ClientID: "consumer", Topic: "orders"}
+	h.registerConsumer(kc, func(ctx context.Context) (*BacklogReport, error) {
+		return &BacklogReport{Total: lag}, nil
+	}, connectedProbe)
+
+	serve := func(handler http.Handler) (int, HealthReport) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+		var report HealthReport
+		err := json.Unmarshal(recorder.Body.Bytes(), &report)
+		if err != nil {
+			t.Errorf("cannot decode health report [%s] error [%v]", recorder.Body.String(), err)
+		}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("expected json content type but was [%s]", contentType)
+		}
+		return recorder.Code, report
+	}
+
+	if code, report := serve(h.ReadinessHandler()); code != http.StatusOK || !report.Ready || len(report.Clients) != 1 {
+		t.Errorf("ready expected [200] but was [%d] %+v", code, report)
+	}
+	if code, _ := serve(h.LivenessHandler()); code != http.StatusOK {
+		t.Errorf("live expected [200] but was [%d]", code)
+	}
+
+	lag = 200
+	if code, report := serve(h.ReadinessHandler()); code != http.StatusServiceUnavailable || report.Ready {
+		t.Errorf("not ready expected [503] but was [%d] %+v", code, report)
+	}
+	if code, _ := serve(h.LivenessHandler()); code != http.StatusOK {
+		t.Errorf("live with lag expected [200] but was [%d]", code)
+	}
+
+	kc.health.close()
+	if code, report := serve(h.LivenessHandler()); code != http.StatusServiceUnavailable || report.Live {
+		t.Errorf("closed expected [503] but was [%d] %+v", code, report)
+	}
+}
@@ -0,0 +1,98 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//LagInspector reads the committed offsets of a consumer group without joining the group
+type LagInspector struct {
+	GroupID  string
+	Consumer *kafka.Consumer
+	Timeout  time.Duration
+	client   lagClient
+}
+
+//lagClient is implemented by the kafka consumer, replaced in tests
+type lagClient interface {
+	metadataClient
+	watermarkClient
+	Committed(partitions []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error)
+}
+
+func newLagInspector(groupID string) (*LagInspector, error) {
+	consumer, err := kafka.NewConsumer(
+		&kafka.ConfigMap{
+			"bootstrap.servers":      bootstrapServers,
+			"group.id":               groupID,
+			"enable.auto.commit":     false,
+			"go.logs.channel.enable": true,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create kafka consumer error [%#v]", err)
+	}
+	go newEventLogger(groupID + "-lag").forwardLogs(consumer.Logs())
+	return &LagInspector{
+		GroupID:  groupID,
+		Consumer: consumer,
+		Timeout:  defaultBacklogTimeout,
+	}, nil
+}
+
+//GetLag returns the lag of the group for all partitions of the topics
+func (l *LagInspector) GetLag(ctx context.Context, topics ...string) (*BacklogReport, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("no topics given for group [%s]", l.GroupID)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+
+	client := l.getClient()
+	toppars, err := topicPartitions(ctx, client, topics)
+	if err != nil {
+		return nil, err
+	}
+	toppars, err = client.Committed(toppars, remainingMs(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("cannot get committed offsets of group [%s] error [%v]", l.GroupID, err)
+	}
+
+	return queryBacklog(ctx, client, toppars), nil
+}
+
+func (l *LagInspector) getClient() lagClient {
+	if l.client != nil {
+		return l.client
+	}
+	return l.Consumer
+}
+
+//topicPartitions returns all partitions of the topics from the cluster metadata
+func topicPartitions(ctx context.Context, client metadataClient, topics []string) ([]kafka.TopicPartition, error) {
+	var toppars []kafka.TopicPartition
+	for _, topic := range topics {
+		metadata, err := getClusterMetadata(ctx, client, topic)
+		if err != nil {
+			return nil, err
+		}
+		info := metadata.Topics[topic]
+		if info.Error != nil {
+			return nil, fmt.Errorf("topic [%s] metadata error [%v]", topic, info.Error)
+		}
+		for _, partition := range info.Partitions {
+			toppars = append(toppars, kafka.TopicPartition{Topic: &info.Topic, Partition: partition.ID})
+		}
+	}
+	return toppars, nil
+}
+
+//Close closes the consumer without committing offsets
+func (l *LagInspector) Close() {
+	l.Consumer.Close()
+}
@@ -0,0 +1,97 @@
+package confluent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//fakeLagClient combines the fake metadata and watermark clients with the committed offsets of a group
+type fakeLagClient struct {
+	fakeMetadataClient
+	fakeWatermarkClient
+	committed    map[PartitionRef]kafka.Offset
+	committedErr error
+	requested    []kafka.TopicPartition
+}
+
+func (c *fakeLagClient) Committed(partitions []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error) {
+	c.requested = partitions
+	if c.committedErr != nil {
+		return nil, c.committedErr
+	}
+	var result []kafka.TopicPartition
+	for _, partition := range partitions {
+		offset, ok := c.committed[PartitionRef{Topic: *partition.Topic, Partition: partition.Partition}]
+		if !ok {
+			offset = kafka.OffsetInvalid
+		}
+		partition.Offset = offset
+		result = append(result, partition)
+	}
+	return result, nil
+}
+
+func newFakeLagClient() *fakeLagClient {
+	client := &fakeLagClient{committed: map[PartitionRef]kafka.Offset{{"orders", 0}: 8}}
+	client.metadata = testKafkaMetadata()
+	client.metadata.Topics["orders"] = kafka.TopicMetadata{Topic: "orders", Partitions: []kafka.PartitionMetadata{{ID: 0}, {ID: 1}}}
+	client.partitions = map[PartitionRef]watermarks{
+		{"orders", 0}: {low: 0, high: 10},
+		{"orders", 1}: {low: 2, high: 5},
+	}
+	return client
+}
+
+func TestLagInspector(t *testing.T) {
+	client := newFakeLagClient()
+	inspector := &LagInspector{GroupID: "billing", Timeout: time.Second, client: client}
+
+	report, err := inspector.GetLag(context.Background(), "orders")
+	if err != nil {
+		t.Fatalf("cannot get lag error [%v]", err)
+	}
+	//all partitions of the topic are inspected, partitions without commit count from the low watermark
+	if len(client.requested) != 2 || len(report.Partitions) != 2 || report.Total != 5 {
+		t.Fatalf("expected [2] partitions with lag [5] but was %+v", report)
+	}
+	if first := report.Partitions[0]; first.Committed != 8 || first.Lag != 2 {
+		t.Errorf("partition [0] expected committed [8] and lag [2] but was %+v", first)
+	}
+	if second := report.Partitions[1]; second.Committed != int64(kafka.OffsetInvalid) || second.Lag != 3 {
+		t.Errorf("partition [1] without commit expected lag [3] but was %+v", second)
+	}
+	//the timeout of the inspector limits queries without deadline
+	if client.timeoutMs <= 0 || client.timeoutMs > 1000 {
+		t.Errorf("metadata timeout expected from the inspector timeout but was [%d]", client.timeoutMs)
+	}
+}
+
+func TestLagInspectorErrors(t *testing.T) {
+	inspector := &LagInspector{GroupID: "billing", Timeout: time.Second, client: newFakeLagClient()}
+	if _, err := inspector.GetLag(context.Background()); err == nil {
+		t.Errorf("missing topics expected error")
+	}
+	_, err := inspector.GetLag(context.Background(), "orders", "missing")
+	if err == nil || !strings.Contains(err.Error(), "topic [missing] metadata error") {
+		t.Errorf("unknown topic expected metadata error but was [%v]", err)
+	}
+
+	client := newFakeLagClient()
+	client.committedErr = kafka.NewError(kafka.ErrCoordinatorNotAvailable, "Broker: Coordinator not available", false)
+	inspector.client = client
+	_, err = inspector.GetLag(context.Background(), "orders")
+	if err == nil || !strings.Contains(err.Error(), "committed offsets of group [billing]") {
+		t.Errorf("committed offsets error expected but was [%v]", err)
+	}
+
+	client = newFakeLagClient()
+	client.fakeMetadataClient.err = kafka.NewError(kafka.ErrTransport, "Local: Broker transport failure", false)
+	inspector.client = client
+	if _, err = inspector.GetLag(context.Background(), "orders"); err == nil {
+		t.Errorf("metadata query error expected")
+	}
+}
@@ -0,0 +1,269 @@
+package confluent
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	//latencyBucketBase is the upper bound of the first latency bucket
+	latencyBucketBase = 100 * time.Microsecond
+	//latencyBucketCount buckets grow by a quarter power of two and reach beyond one day
+	latencyBucketCount = 120
+)
+
+//latencyBucketBounds are the upper bounds of the latency buckets, the last bucket has no bound
+var latencyBucketBounds = func() [latencyBucketCount]time.Duration {
+	var bounds [latencyBucketCount]time.Duration
+	for i := range bounds {
+		bounds[i] = time.Duration(float64(latencyBucketBase) * math.Pow(2, float64(i)/4))
+	}
+	return bounds
+}()
+
+//LatencyHistogram counts latencies in exponential buckets, percentiles are estimated within about 20 percent
+type LatencyHistogram struct {
+	Buckets [latencyBucketCount + 1]uint64
+	Count   uint64
+	Sum     time.Duration
+	Min     time.Duration
+	Max     time.Duration
+}
+
+//Observe adds the latency, negative latencies from clock skew are counted as zero
+func (h *LatencyHistogram) Observe(latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+	index := sort.Search(latencyBucketCount, func(i int) bool { return latency <= latencyBucketBounds[i] })
+	h.Buckets[index]++
+	if h.Count == 0 || latency < h.Min {
+		h.Min = latency
+	}
+	if latency > h.Max {
+		h.Max = latency
+	}
+	h.Count++
+	h.Sum += latency
+}
+
+//Mean returns the average latency
+func (h *LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+//Percentile returns the estimated latency below which the fraction p of the latencies are, p is limited to 0 and 1
+func (h *LatencyHistogram) Percentile(p float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	p = math.Max(0, math.Min(1, p))
+	rank := p * float64(h.Count)
+	var cumulative float64
+	for i, count := range h.Buckets {
+		if count == 0 {
+			continue
+		}
+		if cumulative+float64(count) < rank {
+			cumulative += float64(count)
+			continue
+		}
+		lower, upper := latencyBucketRange(i)
+		if lower < h.Min {
+			lower = h.Min
+		}
+		if upper > h.Max {
+			upper = h.Max
+		}
+		fraction := (rank - cumulative) / float64(count)
+		return lower + time.Duration(fraction*float64(upper-lower))
+	}
+	return h.Max
+}
+
+//Sub returns the latencies observed since the previous snapshot of the histogram
+//min and max of the difference are the bounds of its first and last bucket, without latencies they are zero
+func (h *LatencyHistogram) Sub(previous *LatencyHistogram) LatencyHistogram {
+	diff := LatencyHistogram{Count: h.Count - previous.Count, Sum: h.Sum - previous.Sum}
+	first := true
+	for i := range h.Buckets {
+		diff.Buckets[i] = h.Buckets[i] - previous.Buckets[i]
+		if diff.Buckets[i] == 0 {
+			continue
+		}
+		lower, upper := latencyBucketRange(i)
+		if first {
+			diff.Min = lower
+			first = false
+		}
+		diff.Max = upper
+	}
+	if first {
+		return diff
+	}
+	if diff.Min < h.Min {
+		diff.Min = h.Min
+	}
+	if diff.Max > h.Max {
+		diff.Max = h.Max
+	}
+	return diff
+}
+
+//latencyBucketRange returns the bounds of the bucket, the last bucket is bounded by the maximum latency
+func latencyBucketRange(index int) (time.Duration, time.Duration) {
+	var lower time.Duration
+	if index > 0 {
+		lower = latencyBucketBounds[index-1]
+	}
+	if index == latencyBucketCount {
+		return lower, time.Duration(math.MaxInt64)
+	}
+	return lower, latencyBucketBounds[index]
+}
+
+//PartitionLatency holds the latencies of the messages of a partition
+//EndToEnd is the time from the message timestamp until the consumer received it,
+//Handling is the time from receiving the message until the handler returned
+type PartitionLatency struct {
+	Topic     string
+	Partition int32
+	EndToEnd  LatencyHistogram
+	Handling  LatencyHistogram
+}
+
+//latencyTracker keeps the latency histograms per partition
+type latencyTracker struct {
+	mutex      sync.Mutex
+	partitions map[PartitionRef]*PartitionLatency
+}
+
+//record adds the latencies of a message and returns the end to end latency, messages without timestamp only count the handling
+func (t *latencyTracker) record(topic string, partition int32, timestamp time.Time, received time.Time, handled time.Time) (time.Duration, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.partitions == nil {
+		t.partitions = map[PartitionRef]*PartitionLatency{}
+	}
+	ref := PartitionRef{Topic: topic, Partition: partition}
+	latency, ok := t.partitions[ref]
+	if !ok {
+		latency = &PartitionLatency{Topic: topic, Partition: partition}
+		t.partitions[ref] = latency
+	}
+	latency.Handling.Observe(handled.Sub(received))
+	if timestamp.IsZero() {
+		return 0, false
+	}
+	endToEnd := received.Sub(timestamp)
+	latency.EndToEnd.Observe(endToEnd)
+	return endToEnd, true
+}
+
+//snapshot returns a copy of the histograms sorted by topic and partition
+func (t *latencyTracker) snapshot() []PartitionLatency {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	latencies := make([]PartitionLatency, 0, len(t.partitions))
+	for _, latency := range t.partitions {
+		latencies = append(latencies, *latency)
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		if latencies[i].Topic != latencies[j].Topic {
+			return latencies[i].Topic < latencies[j].Topic
+		}
+		return latencies[i].Partition < latencies[j].Partition
+	})
+	return latencies
+}
+
+//GetLatency returns the latency histograms of the partitions consumed since the consumer was created
+func (kc *MessageConsumer) GetLatency() []PartitionLatency {
+	return kc.latency.snapshot()
+}
+
+//LatencyReporter reports the latencies of each period to the logger like the okfw RateReporter reports rates
+type LatencyReporter struct {
+	Name     string
+	Source   func() []PartitionLatency
+	Shutdown *bool
+	Logger   func(name string, latency PartitionLatency)
+	Period   time.Duration
+}
+
+//NewLatencyReporter creates a LatencyReporter
+func NewLatencyReporter(name string, source func() []PartitionLatency, shutdown *bool, logger func(name string, latency PartitionLatency), periodMs int) (*LatencyReporter, error) {
+	if source == nil {
+		return nil, fmt.Errorf("source should not be nil")
+	}
+	if shutdown == nil {
+		return nil, fmt.Errorf("shutdown should not be nil")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("logger should not be nil")
+	}
+	if periodMs <= 0 {
+		return nil, fmt.Errorf("period should be positive [%d]", periodMs)
+	}
+
+	return &LatencyReporter{
+		Name:     name,
+		Source:   source,
+		Shutdown: shutdown,
+		Logger:   logger,
+		Period:   time.Duration(periodMs) * time.Millisecond,
+	}, nil
+}
+
+//Run reports the latencies of the partitions with messages in the period until shutdown
+func (r *LatencyReporter) Run() {
+	last := map[PartitionRef]PartitionLatency{}
+	for _, latency := range r.Source() {
+		last[PartitionRef{Topic: latency.Topic, Partition: latency.Partition}] = latency
+	}
+	ticker := time.NewTicker(r.Period)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, latency := range r.Source() {
+			ref := PartitionRef{Topic: latency.Topic, Partition: latency.Partition}
+			previous := last[ref]
+			last[ref] = latency
+			period := PartitionLatency{
+				Topic:     latency.Topic,
+				Partition: latency.Partition,
+				EndToEnd:  latency.EndToEnd.Sub(&previous.EndToEnd),
+				Handling:  latency.Handling.Sub(&previous.Handling),
+			}
+			if period.Handling.Count > 0 {
+				r.Logger(r.Name, period)
+			}
+		}
+		if *r.Shutdown {
+			break
+		}
+	}
+}
+
+//RunLatencyReporter logs the latency percentiles of each interval until shutdown and should be run in a go routine
+func (kc *MessageConsumer) RunLatencyReporter(intervalMs int, shutdown *bool) {
+	reporter, err := NewLatencyReporter(kc.Topic, kc.GetLatency, shutdown, logLatency, intervalMs)
+	if err == nil {
+		reporter.Run()
+	}
+}
+
+func logLatency(name string, latency PartitionLatency) {
+	if logger == nil || !logger.IsLevelInfo() {
+		return
+	}
+	logger.Infof("report latency [%s] partition [%s] messages [%d] end to end p50 [%s] p95 [%s] p99 [%s] handling p50 [%s] p95 [%s] p99 [%s]\n",
+		name, PartitionRef{Topic: latency.Topic, Partition: latency.Partition}, latency.Handling.Count,
+		latency.EndToEnd.Percentile(0.5), latency.EndToEnd.Percentile(0.95), latency.EndToEnd.Percentile(0.99),
+		latency.Handling.Percentile(0.5), latency.Handling.Percentile(0.95), latency.Handling.Percentile(0.99))
+}
@@ -0,0 +1,130 @@
+package confluent
+
+import (
+	"testing"
+	"time"
+)
+
+//expectNear fails if the estimate is off by more than the relative error
+func expectNear(t *testing.T, name string, expected time.Duration, actual time.Duration, relative float64) {
+	t.Helper()
+	diff := actual - expected
+	if diff < 0 {
+		diff = -diff
+	}
+	if float64(diff) > relative*float64(expected) {
+		t.Errorf("%s expected [%v] within [%.0f%%] but was [%v]", name, expected, relative*100, actual)
+	}
+}
+
+func TestLatencyBuckets(t *testing.T) {
+	tests := []struct {
+		latency time.Duration
+		bucket  int
+	}{
+		{-time.Second, 0},
+		{0, 0},
+		{latencyBucketBase, 0},
+		{latencyBucketBase + 1, 1},
+		{2 * latencyBucketBase, 4},
+		{2*latencyBucketBase + 1, 5},
+		{latencyBucketBounds[latencyBucketCount-1], latencyBucketCount - 1},
+		{latencyBucketBounds[latencyBucketCount-1] + 1, latencyBucketCount},
+		{7 * 24 * time.Hour, latencyBucketCount},
+	}
+	for _, test := range tests {
+		h := LatencyHistogram{}
+		h.Observe(test.latency)
+		if h.Buckets[test.bucket] != 1 {
+			t.Errorf("latency [%v] expected in bucket [%d]", test.latency, test.bucket)
+		}
+	}
+	if latencyBucketBounds[latencyBucketCount-1] < 24*time.Hour {
+		t.Errorf("buckets expected to reach beyond one day but end at [%v]", latencyBucketBounds[latencyBucketCount-1])
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	h := LatencyHistogram{}
+	if h.Percentile(0.5) != 0 || h.Mean() != 0 {
+		t.Errorf("empty histogram expected zero percentile and mean but was [%v] and [%v]", h.Percentile(0.5), h.Mean())
+	}
+
+	for i := 1; i <= 1000; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+	expectNear(t, "p50", 500*time.Millisecond, h.Percentile(0.5), 0.2)
+	expectNear(t, "p95", 950*time.Millisecond, h.Percentile(0.95), 0.2)
+	expectNear(t, "p99", 990*time.Millisecond, h.Percentile(0.99), 0.2)
+	expectNear(t, "mean", 500500*time.Microsecond, h.Mean(), 0)
+
+	//percentiles stay between min and max, p out of range is limited
+	tests := []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{0, time.Millisecond},
+		{-1, time.Millisecond},
+		{1, time.Second},
+		{2, time.Second},
+	}
+	for _, test := range tests {
+		if actual := h.Percentile(test.p); actual != test.expected {
+			t.Errorf("percentile [%v] expected [%v] but was [%v]", test.p, test.expected, actual)
+		}
+	}
+
+	//latencies beyond the last bucket are bounded by the maximum
+	h = LatencyHistogram{}
+	h.Observe(48 * time.Hour)
+	h.Observe(72 * time.Hour)
+	if p := h.Percentile(0.99); p < 48*time.Hour || p > 72*time.Hour {
+		t.Errorf("percentile of the last bucket expected between min and max but was [%v]", p)
+	}
+	if h.Percentile(1) != 72*time.Hour {
+		t.Errorf("p100 expected the maximum but was [%v]", h.Percentile(1))
+	}
+
+	//a single latency is every percentile
+	h = LatencyHistogram{}
+	h.Observe(3 * time.Millisecond)
+	for _, p := range []float64{0, 0.5, 1} {
+		if h.Percentile(p) != 3*time.Millisecond {
+			t.Errorf("percentile [%v] of a single latency expected [3ms] but was [%v]", p, h.Percentile(p))
+		}
+	}
+}
+
+func TestLatencySub(t *testing.T) {
+	h := LatencyHistogram{}
+	for i := 0; i < 100; i++ {
+		h.Observe(time.Millisecond)
+	}
+	previous := h
+	for i := 0; i < 100; i++ {
+		h.Observe(time.Second)
+	}
+	diff := h.Sub(&previous)
+	if diff.Count != 100 || diff.Sum != 100*time.Second {
+		t.Errorf("difference expected [100] latencies of [100s] but was [%d] of [%v]", diff.Count, diff.Sum)
+	}
+	if diff.Min > time.Second || diff.Min < time.Second*84/100 || diff.Max != time.Second {
+		t.Errorf("difference expected min within the bucket of 1s and max 1s but was [%v] and [%v]", diff.Min, diff.Max)
+	}
+	expectNear(t, "p50 of the difference", time.Second, diff.Percentile(0.5), 0.2)
+	if diff.Percentile(0) < time.Second*84/100 {
+		t.Errorf("earlier latencies expected not to be in the difference but p0 was [%v]", diff.Percentile(0))
+	}
+
+	//a difference without latencies is empty
+	empty := h.Sub(&h)
+	if empty.Count != 0 || empty.Min != 0 || empty.Max != 0 || empty.Percentile(0.5) != 0 {
+		t.Errorf("difference of the same snapshot expected empty but was %+v", empty)
+	}
+
+	//the difference to the zero histogram is the histogram with bucket bounds
+	all := h.Sub(&LatencyHistogram{})
+	if all.Count != 200 || all.Min != time.Millisecond || all.Max != time.Second || all.Buckets != h.Buckets {
+		t.Errorf("difference to zero histogram expected all latencies but was count [%d] min [%v] max [%v]", all.Count, all.Min, all.Max)
+	}
+}
@@ -1,13 +1,242 @@
 package confluent
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/rbock44/okfw-logapi-go/logapi"
 )
 
+//logRepeatInterval is the time identical log messages of a client are suppressed
+const logRepeatInterval = 10 * time.Second
+
+//maxRepeatedLogs limits the messages tracked for suppression
+const maxRepeatedLogs = 1000
+
 //Logger logger implementation
 var logger logapi.Logger
 
 //SetLogger sets the logger implementation
+//client events like errors, rebalances, commits, delivery failures and throttling and the librdkafka log lines
+//of producers and consumers are forwarded to the logger, a logger implementing FieldLogger gets the fields apart from the message
 func SetLogger(logImpl logapi.Logger) {
 	logger = logImpl
 }
+
+//FieldLogger is implemented by loggers that keep fields apart from the message like json loggers
+//the fields are client_id and where known topic, partition and the librdkafka log tag
+type FieldLogger interface {
+	LogFields(level string, message string, fields map[string]string)
+}
+
+type logLevel int
+
+const (
+	logDebug logLevel = iota
+	logInfo
+	logWarn
+	logError
+)
+
+var logLevelNames = map[logLevel]string{logDebug: "debug", logInfo: "info", logWarn: "warn", logError: "error"}
+
+//eventLogger forwards the events of a client to the logger and suppresses repeated messages
+type eventLogger struct {
+	clientID string
+	mutex    sync.Mutex
+	repeated map[string]*repeatedLog
+}
+
+type repeatedLog struct {
+	logged     time.Time
+	suppressed int
+}
+
+func newEventLogger(clientID string) *eventLogger {
+	return &eventLogger{clientID: clientID, repeated: map[string]*repeatedLog{}}
+}
+
+//logEvent logs the client event with the level of its kind
+func (l *eventLogger) logEvent(event kafka.Event) {
+	switch e := event.(type) {
+	case kafka.Error:
+		l.log(errorLevel(e), nil, "client error code [%d] error [%v]", e.Code(), e)
+	case kafka.AssignedPartitions:
+		l.log(logInfo, nil, "partitions assigned [%s]", formatPartitions(e.Partitions))
+	case kafka.RevokedPartitions:
+		l.log(logInfo, nil, "partitions revoked [%s]", formatPartitions(e.Partitions))
+	case kafka.OffsetsCommitted:
+		l.logCommit(e)
+	case kafka.PartitionEOF:
+		l.log(logDebug, partitionFields(e.Topic, e.Partition), "partition end reached offset [%v]", e.Offset)
+	case *kafka.Message:
+		if e.TopicPartition.Error != nil {
+			l.log(logWarn, partitionFields(e.TopicPartition.Topic, e.TopicPartition.Partition), "message delivery failed error [%v]", e.TopicPartition.Error)
+		}
+	}
+}
+
+func (l *eventLogger) logCommit(e kafka.OffsetsCommitted) {
+	if e.Error != nil {
+		l.log(logWarn, nil, "offset commit failed error [%v]", e.Error)
+		return
+	}
+	for _, toppar := range e.Offsets {
+		if toppar.Error != nil {
+			l.log(logWarn, partitionFields(toppar.Topic, toppar.Partition), "offset commit failed offset [%v] error [%v]", toppar.Offset, toppar.Error)
+		}
+	}
+	if logger != nil && logger.IsLevelDebug() {
+		l.log(logDebug, nil, "offsets committed [%s]", formatPartitions(e.Offsets))
+	}
+}
+
+//logThrottle logs the brokers that throttled the client in the statistics interval
+func (l *eventLogger) logThrottle(stats *ClientStats) {
+	if stats == nil {
+		return
+	}
+	for _, broker := range stats.Brokers {
+		if broker.ThrottleMillis.Max > 0 {
+			l.log(logWarn, []string{"broker", broker.Name}, "throttled by broker avg [%d] ms max [%d] ms", broker.ThrottleMillis.Avg, broker.ThrottleMillis.Max)
+		}
+	}
+}
+
+//forwardLogs logs the librdkafka log lines of the client until the channel is closed with the client
+func (l *eventLogger) forwardLogs(logs chan kafka.LogEvent) {
+	for e := range logs {
+		l.logLibrdkafka(e)
+	}
+}
+
+func (l *eventLogger) logLibrdkafka(e kafka.LogEvent) {
+	l.log(syslogLevel(e.Level), []string{"tag", e.Tag}, "%s", e.Message)
+}
+
+//log formats the message and passes it to the logger unless it was logged within the repeat interval
+//the fields are name value pairs
+func (l *eventLogger) log(level logLevel, fields []string, format string, args ...interface{}) {
+	if logger == nil {
+		return
+	}
+	if level == logDebug && !logger.IsLevelDebug() || level == logInfo && !logger.IsLevelInfo() {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	suppressed, ok := l.allow(message+" "+formatLogFields(fields), time.Now())
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		message = fmt.Sprintf("%s repeated [%d] times", message, suppressed+1)
+	}
+
+	if fieldLogger, ok := logger.(FieldLogger); ok {
+		named := map[string]string{"client_id": l.clientID}
+		for i := 0; i+1 < len(fields); i += 2 {
+			named[fields[i]] = fields[i+1]
+		}
+		fieldLogger.LogFields(logLevelNames[level], message, named)
+		return
+	}
+	if len(fields) > 0 {
+		message = formatLogFields(fields) + " " + message
+	}
+	switch level {
+	case logDebug:
+		logger.Debugf("client [%s] %s", l.clientID, message)
+	case logInfo:
+		logger.Infof("client [%s] %s", l.clientID, message)
+	case logWarn:
+		logger.Warnf("client [%s] %s", l.clientID, message)
+	default:
+		logger.Errorf("client [%s] %s", l.clientID, message)
+	}
+}
+
+//partitionFields returns the topic and partition fields of a message
+func partitionFields(topic *string, partition int32) []string {
+	return []string{"topic", topicName(topic), "partition", strconv.Itoa(int(partition))}
+}
+
+//formatLogFields formats the name value pairs like the messages
+func formatLogFields(fields []string) string {
+	formatted := make([]string, 0, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		formatted = append(formatted, fmt.Sprintf("%s [%s]", fields[i], fields[i+1]))
+	}
+	return strings.Join(formatted, " ")
+}
+
+//allow returns true if the message was not logged within the repeat interval and the number of suppressed messages
+func (l *eventLogger) allow(message string, now time.Time) (int, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	repeated, ok := l.repeated[message]
+	if ok && now.Sub(repeated.logged) < logRepeatInterval {
+		repeated.suppressed++
+		return 0, false
+	}
+	if !ok {
+		if len(l.repeated) >= maxRepeatedLogs {
+			l.removeExpired(now)
+		}
+		repeated = &repeatedLog{}
+		l.repeated[message] = repeated
+	}
+	suppressed := repeated.suppressed
+	repeated.logged = now
+	repeated.suppressed = 0
+	return suppressed, true
+}
+
+func (l *eventLogger) removeExpired(now time.Time) {
+	for message, repeated := range l.repeated {
+		if now.Sub(repeated.logged) >= logRepeatInterval {
+			delete(l.repeated, message)
+		}
+	}
+}
+
+//syslogLevel maps the syslog level of a librdkafka log line, emergency to error are errors and notice is info
+func syslogLevel(level int) logLevel {
+	switch {
+	case level <= 3:
+		return logError
+	case level == 4:
+		return logWarn
+	case level <= 6:
+		return logInfo
+	}
+	return logDebug
+}
+
+//errorLevel maps the error code to a log level, connection problems librdkafka recovers from are warnings
+func errorLevel(err kafka.Error) logLevel {
+	switch err.Code() {
+	case kafka.ErrTransport, kafka.ErrResolve, kafka.ErrTimedOut, kafka.ErrMsgTimedOut, kafka.ErrRequestTimedOut:
+		return logWarn
+	}
+	return logError
+}
+
+func formatPartitions(toppars []kafka.TopicPartition) string {
+	formatted := make([]string, len(toppars))
+	for i, toppar := range toppars {
+		formatted[i] = fmt.Sprintf("%s[%d]@%v", topicName(toppar.Topic), toppar.Partition, toppar.Offset)
+	}
+	return strings.Join(formatted, " ")
+}
+
+func topicName(topic *string) string {
+	if topic == nil {
+		return ""
+	}
+	return *topic
+}
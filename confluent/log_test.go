@@ -0,0 +1,201 @@
+package confluent
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/rbock44/okfw-logapi-go/logapi"
+)
+
+//recordingLogger records the formatted lines with their level
+type recordingLogger struct {
+	debug bool
+	lines []string
+}
+
+func (r *recordingLogger) IsLevelInfo() bool  { return true }
+func (r *recordingLogger) IsLevelDebug() bool { return r.debug }
+func (r *recordingLogger) Errorf(format string, args ...interface{}) {
+	r.lines = append(r.lines, "error "+fmt.Sprintf(format, args...))
+}
+func (r *recordingLogger) Warnf(format string, args ...interface{}) {
+	r.lines = append(r.lines, "warn "+fmt.Sprintf(format, args...))
+}
+func (r *recordingLogger) Infof(format string, args ...interface{}) {
+	r.lines = append(r.lines, "info "+fmt.Sprintf(format, args...))
+}
+func (r *recordingLogger) Debugf(format string, args ...interface{}) {
+	r.lines = append(r.lines, "debug "+fmt.Sprintf(format, args...))
+}
+func (r *recordingLogger) Fatalf(format string, args ...interface{}) {
+	r.lines = append(r.lines, "fatal "+fmt.Sprintf(format, args...))
+}
+
+//recordingFieldLogger records the fields apart from the message
+type recordingFieldLogger struct {
+	recordingLogger
+	fields []map[string]string
+}
+
+func (r *recordingFieldLogger) LogFields(level string, message string, fields map[string]string) {
+	r.lines = append(r.lines, level+" "+message)
+	r.fields = append(r.fields, fields)
+}
+
+func useLogger(t *testing.T, l logapi.Logger) {
+	previous := logger
+	SetLogger(l)
+	t.Cleanup(func() { logger = previous })
+}
+
+func expectLogLines(t *testing.T, lines []string, expected ...string) {
+	if len(lines) != len(expected) {
+		t.Fatalf("expected lines %q but was %q", expected, lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("expected line [%d] [%s] but was [%s]", i, expected[i], lines[i])
+		}
+	}
+}
+
+func TestEventLoggerAllowSuppressesRepeats(t *testing.T) {
+	l := newEventLogger("client")
+	now := time.Now()
+
+	if suppressed, ok := l.allow("broker down", now); !ok || suppressed != 0 {
+		t.Fatalf("expected first message allowed but was [%t] suppressed [%d]", ok, suppressed)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, ok := l.allow("broker down", now.Add(time.Duration(i)*time.Second)); ok {
+			t.Fatalf("expected repeat [%d] suppressed", i)
+		}
+	}
+	if _, ok := l.allow("other message", now.Add(time.Second)); !ok {
+		t.Fatalf("expected other message allowed")
+	}
+	suppressed, ok := l.allow("broker down", now.Add(logRepeatInterval))
+	if !ok || suppressed != 3 {
+		t.Fatalf("expected message allowed after interval with [3] suppressed but was [%t] [%d]", ok, suppressed)
+	}
+	if _, ok := l.allow("broker down", now.Add(logRepeatInterval+time.Second)); ok {
+		t.Fatalf("expected repeat after the interval restarted to be suppressed")
+	}
+}
+
+func TestEventLoggerAllowRemovesExpired(t *testing.T) {
+	l := newEventLogger("client")
+	now := time.Now()
+	for i := 0; i < maxRepeatedLogs-1; i++ {
+		l.allow(fmt.Sprintf("old %d", i), now)
+	}
+	l.allow("recent", now.Add(logRepeatInterval))
+
+	l.allow("new", now.Add(logRepeatInterval+time.Second))
+	if len(l.repeated) != 2 {
+		t.Fatalf("expected expired messages removed leaving [2] but was [%d]", len(l.repeated))
+	}
+	if _, ok := l.allow("recent", now.Add(logRepeatInterval+time.Second)); ok {
+		t.Errorf("expected unexpired message still suppressed")
+	}
+}
+
+func TestEventLoggerRepeatCountInMessage(t *testing.T) {
+	r := &recordingLogger{}
+	useLogger(t, r)
+	l := newEventLogger("client")
+
+	l.log(logWarn, nil, "broker [%s] down", "b1")
+	l.log(logWarn, nil, "broker [%s] down", "b1")
+	l.repeated["broker [b1] down "].logged = time.Now().Add(-logRepeatInterval)
+	l.log(logWarn, nil, "broker [%s] down", "b1")
+
+	expectLogLines(t, r.lines,
+		"warn client [client] broker [b1] down",
+		"warn client [client] broker [b1] down repeated [2] times")
+}
+
+func TestEventLoggerLevels(t *testing.T) {
+	r := &recordingLogger{}
+	useLogger(t, r)
+	l := newEventLogger("client")
+
+	l.log(logDebug, nil, "debug hidden")
+	l.log(logInfo, nil, "info shown")
+	r.debug = true
+	l.log(logDebug, nil, "debug shown")
+	l.log(logError, nil, "error shown")
+
+	expectLogLines(t, r.lines,
+		"info client [client] info shown",
+		"debug client [client] debug shown",
+		"error client [client] error shown")
+}
+
+func TestEventLoggerFields(t *testing.T) {
+	topic := "orders"
+	delivery := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 2, Error: fmt.Errorf("timed out")}}
+
+	r := &recordingLogger{}
+	useLogger(t, r)
+	newEventLogger("client").logEvent(delivery)
+	expectLogLines(t, r.lines, "warn client [client] topic [orders] partition [2] message delivery failed error [timed out]")
+
+	f := &recordingFieldLogger{}
+	useLogger(t, f)
+	newEventLogger("client").logEvent(delivery)
+	expectLogLines(t, f.lines, "warn message delivery failed error [timed out]")
+	expected := map[string]string{"client_id": "client", "topic": "orders", "partition": "2"}
+	if fmt.Sprint(f.fields[0]) != fmt.Sprint(expected) {
+		t.Errorf("expected fields %v but was %v", expected, f.fields[0])
+	}
+}
+
+func TestEventLoggerForwardLogs(t *testing.T) {
+	f := &recordingFieldLogger{}
+	useLogger(t, f)
+	logs := make(chan kafka.LogEvent, 3)
+	logs <- kafka.LogEvent{Name: "rdkafka#producer-1", Tag: "FAIL", Message: "broker connection refused", Level: 3}
+	logs <- kafka.LogEvent{Name: "rdkafka#producer-1", Tag: "CONFWARN", Message: "configuration ignored", Level: 4}
+	logs <- kafka.LogEvent{Name: "rdkafka#producer-1", Tag: "BRKMAIN", Message: "broker thread started", Level: 7}
+	close(logs)
+
+	newEventLogger("client").forwardLogs(logs)
+
+	expectLogLines(t, f.lines, "error broker connection refused", "warn configuration ignored")
+	if f.fields[0]["tag"] != "FAIL" || f.fields[1]["tag"] != "CONFWARN" {
+		t.Errorf("expected the librdkafka tags as fields but was %v", f.fields)
+	}
+}
+
+func TestSyslogLevel(t *testing.T) {
+	expected := map[int]logLevel{0: logError, 2: logError, 3: logError, 4: logWarn, 5: logInfo, 6: logInfo, 7: logDebug}
+	for level, mapped := range expected {
+		if syslogLevel(level) != mapped {
+			t.Errorf("expected syslog level [%d] mapped to [%s] but was [%s]", level, logLevelNames[mapped], logLevelNames[syslogLevel(level)])
+		}
+	}
+}
+
+func TestErrorLevel(t *testing.T) {
+	tests := []struct {
+		code  kafka.ErrorCode
+		level logLevel
+	}{
+		{kafka.ErrTransport, logWarn},
+		{kafka.ErrResolve, logWarn},
+		{kafka.ErrTimedOut, logWarn},
+		{kafka.ErrMsgTimedOut, logWarn},
+		{kafka.ErrRequestTimedOut, logWarn},
+		{kafka.ErrAllBrokersDown, logError},
+		{kafka.ErrTopicAuthorizationFailed, logError},
+		{kafka.ErrSsl, logError},
+	}
+	for _, test := range tests {
+		if level := errorLevel(kafka.NewError(test.code, "", false)); level != test.level {
+			t.Errorf("expected code [%v] mapped to [%s] but was [%s]", test.code, logLevelNames[test.level], logLevelNames[level])
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package memkafka
+
+import (
+	"testing"
+
+	"github.com/rbock44/okfw-confluent-go/confluent/providertest"
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+func TestConformance(t *testing.T) {
+	providertest.Run(t, providertest.Config{
+		NewProvider: func(t *testing.T) okfwkafka.Provider {
+			return NewProvider()
+		},
+	})
+}
+
+func TestConformancePartitioned(t *testing.T) {
+	providertest.Run(t, providertest.Config{
+		NewProvider: func(t *testing.T) okfwkafka.Provider {
+			provider := NewProvider()
+			provider.DefaultPartitions = 4
+			return provider
+		},
+	})
+}
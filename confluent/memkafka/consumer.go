@@ -0,0 +1,121 @@
+package memkafka
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+//Consumer consumes the partitions assigned in its group and commits each message after the handler returned
+//messages without committed offset start at the beginning like auto.offset.reset earliest
+type Consumer struct {
+	Topic          string
+	ClientID       string
+	GroupID        string
+	Handler        okfwkafka.MessageHandler
+	DeliveredCount int64
+	provider       *Provider
+	closed         bool
+	nextPartition  int
+}
+
+//Process passes the next message of the assigned partitions to the handler, it waits up to the timeout for a message
+func (c *Consumer) Process(pollTimeoutMs int) error {
+	deadline := time.Now().Add(time.Duration(pollTimeoutMs) * time.Millisecond)
+	for {
+		m, notify, err := c.provider.next(c)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			c.Handler.Handle(&okfwkafka.MessageContext{Timestamp: m.Timestamp}, copyBytes(m.Key), copyBytes(m.Value))
+			c.provider.commit(c, m)
+			atomic.AddInt64(&c.DeliveredCount, 1)
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-notify:
+			timer.Stop()
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+//GetMessageCounter returns the address of the counter of handled messages
+func (c *Consumer) GetMessageCounter() *int64 {
+	return &c.DeliveredCount
+}
+
+//GetBacklog returns the messages between the committed offsets and the high watermarks of the assigned partitions
+func (c *Consumer) GetBacklog() (int, error) {
+	p := c.provider
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if c.closed {
+		return 0, fmt.Errorf("consumer closed [%s]", c.ClientID)
+	}
+	t := p.getTopic(c.Topic)
+	g := p.getGroup(c.GroupID)
+	backlog := 0
+	for _, partition := range p.assignment(c) {
+		committed := g.committed[partitionRef{topic: c.Topic, partition: partition}]
+		if lag := int64(len(t.partitions[partition])) - committed; lag > 0 {
+			backlog += int(lag)
+		}
+	}
+	return backlog, nil
+}
+
+//Close leaves the group, closing again has no effect
+func (c *Consumer) Close() {
+	c.provider.mutex.Lock()
+	closed := c.closed
+	c.closed = true
+	c.provider.mutex.Unlock()
+	if !closed {
+		c.provider.leave(c)
+	}
+}
+
+//next returns the next message of the assigned partitions, the partitions take turns
+//without message the channel closed by the next produce is returned
+func (p *Provider) next(c *Consumer) (*Message, chan struct{}, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if c.closed {
+		return nil, nil, fmt.Errorf("consumer closed [%s]", c.ClientID)
+	}
+	t := p.getTopic(c.Topic)
+	g := p.getGroup(c.GroupID)
+	partitions := p.assignment(c)
+	for i := range partitions {
+		partition := partitions[(c.nextPartition+i)%len(partitions)]
+		offset := g.committed[partitionRef{topic: c.Topic, partition: partition}]
+		if offset < int64(len(t.partitions[partition])) {
+			c.nextPartition = (c.nextPartition + i + 1) % len(partitions)
+			m := t.partitions[partition][offset]
+			return &m, nil, nil
+		}
+	}
+	return nil, p.notify, nil
+}
+
+//commit stores the offset after the message unless the group already committed beyond it
+func (p *Provider) commit(c *Consumer, m *Message) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ref := partitionRef{topic: m.Topic, partition: m.Partition}
+	g := p.getGroup(c.GroupID)
+	if g.committed[ref] <= m.Offset {
+		g.committed[ref] = m.Offset + 1
+	}
+}
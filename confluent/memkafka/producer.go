@@ -0,0 +1,61 @@
+package memkafka
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//Producer appends the messages to the topic of the provider, messages are delivered when the send returns
+type Producer struct {
+	Topic     string
+	ClientID  string
+	SentCount int64
+	provider  *Provider
+	mutex     sync.Mutex
+	closed    bool
+}
+
+//SendKeyValue sends the message to the partition selected by the key
+func (p *Producer) SendKeyValue(key []byte, value []byte) error {
+	_, err := p.Send(-1, key, value)
+	return err
+}
+
+//SendTombstone sends a message without value to delete the key from a compacted topic
+func (p *Producer) SendTombstone(key []byte) error {
+	_, err := p.Send(-1, key, nil)
+	return err
+}
+
+//Send sends the message to the partition, a negative partition is selected by the key, the stored message is returned
+func (p *Producer) Send(partition int32, key []byte, value []byte) (Message, error) {
+	p.mutex.Lock()
+	closed := p.closed
+	p.mutex.Unlock()
+	if closed {
+		return Message{}, fmt.Errorf("producer closed [%s]", p.ClientID)
+	}
+	m, err := p.provider.Produce(p.Topic, partition, key, value, time.Now())
+	if err != nil {
+		return m, err
+	}
+	atomic.AddInt64(&p.SentCount, 1)
+	return m, nil
+}
+
+//GetMessageCounter returns the address of the counter of sent messages
+func (p *Producer) GetMessageCounter() *int64 {
+	return &p.SentCount
+}
+
+//WaitUntilSendComplete returns immediately as sent messages are already stored
+func (p *Producer) WaitUntilSendComplete() {}
+
+//Close rejects further messages, closing again has no effect
+func (p *Producer) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+}
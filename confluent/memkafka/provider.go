@@ -0,0 +1,304 @@
+//Package memkafka is an in-memory okfw kafka provider for unit tests without a broker
+package memkafka
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"sync"
+	"time"
+
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+//DefaultGroupID is the consumer group of the consumers like the confluent provider uses
+const DefaultGroupID = "segmenter"
+
+//Message is a message stored in a partition
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Timestamp time.Time
+}
+
+//Provider keeps topics, consumer groups and schemas in memory and creates okfw consumers and producers on them
+//topics are created with DefaultPartitions when first used, consumers of the same topic share the partitions of the group
+type Provider struct {
+	DefaultPartitions int32
+	GroupID           string
+	mutex             sync.Mutex
+	topics            map[string]*topic
+	groups            map[string]*group
+	notify            chan struct{}
+	schemas           *SchemaResolver
+}
+
+type topic struct {
+	name       string
+	partitions [][]Message
+	roundRobin int32
+}
+
+//group holds the committed offsets and the members per topic in join order
+type group struct {
+	committed map[partitionRef]int64
+	members   map[string][]*Consumer
+}
+
+type partitionRef struct {
+	topic     string
+	partition int32
+}
+
+//NewProvider creates an empty in-memory cluster with single partition topics
+func NewProvider() *Provider {
+	return &Provider{
+		DefaultPartitions: 1,
+		GroupID:           DefaultGroupID,
+		topics:            map[string]*topic{},
+		groups:            map[string]*group{},
+		notify:            make(chan struct{}),
+		schemas:           NewSchemaResolver(),
+	}
+}
+
+//NewConsumer creates a consumer joining the group of the provider on the topic
+func (p *Provider) NewConsumer(topicName string, clientID string, handler okfwkafka.MessageHandler) (okfwkafka.MessageConsumer, error) {
+	return p.NewGroupConsumer(topicName, clientID, p.GroupID, handler)
+}
+
+//NewGroupConsumer creates a consumer joining the group on the topic
+func (p *Provider) NewGroupConsumer(topicName string, clientID string, groupID string, handler okfwkafka.MessageHandler) (*Consumer, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("consumer message handler missing")
+	}
+	if topicName == "" {
+		return nil, fmt.Errorf("consumer topic missing")
+	}
+	c := &Consumer{Topic: topicName, ClientID: clientID, GroupID: groupID, Handler: handler, provider: p}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.getTopic(topicName)
+	g := p.getGroup(groupID)
+	g.members[topicName] = append(g.members[topicName], c)
+	return c, nil
+}
+
+//NewProducer creates a producer for the topic
+func (p *Provider) NewProducer(topicName string, clientID string) (okfwkafka.MessageProducer, error) {
+	if topicName == "" {
+		return nil, fmt.Errorf("producer topic missing")
+	}
+	return &Producer{Topic: topicName, ClientID: clientID, provider: p}, nil
+}
+
+//NewSchemaResolver returns the schema registry of the provider
+func (p *Provider) NewSchemaResolver() (okfwkafka.SchemaResolver, error) {
+	return p.schemas, nil
+}
+
+//Schemas returns the schema registry of the provider
+func (p *Provider) Schemas() *SchemaResolver {
+	return p.schemas
+}
+
+//CreateTopic creates the topic with the partition count
+func (p *Provider) CreateTopic(topicName string, partitions int32) error {
+	if partitions <= 0 {
+		return fmt.Errorf("partition count invalid [%d]", partitions)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, ok := p.topics[topicName]; ok {
+		return fmt.Errorf("topic already exists [%s]", topicName)
+	}
+	p.topics[topicName] = &topic{name: topicName, partitions: make([][]Message, partitions)}
+	return nil
+}
+
+//Topics returns the names of all topics
+func (p *Provider) Topics() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	names := make([]string, 0, len(p.topics))
+	for name := range p.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//Partitions returns the partition count of the topic
+func (p *Provider) Partitions(topicName string) (int32, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	t, ok := p.topics[topicName]
+	if !ok {
+		return 0, fmt.Errorf("topic not found [%s]", topicName)
+	}
+	return int32(len(t.partitions)), nil
+}
+
+//Produce appends the message to the partition, the stored message with its offset is returned
+//a negative partition is selected by the crc32 of the key on purpose like the consistent_random partitioner of librdkafka
+//so tests see the partitions of the confluent provider, messages with empty key take turns instead of random partitions
+func (p *Provider) Produce(topicName string, partition int32, key []byte, value []byte, timestamp time.Time) (Message, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	t := p.getTopic(topicName)
+	count := int32(len(t.partitions))
+	switch {
+	case partition >= count:
+		return Message{}, fmt.Errorf("partition [%d] of topic [%s] not found", partition, topicName)
+	case partition >= 0:
+	case len(key) > 0:
+		partition = int32(crc32.ChecksumIEEE(key) % uint32(count))
+	default:
+		partition = t.roundRobin % count
+		t.roundRobin++
+	}
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	m := Message{
+		Topic:     topicName,
+		Partition: partition,
+		Offset:    int64(len(t.partitions[partition])),
+		Key:       copyBytes(key),
+		Value:     copyBytes(value),
+		Timestamp: timestamp,
+	}
+	t.partitions[partition] = append(t.partitions[partition], m)
+
+	close(p.notify)
+	p.notify = make(chan struct{})
+	return m, nil
+}
+
+//Messages returns the messages of the topic ordered by partition and offset
+func (p *Provider) Messages(topicName string) []Message {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	t, ok := p.topics[topicName]
+	if !ok {
+		return nil
+	}
+	var messages []Message
+	for _, partition := range t.partitions {
+		messages = append(messages, partition...)
+	}
+	return messages
+}
+
+//Watermarks returns the low and high watermark of the partition, the low watermark is always 0
+func (p *Provider) Watermarks(topicName string, partition int32) (int64, int64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	t, ok := p.topics[topicName]
+	if !ok {
+		return 0, 0, fmt.Errorf("topic not found [%s]", topicName)
+	}
+	if partition < 0 || int(partition) >= len(t.partitions) {
+		return 0, 0, fmt.Errorf("partition [%d] of topic [%s] not found", partition, topicName)
+	}
+	return 0, int64(len(t.partitions[partition])), nil
+}
+
+//Committed returns the committed offset of the group for the partition, -1 if the group committed nothing
+func (p *Provider) Committed(groupID string, topicName string, partition int32) int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	g, ok := p.groups[groupID]
+	if !ok {
+		return -1
+	}
+	offset, ok := g.committed[partitionRef{topic: topicName, partition: partition}]
+	if !ok {
+		return -1
+	}
+	return offset
+}
+
+//Commit sets the committed offset of the group for the partition, e.g. to skip messages before a consumer starts
+func (p *Provider) Commit(groupID string, topicName string, partition int32, offset int64) error {
+	if offset < 0 {
+		return fmt.Errorf("offset invalid [%d]", offset)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.getGroup(groupID).committed[partitionRef{topic: topicName, partition: partition}] = offset
+	return nil
+}
+
+//getTopic returns the topic and creates it with the default partitions if needed, the mutex must be held
+func (p *Provider) getTopic(topicName string) *topic {
+	t, ok := p.topics[topicName]
+	if !ok {
+		partitions := p.DefaultPartitions
+		if partitions <= 0 {
+			partitions = 1
+		}
+		t = &topic{name: topicName, partitions: make([][]Message, partitions)}
+		p.topics[topicName] = t
+	}
+	return t
+}
+
+//getGroup returns the group and creates it if needed, the mutex must be held
+func (p *Provider) getGroup(groupID string) *group {
+	g, ok := p.groups[groupID]
+	if !ok {
+		g = &group{committed: map[partitionRef]int64{}, members: map[string][]*Consumer{}}
+		p.groups[groupID] = g
+	}
+	return g
+}
+
+//assignment returns the partitions of the topic assigned to the consumer, the partitions are distributed round robin in join order
+//the mutex must be held
+func (p *Provider) assignment(c *Consumer) []int32 {
+	g := p.getGroup(c.GroupID)
+	members := g.members[c.Topic]
+	index := -1
+	for i, member := range members {
+		if member == c {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+	var partitions []int32
+	count := int32(len(p.getTopic(c.Topic).partitions))
+	for partition := int32(index); partition < count; partition += int32(len(members)) {
+		partitions = append(partitions, partition)
+	}
+	return partitions
+}
+
+//leave removes the consumer from its group, the partitions are assigned to the remaining members
+func (p *Provider) leave(c *Consumer) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	g := p.getGroup(c.GroupID)
+	members := g.members[c.Topic]
+	for i, member := range members {
+		if member == c {
+			g.members[c.Topic] = append(members[:i:i], members[i+1:]...)
+			break
+		}
+	}
+}
+
+func copyBytes(buffer []byte) []byte {
+	if buffer == nil {
+		return nil
+	}
+	copied := make([]byte, len(buffer))
+	copy(copied, buffer)
+	return copied
+}
@@ -0,0 +1,229 @@
+package memkafka
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+type nopHandler struct{}
+
+func (h nopHandler) Handle(context *okfwkafka.MessageContext, key []byte, value []byte) {}
+
+func TestCreateTopic(t *testing.T) {
+	p := NewProvider()
+	if err := p.CreateTopic("orders", 0); err == nil {
+		t.Errorf("partition count 0 expected error")
+	}
+	if err := p.CreateTopic("orders", 3); err != nil {
+		t.Fatalf("cannot create topic error [%v]", err)
+	}
+	if err := p.CreateTopic("orders", 3); err == nil {
+		t.Errorf("existing topic expected error")
+	}
+	if partitions, err := p.Partitions("orders"); err != nil || partitions != 3 {
+		t.Errorf("expected [3] partitions but was [%d] error [%v]", partitions, err)
+	}
+	if _, err := p.Partitions("missing"); err == nil {
+		t.Errorf("missing topic expected error")
+	}
+
+	//used topics are created with the default partitions
+	p.DefaultPartitions = 2
+	p.Produce("events", -1, nil, []byte("v"), time.Time{})
+	if partitions, _ := p.Partitions("events"); partitions != 2 {
+		t.Errorf("expected [2] default partitions but was [%d]", partitions)
+	}
+	if topics := p.Topics(); !reflect.DeepEqual(topics, []string{"events", "orders"}) {
+		t.Errorf("expected topics [events orders] but was %v", topics)
+	}
+}
+
+func TestWatermarks(t *testing.T) {
+	p := NewProvider()
+	p.CreateTopic("orders", 2)
+	for i := 0; i < 3; i++ {
+		p.Produce("orders", 1, nil, []byte("v"), time.Time{})
+	}
+	tests := []struct {
+		partition int32
+		high      int64
+	}{
+		{0, 0},
+		{1, 3},
+	}
+	for _, test := range tests {
+		low, high, err := p.Watermarks("orders", test.partition)
+		if err != nil || low != 0 || high != test.high {
+			t.Errorf("partition [%d] expected watermarks [0, %d] but was [%d, %d] error [%v]", test.partition, test.high, low, high, err)
+		}
+	}
+	if _, _, err := p.Watermarks("orders", 2); err == nil {
+		t.Errorf("missing partition expected error")
+	}
+	if _, _, err := p.Watermarks("orders", -1); err == nil {
+		t.Errorf("negative partition expected error")
+	}
+	if _, _, err := p.Watermarks("missing", 0); err == nil {
+		t.Errorf("missing topic expected error")
+	}
+	if _, err := p.Produce("orders", 2, nil, []byte("v"), time.Time{}); err == nil {
+		t.Errorf("produce to missing partition expected error")
+	}
+}
+
+func TestCommit(t *testing.T) {
+	p := NewProvider()
+	for i := 0; i < 5; i++ {
+		p.Produce("orders", 0, nil, []byte(fmt.Sprintf("%d", i)), time.Time{})
+	}
+	if offset := p.Committed("billing", "orders", 0); offset != -1 {
+		t.Errorf("group without commit expected [-1] but was [%d]", offset)
+	}
+	if err := p.Commit("billing", "orders", 0, -1); err == nil {
+		t.Errorf("negative offset expected error")
+	}
+	if err := p.Commit("billing", "orders", 0, 3); err != nil {
+		t.Fatalf("cannot commit error [%v]", err)
+	}
+	if offset := p.Committed("billing", "orders", 0); offset != 3 {
+		t.Errorf("expected committed [3] but was [%d]", offset)
+	}
+
+	//the consumer starts at the committed offset and commits after the handler
+	var values []string
+	c, _ := p.NewGroupConsumer("orders", "billing-1", "billing", handlerFunc(func(key []byte, value []byte) {
+		values = append(values, string(value))
+	}))
+	defer c.Close()
+	if backlog, _ := c.GetBacklog(); backlog != 2 {
+		t.Errorf("expected backlog [2] but was [%d]", backlog)
+	}
+	for i := 0; i < 3; i++ {
+		c.Process(0)
+	}
+	if !reflect.DeepEqual(values, []string{"3", "4"}) || p.Committed("billing", "orders", 0) != 5 {
+		t.Errorf("expected values [3 4] and committed [5] but was %v and [%d]", values, p.Committed("billing", "orders", 0))
+	}
+
+	//a commit back in time replays the messages, the consumer does not move it forward again
+	p.Commit("billing", "orders", 0, 4)
+	c.Process(0)
+	if len(values) != 3 || values[2] != "4" {
+		t.Errorf("expected replay of value [4] but was %v", values)
+	}
+}
+
+type handlerFunc func(key []byte, value []byte)
+
+func (f handlerFunc) Handle(context *okfwkafka.MessageContext, key []byte, value []byte) {
+	f(key, value)
+}
+
+func TestGroupAssignment(t *testing.T) {
+	p := NewProvider()
+	p.CreateTopic("orders", 5)
+	var consumers []*Consumer
+	for i := 0; i < 3; i++ {
+		c, err := p.NewGroupConsumer("orders", fmt.Sprintf("c%d", i), "billing", nopHandler{})
+		if err != nil {
+			t.Fatalf("cannot create consumer error [%v]", err)
+		}
+		consumers = append(consumers, c)
+	}
+	other, _ := p.NewGroupConsumer("orders", "other", "audit", nopHandler{})
+	defer other.Close()
+
+	expectAssignment := func(expected ...[]int32) {
+		t.Helper()
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		for i, partitions := range expected {
+			if actual := p.assignment(consumers[i]); !reflect.DeepEqual(actual, partitions) {
+				t.Errorf("consumer [%d] expected partitions %v but was %v", i, partitions, actual)
+			}
+		}
+		if actual := p.assignment(other); !reflect.DeepEqual(actual, []int32{0, 1, 2, 3, 4}) {
+			t.Errorf("consumer of other group expected all partitions but was %v", actual)
+		}
+	}
+	expectAssignment([]int32{0, 3}, []int32{1, 4}, []int32{2})
+
+	//the remaining members share the partitions of the leaving member in join order
+	consumers[1].Close()
+	expectAssignment([]int32{0, 2, 4}, nil, []int32{1, 3})
+	consumers[0].Close()
+	expectAssignment(nil, nil, []int32{0, 1, 2, 3, 4})
+	consumers[0].Close()
+	expectAssignment(nil, nil, []int32{0, 1, 2, 3, 4})
+
+	for partition := int32(0); partition < 5; partition++ {
+		p.Produce("orders", partition, nil, []byte("v"), time.Time{})
+	}
+	for i := 0; i < 5; i++ {
+		consumers[2].Process(0)
+	}
+	if backlog, _ := consumers[2].GetBacklog(); backlog != 0 || consumers[2].DeliveredCount != 5 {
+		t.Errorf("remaining member expected to consume all partitions but backlog was [%d] delivered [%d]", backlog, consumers[2].DeliveredCount)
+	}
+	consumers[2].Close()
+	if err := consumers[2].Process(0); err == nil {
+		t.Errorf("process of closed consumer expected error")
+	}
+}
+
+func TestKeyPartitionMatchesLibrdkafka(t *testing.T) {
+	cluster, err := kafka.NewMockCluster(1)
+	if err != nil {
+		t.Fatalf("cannot create mock cluster error [%v]", err)
+	}
+	defer cluster.Close()
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": cluster.BootstrapServers(), "partitioner": "consistent_random"})
+	if err != nil {
+		t.Fatalf("cannot create producer error [%v]", err)
+	}
+	defer producer.Close()
+
+	//the mock cluster creates the topic with its default partition count
+	topic := "keys"
+	metadata, err := producer.GetMetadata(&topic, false, 10000)
+	if err != nil || len(metadata.Topics[topic].Partitions) < 2 {
+		t.Fatalf("cannot create topic with several partitions error [%v]", err)
+	}
+	p := NewProvider()
+	p.CreateTopic(topic, int32(len(metadata.Topics[topic].Partitions)))
+
+	deliveries := make(chan kafka.Event, 1)
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		err = producer.Produce(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny}, Key: key}, deliveries)
+		if err != nil {
+			t.Fatalf("cannot produce error [%v]", err)
+		}
+		delivered := (<-deliveries).(*kafka.Message)
+		if delivered.TopicPartition.Error != nil {
+			t.Fatalf("cannot deliver error [%v]", delivered.TopicPartition.Error)
+		}
+		m, _ := p.Produce(topic, -1, key, nil, time.Time{})
+		if m.Partition != delivered.TopicPartition.Partition {
+			t.Errorf("key [%s] expected partition [%d] of librdkafka but was [%d]", key, delivered.TopicPartition.Partition, m.Partition)
+		}
+	}
+}
+
+func TestProduceWithoutKey(t *testing.T) {
+	p := NewProvider()
+	p.CreateTopic("orders", 3)
+	var actual []int32
+	for _, key := range [][]byte{nil, {}, nil, {}} {
+		m, _ := p.Produce("orders", -1, key, []byte("v"), time.Time{})
+		actual = append(actual, m.Partition)
+	}
+	if !reflect.DeepEqual(actual, []int32{0, 1, 2, 0}) {
+		t.Errorf("messages without key expected to take turns but were %v", actual)
+	}
+}
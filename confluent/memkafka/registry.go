@@ -0,0 +1,118 @@
+package memkafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//LatestVersion selects the latest version of a subject like the schema registry
+const LatestVersion = -1
+
+//SchemaResolver is an in-memory schema registry
+//schemas get global ids, the same schema registered under several subjects keeps its id
+type SchemaResolver struct {
+	mutex    sync.Mutex
+	subjects map[string][]int
+	schemas  map[int]string
+	ids      map[string]int
+}
+
+//NewSchemaResolver creates an empty schema registry
+func NewSchemaResolver() *SchemaResolver {
+	return &SchemaResolver{
+		subjects: map[string][]int{},
+		schemas:  map[int]string{},
+		ids:      map[string]int{},
+	}
+}
+
+//GetSchemaBySubject returns the schema id of the subject version, versions start at 1
+func (r *SchemaResolver) GetSchemaBySubject(subject string, version int) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	versions, ok := r.subjects[subject]
+	if !ok {
+		return 0, fmt.Errorf("subject not found [%s]", subject)
+	}
+	if version == LatestVersion {
+		version = len(versions)
+	}
+	if version < 1 || version > len(versions) {
+		return 0, fmt.Errorf("version [%d] of subject [%s] not found", version, subject)
+	}
+	return versions[version-1], nil
+}
+
+//RegisterNewSchema registers the schema as next version of the subject, registering a schema of the subject again returns its id
+func (r *SchemaResolver) RegisterNewSchema(subject string, content string) (int, error) {
+	if subject == "" {
+		return 0, fmt.Errorf("subject missing")
+	}
+	normalized, err := normalizeSchema(content)
+	if err != nil {
+		return 0, fmt.Errorf("schema of subject [%s] invalid error [%v]", subject, err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	id, ok := r.ids[normalized]
+	if !ok {
+		id = len(r.schemas) + 1
+		r.ids[normalized] = id
+		r.schemas[id] = content
+	}
+	versions := r.subjects[subject]
+	for _, registered := range versions {
+		if registered == id {
+			return id, nil
+		}
+	}
+	r.subjects[subject] = append(versions, id)
+	return id, nil
+}
+
+//GetSchemaByID returns the schema of the id
+func (r *SchemaResolver) GetSchemaByID(id int) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	schema, ok := r.schemas[id]
+	if !ok {
+		return "", fmt.Errorf("schema id not found [%d]", id)
+	}
+	return schema, nil
+}
+
+//Subjects returns the registered subjects
+func (r *SchemaResolver) Subjects() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	subjects := make([]string, 0, len(r.subjects))
+	for subject := range r.subjects {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+//Versions returns the number of versions of the subject
+func (r *SchemaResolver) Versions(subject string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.subjects[subject])
+}
+
+//normalizeSchema compacts the json of the schema so formatting does not create new ids
+func normalizeSchema(content string) (string, error) {
+	var schema interface{}
+	err := json.Unmarshal([]byte(content), &schema)
+	if err != nil {
+		return "", err
+	}
+	normalized, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+	return string(normalized), nil
+}
@@ -0,0 +1,65 @@
+package memkafka
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaResolverIDs(t *testing.T) {
+	r := NewSchemaResolver()
+	user := `{"type": "record", "name": "user", "fields": [{"name": "id", "type": "long"}]}`
+	compact := `{"type":"record","name":"user","fields":[{"name":"id","type":"long"}]}`
+
+	id, err := r.RegisterNewSchema("users-value", user)
+	if err != nil || id != 1 {
+		t.Fatalf("first schema expected id [1] but was [%d] error [%v]", id, err)
+	}
+	//the same schema keeps its id in the subject and in other subjects, whatever the formatting
+	for _, subject := range []string{"users-value", "archive-value"} {
+		if id, _ := r.RegisterNewSchema(subject, compact); id != 1 {
+			t.Errorf("subject [%s] expected id [1] for the same schema but was [%d]", subject, id)
+		}
+	}
+	if r.Versions("users-value") != 1 || r.Versions("archive-value") != 1 {
+		t.Errorf("registering the schema again expected no new version but versions were [%d] and [%d]", r.Versions("users-value"), r.Versions("archive-value"))
+	}
+	if schema, _ := r.GetSchemaByID(1); schema != user {
+		t.Errorf("schema of id [1] expected as first registered but was [%s]", schema)
+	}
+
+	id, _ = r.RegisterNewSchema("users-value", `"string"`)
+	if id != 2 || r.Versions("users-value") != 2 {
+		t.Errorf("new schema expected id [2] as version [2] but was [%d] with [%d] versions", id, r.Versions("users-value"))
+	}
+	tests := []struct {
+		version int
+		id      int
+	}{
+		{1, 1},
+		{2, 2},
+		{LatestVersion, 2},
+	}
+	for _, test := range tests {
+		if id, err := r.GetSchemaBySubject("users-value", test.version); err != nil || id != test.id {
+			t.Errorf("version [%d] expected id [%d] but was [%d] error [%v]", test.version, test.id, id, err)
+		}
+	}
+	if _, err := r.GetSchemaBySubject("users-value", 3); err == nil {
+		t.Errorf("missing version expected error")
+	}
+	if _, err := r.GetSchemaBySubject("missing", LatestVersion); err == nil {
+		t.Errorf("missing subject expected error")
+	}
+	if _, err := r.GetSchemaByID(3); err == nil {
+		t.Errorf("missing id expected error")
+	}
+	if _, err := r.RegisterNewSchema("users-value", `{`); err == nil {
+		t.Errorf("invalid schema expected error")
+	}
+	if _, err := r.RegisterNewSchema("", `"string"`); err == nil {
+		t.Errorf("missing subject expected error")
+	}
+	if subjects := r.Subjects(); !reflect.DeepEqual(subjects, []string{"archive-value", "users-value"}) {
+		t.Errorf("expected subjects [archive-value users-value] but was %v", subjects)
+	}
+}
@@ -0,0 +1,214 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//metadataClient is implemented by the kafka producer, consumer and admin client
+type metadataClient interface {
+	GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error)
+}
+
+//ClusterMetadata holds the brokers and topics of the cluster
+type ClusterMetadata struct {
+	Brokers           []BrokerInfo
+	Topics            map[string]TopicInfo
+	OriginatingBroker BrokerInfo
+}
+
+//BrokerInfo describes a broker
+type BrokerInfo struct {
+	ID   int32
+	Host string
+	Port int
+}
+
+//TopicInfo describes a topic and its partitions
+type TopicInfo struct {
+	Topic      string
+	Partitions []PartitionInfo
+	Error      error
+}
+
+//PartitionInfo describes the leader and replicas of a partition
+type PartitionInfo struct {
+	ID       int32
+	Leader   int32
+	Replicas []int32
+	ISR      []int32
+	Error    error
+}
+
+//PartitionRef references a topic partition
+type PartitionRef struct {
+	Topic     string
+	Partition int32
+}
+
+func (r PartitionRef) String() string {
+	return fmt.Sprintf("%s[%d]", r.Topic, r.Partition)
+}
+
+//getClusterMetadata queries the metadata of the topics or of all topics if none are given
+func getClusterMetadata(ctx context.Context, client metadataClient, topics ...string) (*ClusterMetadata, error) {
+	timeoutMs := metadataTimeoutMs
+	if deadline, ok := ctx.Deadline(); ok {
+		timeoutMs = int(time.Until(deadline) / time.Millisecond)
+		if timeoutMs <= 0 {
+			return nil, fmt.Errorf("cannot get cluster metadata error [%v]", context.DeadlineExceeded)
+		}
+	}
+
+	var topic *string
+	if len(topics) == 1 {
+		topic = &topics[0]
+	}
+	metadata, err := client.GetMetadata(topic, topic == nil, timeoutMs)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cluster metadata error [%v]", err)
+	}
+
+	cluster := newClusterMetadata(metadata)
+	if len(topics) > 0 {
+		requested := map[string]TopicInfo{}
+		for _, name := range topics {
+			info, ok := cluster.Topics[name]
+			if !ok {
+				info = TopicInfo{Topic: name, Error: fmt.Errorf("topic not in metadata [%s]", name)}
+			}
+			requested[name] = info
+		}
+		cluster.Topics = requested
+	}
+	return cluster, nil
+}
+
+func newClusterMetadata(metadata *kafka.Metadata) *ClusterMetadata {
+	cluster := &ClusterMetadata{
+		Topics:            map[string]TopicInfo{},
+		OriginatingBroker: BrokerInfo(metadata.OriginatingBroker),
+	}
+	for _, broker := range metadata.Brokers {
+		cluster.Brokers = append(cluster.Brokers, BrokerInfo(broker))
+	}
+	sort.Slice(cluster.Brokers, func(i, j int) bool { return cluster.Brokers[i].ID < cluster.Brokers[j].ID })
+
+	for name, topic := range metadata.Topics {
+		info := TopicInfo{Topic: name, Error: metadataError(topic.Error)}
+		for _, partition := range topic.Partitions {
+			info.Partitions = append(info.Partitions, PartitionInfo{
+				ID:       partition.ID,
+				Leader:   partition.Leader,
+				Replicas: partition.Replicas,
+				ISR:      partition.Isrs,
+				Error:    metadataError(partition.Error),
+			})
+		}
+		sort.Slice(info.Partitions, func(i, j int) bool { return info.Partitions[i].ID < info.Partitions[j].ID })
+		cluster.Topics[name] = info
+	}
+	return cluster
+}
+
+func metadataError(err kafka.Error) error {
+	if err.Code() == kafka.ErrNoError {
+		return nil
+	}
+	return err
+}
+
+//UnderReplicated returns true if not all replicas are in sync
+func (p PartitionInfo) UnderReplicated() bool {
+	return len(p.ISR) < len(p.Replicas)
+}
+
+//Offline returns true if the partition has no leader
+func (p PartitionInfo) Offline() bool {
+	return p.Leader < 0
+}
+
+//UnderReplicatedPartitions returns the partitions with replicas out of sync
+func (m *ClusterMetadata) UnderReplicatedPartitions() []PartitionRef {
+	return m.selectPartitions(PartitionInfo.UnderReplicated)
+}
+
+//OfflinePartitions returns the partitions without leader
+func (m *ClusterMetadata) OfflinePartitions() []PartitionRef {
+	return m.selectPartitions(PartitionInfo.Offline)
+}
+
+func (m *ClusterMetadata) selectPartitions(selector func(PartitionInfo) bool) []PartitionRef {
+	var refs []PartitionRef
+	for _, name := range m.topicNames() {
+		for _, partition := range m.Topics[name].Partitions {
+			if selector(partition) {
+				refs = append(refs, PartitionRef{Topic: name, Partition: partition.ID})
+			}
+		}
+	}
+	return refs
+}
+
+func (m *ClusterMetadata) topicNames() []string {
+	names := make([]string, 0, len(m.Topics))
+	for name := range m.Topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//CheckTopics returns an error if a topic is missing or has partitions with errors, offline or under replicated partitions
+func (m *ClusterMetadata) CheckTopics(topics ...string) error {
+	var problems []string
+	for _, name := range topics {
+		info, ok := m.Topics[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("topic [%s] missing", name))
+			continue
+		case info.Error != nil:
+			problems = append(problems, fmt.Sprintf("topic [%s] error [%v]", name, info.Error))
+			continue
+		case len(info.Partitions) == 0:
+			problems = append(problems, fmt.Sprintf("topic [%s] has no partitions", name))
+		}
+		for _, partition := range info.Partitions {
+			switch {
+			case partition.Error != nil:
+				problems = append(problems, fmt.Sprintf("partition [%s[%d]] error [%v]", name, partition.ID, partition.Error))
+			case partition.Offline():
+				problems = append(problems, fmt.Sprintf("partition [%s[%d]] offline", name, partition.ID))
+			case partition.UnderReplicated():
+				problems = append(problems, fmt.Sprintf("partition [%s[%d]] under replicated isr %v replicas %v", name, partition.ID, partition.ISR, partition.Replicas))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("topics unhealthy [%s]", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+//GetClusterMetadata returns the metadata of the topics or of all topics if none are given
+func (a *TopicAdmin) GetClusterMetadata(ctx context.Context, topics ...string) (*ClusterMetadata, error) {
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+	return getClusterMetadata(ctx, a.AdminClient, topics...)
+}
+
+//GetClusterMetadata returns the metadata of the topics or of all topics if none are given
+func (tp *TopicProducer) GetClusterMetadata(ctx context.Context, topics ...string) (*ClusterMetadata, error) {
+	return getClusterMetadata(ctx, tp.Producer, topics...)
+}
+
+//GetClusterMetadata returns the metadata of the topics or of all topics if none are given
+func (kc *MessageConsumer) GetClusterMetadata(ctx context.Context, topics ...string) (*ClusterMetadata, error) {
+	return getClusterMetadata(ctx, kc.Consumer, topics...)
+}
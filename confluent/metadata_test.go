@@ -0,0 +1,158 @@
+package confluent
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//fakeMetadataClient returns the metadata and records the requests
+type fakeMetadataClient struct {
+	metadata  kafka.Metadata
+	err       error
+	topic     *string
+	allTopics bool
+	timeoutMs int
+}
+
+func (c *fakeMetadataClient) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	c.topic, c.allTopics, c.timeoutMs = topic, allTopics, timeoutMs
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &c.metadata, nil
+}
+
+func testKafkaMetadata() kafka.Metadata {
+	return kafka.Metadata{
+		Brokers:           []kafka.BrokerMetadata{{ID: 3, Host: "b3", Port: 9092}, {ID: 1, Host: "b1", Port: 9092}},
+		OriginatingBroker: kafka.BrokerMetadata{ID: 1, Host: "b1", Port: 9092},
+		Topics: map[string]kafka.TopicMetadata{
+			"orders": {Topic: "orders", Partitions: []kafka.PartitionMetadata{
+				{ID: 1, Leader: 3, Replicas: []int32{3, 1}, Isrs: []int32{3}},
+				{ID: 0, Leader: 1, Replicas: []int32{1, 3}, Isrs: []int32{1, 3}},
+				{ID: 2, Leader: -1, Replicas: []int32{1, 3}, Isrs: []int32{}, Error: kafka.NewError(kafka.ErrLeaderNotAvailable, "Broker: Leader not available", false)},
+			}},
+			"missing": {Topic: "missing", Error: kafka.NewError(kafka.ErrUnknownTopicOrPart, "Broker: Unknown topic or partition", false)},
+		},
+	}
+}
+
+func TestNewClusterMetadata(t *testing.T) {
+	metadata := testKafkaMetadata()
+	cluster := newClusterMetadata(&metadata)
+
+	expectedBrokers := []BrokerInfo{{ID: 1, Host: "b1", Port: 9092}, {ID: 3, Host: "b3", Port: 9092}}
+	if !reflect.DeepEqual(cluster.Brokers, expectedBrokers) || cluster.OriginatingBroker != expectedBrokers[0] {
+		t.Errorf("expected brokers %v sorted by id but was %v from %v", expectedBrokers, cluster.Brokers, cluster.OriginatingBroker)
+	}
+	orders := cluster.Topics["orders"]
+	if orders.Error != nil || len(orders.Partitions) != 3 {
+		t.Fatalf("expected topic orders with 3 partitions but was %+v", orders)
+	}
+	for i, partition := range orders.Partitions {
+		if partition.ID != int32(i) {
+			t.Errorf("partitions expected sorted by id but [%d] was [%d]", i, partition.ID)
+		}
+	}
+	if partition := orders.Partitions[1]; partition.Leader != 3 || !reflect.DeepEqual(partition.ISR, []int32{3}) || partition.Error != nil {
+		t.Errorf("unexpected partition [1] %+v", partition)
+	}
+	if partition := orders.Partitions[2]; partition.Error == nil || partition.Error.(kafka.Error).Code() != kafka.ErrLeaderNotAvailable {
+		t.Errorf("partition [2] expected leader not available but was [%v]", partition.Error)
+	}
+	if missing := cluster.Topics["missing"]; missing.Error == nil || missing.Error.(kafka.Error).Code() != kafka.ErrUnknownTopicOrPart {
+		t.Errorf("topic missing expected unknown topic but was [%v]", missing.Error)
+	}
+
+	under := cluster.UnderReplicatedPartitions()
+	if !reflect.DeepEqual(under, []PartitionRef{{Topic: "orders", Partition: 1}, {Topic: "orders", Partition: 2}}) {
+		t.Errorf("unexpected under replicated partitions %v", under)
+	}
+	if offline := cluster.OfflinePartitions(); !reflect.DeepEqual(offline, []PartitionRef{{Topic: "orders", Partition: 2}}) {
+		t.Errorf("unexpected offline partitions %v", offline)
+	}
+}
+
+func TestCheckTopics(t *testing.T) {
+	leaderNotAvailable := kafka.NewError(kafka.ErrLeaderNotAvailable, "Broker: Leader not available", false)
+	healthy := PartitionInfo{ID: 0, Leader: 1, Replicas: []int32{1, 2}, ISR: []int32{1, 2}}
+	tests := []struct {
+		name     string
+		info     TopicInfo
+		problems []string
+	}{
+		{"healthy", TopicInfo{Partitions: []PartitionInfo{healthy}}, nil},
+		{"topic error", TopicInfo{Error: kafka.NewError(kafka.ErrUnknownTopicOrPart, "Broker: Unknown topic or partition", false)}, []string{"topic [topic error] error [Broker: Unknown topic or partition]"}},
+		{"no partitions", TopicInfo{}, []string{"topic [no partitions] has no partitions"}},
+		{"partition error", TopicInfo{Partitions: []PartitionInfo{healthy, {ID: 1, Leader: 1, Replicas: []int32{1}, ISR: []int32{1}, Error: leaderNotAvailable}}}, []string{"partition [partition error[1]] error [Broker: Leader not available]"}},
+		{"offline", TopicInfo{Partitions: []PartitionInfo{{ID: 0, Leader: -1, Replicas: []int32{1}, ISR: []int32{}}}}, []string{"partition [offline[0]] offline"}},
+		{"under replicated", TopicInfo{Partitions: []PartitionInfo{{ID: 0, Leader: 1, Replicas: []int32{1, 2}, ISR: []int32{1}}}}, []string{"partition [under replicated[0]] under replicated isr [1] replicas [1 2]"}},
+	}
+	for _, test := range tests {
+		test.info.Topic = test.name
+		metadata := &ClusterMetadata{Topics: map[string]TopicInfo{test.name: test.info}}
+		err := metadata.CheckTopics(test.name)
+		if test.problems == nil {
+			if err != nil {
+				t.Errorf("topic [%s] expected healthy but was [%v]", test.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("topic [%s] expected problems %v", test.name, test.problems)
+			continue
+		}
+		for _, problem := range test.problems {
+			if !strings.Contains(err.Error(), problem) {
+				t.Errorf("topic [%s] expected problem [%s] but was [%v]", test.name, problem, err)
+			}
+		}
+	}
+
+	metadata := &ClusterMetadata{Topics: map[string]TopicInfo{"orders": {Topic: "orders", Partitions: []PartitionInfo{healthy}}}}
+	err := metadata.CheckTopics("orders", "absent")
+	if err == nil || !strings.Contains(err.Error(), "topic [absent] missing") || strings.Contains(err.Error(), "orders") {
+		t.Errorf("only the absent topic expected missing but was [%v]", err)
+	}
+}
+
+func TestGetClusterMetadata(t *testing.T) {
+	client := &fakeMetadataClient{metadata: testKafkaMetadata()}
+	cluster, err := getClusterMetadata(context.Background(), client)
+	if err != nil || !client.allTopics || client.topic != nil || client.timeoutMs != metadataTimeoutMs || len(cluster.Topics) != 2 {
+		t.Errorf("all topics expected with the default timeout but was all [%t] timeout [%d] topics [%d] error [%v]", client.allTopics, client.timeoutMs, len(cluster.Topics), err)
+	}
+
+	//requested topics are the only topics, topics not in the metadata get an error
+	cluster, err = getClusterMetadata(context.Background(), client, "orders")
+	if err != nil || client.allTopics || client.topic == nil || *client.topic != "orders" || len(cluster.Topics) != 1 {
+		t.Errorf("only topic orders expected but was %v error [%v]", cluster, err)
+	}
+	cluster, _ = getClusterMetadata(context.Background(), client, "orders", "absent")
+	if client.topic != nil || len(cluster.Topics) != 2 || cluster.Topics["absent"].Error == nil {
+		t.Errorf("absent topic expected an error but was %+v", cluster.Topics["absent"])
+	}
+
+	//the deadline of the context limits the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	getClusterMetadata(ctx, client)
+	if client.timeoutMs <= 0 || client.timeoutMs > 1000 {
+		t.Errorf("timeout expected from the deadline but was [%d]", client.timeoutMs)
+	}
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+	if _, err := getClusterMetadata(expired, client); err == nil {
+		t.Errorf("expired context expected error")
+	}
+
+	client.err = kafka.NewError(kafka.ErrTransport, "Local: Broker transport failure", false)
+	if _, err := getClusterMetadata(context.Background(), client); err == nil || !strings.Contains(err.Error(), "transport failure") {
+		t.Errorf("metadata error expected but was [%v]", err)
+	}
+}
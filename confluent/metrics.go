@@ -0,0 +1,437 @@
+package confluent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//metricsContentType is the prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+//DefaultLatencyBuckets are the upper bounds in seconds of the latency histograms
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	metricProduced       = "okfw_kafka_produced_total"
+	metricProduceFailed  = "okfw_kafka_produce_failed_total"
+	metricInFlight       = "okfw_kafka_producer_in_flight"
+	metricDeliveryTime   = "okfw_kafka_delivery_latency_seconds"
+	metricConsumed       = "okfw_kafka_consumed_total"
+	metricPollErrors     = "okfw_kafka_poll_errors_total"
+	metricConsumerLag    = "okfw_kafka_consumer_lag"
+	metricLagQueryErrors = "okfw_kafka_consumer_lag_errors_total"
+	metricEndToEndTime   = "okfw_kafka_end_to_end_latency_seconds"
+	metricHandlingTime   = "okfw_kafka_handling_latency_seconds"
+
+	metricOutboxPending      = "okfw_kafka_outbox_pending_messages"
+	metricOutboxPendingBytes = "okfw_kafka_outbox_pending_bytes"
+	metricOutboxRetrying     = "okfw_kafka_outbox_retrying_messages"
+	metricOutboxSegments     = "okfw_kafka_outbox_segments"
+	metricOutboxDiskBytes    = "okfw_kafka_outbox_disk_bytes"
+	metricOutboxJournaled    = "okfw_kafka_outbox_journaled_total"
+	metricOutboxAcknowledged = "okfw_kafka_outbox_acknowledged_total"
+
+	metricClientQueue    = "okfw_kafka_client_queue_messages"
+	metricClientTxMsgs   = "okfw_kafka_client_tx_messages_total"
+	metricClientRxMsgs   = "okfw_kafka_client_rx_messages_total"
+	metricBrokerRtt      = "okfw_kafka_broker_rtt_seconds"
+	metricBrokerThrottle = "okfw_kafka_broker_throttle_seconds"
+	metricBrokerRetries  = "okfw_kafka_broker_retries_total"
+	metricPartitionQueue = "okfw_kafka_partition_queue_messages"
+	metricPartitionLag   = "okfw_kafka_partition_consumer_lag"
+)
+
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+//metricHelp is the help text of the exported metrics
+var metricHelp = map[string]string{
+	metricProduced:       "Messages acknowledged by the broker.",
+	metricProduceFailed:  "Messages not enqueued or not acknowledged by the broker.",
+	metricInFlight:       "Messages enqueued but not yet acknowledged.",
+	metricDeliveryTime:   "Time from enqueueing a message until its delivery report.",
+	metricConsumed:       "Messages passed to the handler.",
+	metricPollErrors:     "Errors returned by the consumer poll.",
+	metricConsumerLag:    "Messages between the committed offset and the high watermark of the partition.",
+	metricLagQueryErrors: "Failed lag queries.",
+	metricEndToEndTime:   "Time from the message timestamp until the consumer received the message.",
+	metricHandlingTime:   "Time from receiving a message until the handler returned.",
+
+	metricOutboxPending:      "Messages in the outbox not yet acknowledged by the broker.",
+	metricOutboxPendingBytes: "Bytes of the messages in the outbox not yet acknowledged.",
+	metricOutboxRetrying:     "Messages in the outbox waiting to be sent again after a failed delivery.",
+	metricOutboxSegments:     "Segment files of the outbox.",
+	metricOutboxDiskBytes:    "Bytes of the outbox segment files.",
+	metricOutboxJournaled:    "Messages journaled in the outbox since it was opened.",
+	metricOutboxAcknowledged: "Messages removed from the outbox after their delivery since it was opened.",
+
+	metricClientQueue:    "Messages in the librdkafka queues (statistics).",
+	metricClientTxMsgs:   "Messages sent to the brokers (statistics).",
+	metricClientRxMsgs:   "Messages received from the brokers (statistics).",
+	metricBrokerRtt:      "Average broker round trip time (statistics).",
+	metricBrokerThrottle: "Average broker throttle time (statistics).",
+	metricBrokerRetries:  "Request retries to the broker (statistics).",
+	metricPartitionQueue: "Messages waiting in the producer queue of the partition (statistics).",
+	metricPartitionLag:   "Consumer lag of the partition seen by librdkafka (statistics).",
+}
+
+//Metrics collects the metrics of registered producers and consumers and exposes them in the prometheus text format
+type Metrics struct {
+	buckets    []float64
+	mutex      sync.Mutex
+	families   map[string]*metricFamily
+	collectors []func(ctx context.Context)
+}
+
+type metricFamily struct {
+	name   string
+	kind   string
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels  string
+	value   float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+//NewMetrics creates an empty metrics registry, the histograms use the bucket upper bounds in seconds or DefaultLatencyBuckets if none are given
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	bounds := make([]float64, len(buckets))
+	copy(bounds, buckets)
+	sort.Float64s(bounds)
+	return &Metrics{
+		buckets:  bounds,
+		families: map[string]*metricFamily{},
+	}
+}
+
+//RegisterProducer exports the delivery counters, the delivery latency and the in-flight messages of the producer
+//the latest librdkafka statistics are exported if enabled with SetStatisticsInterval, the outbox depth if enabled with EnableOutbox
+func (m *Metrics) RegisterProducer(tp *TopicProducer) {
+	tp.metrics.Store(m)
+	m.addCollector(func(ctx context.Context) {
+		m.setGauge(metricInFlight, float64(tp.GetInFlightCount()), "client_id", tp.ClientID)
+		m.collectStats(tp.ClientID, tp.GetStats())
+		if tp.getOutbox() != nil {
+			m.collectOutbox(tp.ClientID, tp.GetOutboxStats())
+		}
+	})
+}
+
+//getMetrics returns the registered metrics, the delivery reports read them concurrently to the registration
+func (tp *TopicProducer) getMetrics() *Metrics {
+	m, _ := tp.metrics.Load().(*Metrics)
+	return m
+}
+
+//collectOutbox exports the outbox depth and counters
+func (m *Metrics) collectOutbox(clientID string, stats OutboxStats) {
+	m.setGauge(metricOutboxPending, float64(stats.PendingMessages), "client_id", clientID)
+	m.setGauge(metricOutboxPendingBytes, float64(stats.PendingBytes), "client_id", clientID)
+	m.setGauge(metricOutboxRetrying, float64(stats.Retrying), "client_id", clientID)
+	m.setGauge(metricOutboxSegments, float64(stats.Segments), "client_id", clientID)
+	m.setGauge(metricOutboxDiskBytes, float64(stats.DiskBytes), "client_id", clientID)
+	m.setValue(metricOutboxJournaled, metricCounter, float64(stats.Journaled), "client_id", clientID)
+	m.setValue(metricOutboxAcknowledged, metricCounter, float64(stats.Acknowledged), "client_id", clientID)
+}
+
+//RegisterConsumer exports the consumed messages, the poll errors and the partition lag of the consumer
+//the latest librdkafka statistics are exported if enabled with SetStatisticsInterval
+//the lag is queried with the backlog timeout of the consumer, scrapes within the lag cache ttl keep the last lag
+func (m *Metrics) RegisterConsumer(kc *MessageConsumer) {
+	m.registerConsumer(kc, func(ctx context.Context) (*BacklogReport, error) {
+		ctx, cancel := context.WithTimeout(ctx, kc.BacklogTimeout)
+		defer cancel()
+		return kc.GetBacklogReport(ctx)
+	})
+}
+
+//getMetrics returns the registered metrics, the consumer reads them concurrently to the registration
+func (kc *MessageConsumer) getMetrics() *Metrics {
+	m, _ := kc.metrics.Load().(*Metrics)
+	return m
+}
+
+func (m *Metrics) registerConsumer(kc *MessageConsumer, backlog func(ctx context.Context) (*BacklogReport, error)) {
+	kc.metrics.Store(m)
+	var lagMutex sync.Mutex
+	var lagQueried time.Time
+	m.addCollector(func(ctx context.Context) {
+		m.collectStats(kc.ClientID, kc.GetStats())
+		//concurrent scrapes wait for the running query and keep its lag
+		lagMutex.Lock()
+		defer lagMutex.Unlock()
+		if !lagQueried.IsZero() && time.Since(lagQueried) < getLagCacheTTL() {
+			return
+		}
+		report, err := backlog(ctx)
+		lagQueried = time.Now()
+		if err != nil {
+			m.addCounter(metricLagQueryErrors, 1, "client_id", kc.ClientID, "group", kc.GroupID)
+			return
+		}
+		//partitions revoked by a rebalance are not in the report and their lag is removed
+		assigned := map[string]bool{}
+		for _, partition := range report.Partitions {
+			labels := []string{"client_id", kc.ClientID, "group", kc.GroupID, "topic", partition.Topic, "partition", strconv.Itoa(int(partition.Partition))}
+			assigned[formatLabels(labels)] = true
+			if partition.Error != nil {
+				m.addCounter(metricLagQueryErrors, 1, "client_id", kc.ClientID, "group", kc.GroupID)
+				continue
+			}
+			m.setGauge(metricConsumerLag, float64(partition.Lag), labels...)
+		}
+		m.removeSeries(metricConsumerLag, assigned, "client_id", kc.ClientID, "group", kc.GroupID)
+	})
+}
+
+//collectStats exports the snapshot of the librdkafka statistics
+func (m *Metrics) collectStats(clientID string, stats *ClientStats) {
+	if stats == nil {
+		return
+	}
+	m.setGauge(metricClientQueue, float64(stats.QueueMsgs), "client_id", clientID)
+	m.setValue(metricClientTxMsgs, metricCounter, float64(stats.TxMsgs), "client_id", clientID)
+	m.setValue(metricClientRxMsgs, metricCounter, float64(stats.RxMsgs), "client_id", clientID)
+	for _, broker := range stats.Brokers {
+		m.setGauge(metricBrokerRtt, float64(broker.RttMicros.Avg)/1e6, "client_id", clientID, "broker", broker.Name)
+		m.setGauge(metricBrokerThrottle, float64(broker.ThrottleMillis.Avg)/1e3, "client_id", clientID, "broker", broker.Name)
+		m.setValue(metricBrokerRetries, metricCounter, float64(broker.TxRetries), "client_id", clientID, "broker", broker.Name)
+	}
+	for _, topic := range stats.Topics {
+		for _, partition := range topic.Partitions {
+			if partition.Partition < 0 {
+				//internal partition of messages without partition yet
+				continue
+			}
+			labels := []string{"client_id", clientID, "topic", topic.Topic, "partition", strconv.Itoa(int(partition.Partition))}
+			if stats.Type == "producer" {
+				m.setGauge(metricPartitionQueue, float64(partition.QueueMsgs+partition.XmitQueueMsgs), labels...)
+			} else if partition.ConsumerLag >= 0 {
+				m.setGauge(metricPartitionLag, float64(partition.ConsumerLag), labels...)
+			}
+		}
+	}
+}
+
+func (m *Metrics) addCollector(collector func(ctx context.Context)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.collectors = append(m.collectors, collector)
+}
+
+//producerDelivered records the delivery report of a message
+func (m *Metrics) producerDelivered(tp *TopicProducer, topic string, sent time.Time, err error) {
+	if err != nil {
+		m.addCounter(metricProduceFailed, 1, "client_id", tp.ClientID, "topic", topic)
+	} else {
+		m.addCounter(metricProduced, 1, "client_id", tp.ClientID, "topic", topic)
+	}
+	if !sent.IsZero() {
+		m.observe(metricDeliveryTime, time.Since(sent).Seconds(), "client_id", tp.ClientID, "topic", topic)
+	}
+}
+
+//producerFailed records a message that could not be enqueued
+func (m *Metrics) producerFailed(tp *TopicProducer, topic string) {
+	m.addCounter(metricProduceFailed, 1, "client_id", tp.ClientID, "topic", topic)
+}
+
+//consumed records a message passed to the handler
+func (m *Metrics) consumed(kc *MessageConsumer, topic string) {
+	m.addCounter(metricConsumed, 1, "client_id", kc.ClientID, "group", kc.GroupID, "topic", topic)
+}
+
+//consumerLatency records the latencies of a handled message, the end to end latency only if the message has a timestamp
+//the histograms are exported per topic to bound the series, GetLatency has the partitions
+func (m *Metrics) consumerLatency(kc *MessageConsumer, topic string, endToEnd time.Duration, hasEndToEnd bool, handling time.Duration) {
+	labels := []string{"client_id", kc.ClientID, "group", kc.GroupID, "topic", topic}
+	if hasEndToEnd {
+		m.observe(metricEndToEndTime, math.Max(endToEnd.Seconds(), 0), labels...)
+	}
+	m.observe(metricHandlingTime, handling.Seconds(), labels...)
+}
+
+//pollError records a consumer poll error
+func (m *Metrics) pollError(kc *MessageConsumer) {
+	m.addCounter(metricPollErrors, 1, "client_id", kc.ClientID, "group", kc.GroupID, "topic", kc.Topic)
+}
+
+func (m *Metrics) addCounter(name string, value float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.getSeries(name, metricCounter, labels).value += value
+}
+
+func (m *Metrics) setGauge(name string, value float64, labels ...string) {
+	m.setValue(name, metricGauge, value, labels...)
+}
+
+//setValue sets the value of a gauge or of a counter maintained elsewhere
+func (m *Metrics) setValue(name string, kind string, value float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.getSeries(name, kind, labels).value = value
+}
+
+func (m *Metrics) observe(name string, value float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	series := m.getSeries(name, metricHistogram, labels)
+	if series.buckets == nil {
+		series.buckets = make([]uint64, len(m.buckets))
+	}
+	for i, bound := range m.buckets {
+		if value <= bound {
+			series.buckets[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+//removeSeries removes the series starting with the labels except the kept ones
+func (m *Metrics) removeSeries(name string, keep map[string]bool, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	family, ok := m.families[name]
+	if !ok {
+		return
+	}
+	prefix := formatLabels(labels) + ","
+	for key := range family.series {
+		if strings.HasPrefix(key, prefix) && !keep[key] {
+			delete(family.series, key)
+		}
+	}
+}
+
+//getSeries returns the series of the labels, the labels are name value pairs
+func (m *Metrics) getSeries(name string, kind string, labels []string) *metricSeries {
+	family, ok := m.families[name]
+	if !ok {
+		family = &metricFamily{name: name, kind: kind, series: map[string]*metricSeries{}}
+		m.families[name] = family
+	}
+	key := formatLabels(labels)
+	series, ok := family.series[key]
+	if !ok {
+		series = &metricSeries{labels: key}
+		family.series[key] = series
+	}
+	return series
+}
+
+//formatLabels formats the name value pairs as prometheus labels
+func formatLabels(labels []string) string {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+escapeLabelValue(labels[i+1])+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+//Handler returns the http handler serving the metrics in the prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metricsContentType)
+		m.Write(r.Context(), w)
+	})
+}
+
+//Write runs the collectors and writes the metrics in the prometheus text format
+func (m *Metrics) Write(ctx context.Context, writer io.Writer) error {
+	m.mutex.Lock()
+	collectors := make([]func(ctx context.Context), len(m.collectors))
+	copy(collectors, m.collectors)
+	m.mutex.Unlock()
+	for _, collector := range collectors {
+		collector(ctx)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	buffered := bufio.NewWriter(writer)
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m.families[name].write(buffered, m.buckets)
+	}
+	return buffered.Flush()
+}
+
+func (f *metricFamily) write(writer io.Writer, bounds []float64) {
+	fmt.Fprintf(writer, "# HELP %s %s\n", f.name, metricHelp[f.name])
+	fmt.Fprintf(writer, "# TYPE %s %s\n", f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		series := f.series[key]
+		if f.kind != metricHistogram {
+			fmt.Fprintf(writer, "%s%s %s\n", f.name, wrapLabels(series.labels, ""), formatMetricValue(series.value))
+			continue
+		}
+		for i, bound := range bounds {
+			fmt.Fprintf(writer, "%s_bucket%s %d\n", f.name, wrapLabels(series.labels, formatMetricValue(bound)), series.buckets[i])
+		}
+		fmt.Fprintf(writer, "%s_bucket%s %d\n", f.name, wrapLabels(series.labels, "+Inf"), series.count)
+		fmt.Fprintf(writer, "%s_sum%s %s\n", f.name, wrapLabels(series.labels, ""), formatMetricValue(series.sum))
+		fmt.Fprintf(writer, "%s_count%s %d\n", f.name, wrapLabels(series.labels, ""), series.count)
+	}
+}
+
+//wrapLabels wraps the formatted labels in braces and adds the histogram bucket bound if given
+func wrapLabels(labels string, bound string) string {
+	if bound != "" {
+		if labels != "" {
+			labels += ","
+		}
+		labels += `le="` + bound + `"`
+	}
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,212 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+type nopHandler struct{}
+
+func (h *nopHandler) Handle(context *okfwkafka.MessageContext, key []byte, value []byte) {}
+
+func scrape(t *testing.T, metrics *Metrics) string {
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("scrape failed [%v]", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("scrape status [%d]", response.StatusCode)
+	}
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("content type [%s]", response.Header.Get("Content-Type"))
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("cannot read scrape [%v]", err)
+	}
+	return string(body)
+}
+
+func expectLines(t *testing.T, body string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("line missing [%s] in\n%s", line, body)
+		}
+	}
+}
+
+func TestMetricsProducer(t *testing.T) {
+	metrics := NewMetrics()
+	tp := &TopicProducer{ClientID: "producer-1", MessageCount: 3}
+	metrics.RegisterProducer(tp)
+
+	topic := "orders"
+	tp.handleDeliveryReport(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 10},
+		Opaque:         &deliveryOpaque{sent: time.Now().Add(-20 * time.Millisecond)},
+	})
+	tp.handleDeliveryReport(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Error: fmt.Errorf("message timed out")},
+	})
+	metrics.producerFailed(tp, topic)
+
+	body := scrape(t, metrics)
+	expectLines(t, body,
+		"# TYPE okfw_kafka_produced_total counter",
+		`okfw_kafka_produced_total{client_id="producer-1",topic="orders"} 1`,
+		`okfw_kafka_produce_failed_total{client_id="producer-1",topic="orders"} 2`,
+		"# TYPE okfw_kafka_producer_in_flight gauge",
+		`okfw_kafka_producer_in_flight{client_id="producer-1"} 1`,
+		"# TYPE okfw_kafka_delivery_latency_seconds histogram",
+		`okfw_kafka_delivery_latency_seconds_bucket{client_id="producer-1",topic="orders",le="0.01"} 0`,
+		`okfw_kafka_delivery_latency_seconds_bucket{client_id="producer-1",topic="orders",le="10"} 1`,
+		`okfw_kafka_delivery_latency_seconds_bucket{client_id="producer-1",topic="orders",le="+Inf"} 1`,
+		`okfw_kafka_delivery_latency_seconds_count{client_id="producer-1",topic="orders"} 1`,
+	)
+}
+
+func TestMetricsConsumer(t *testing.T) {
+	metrics := NewMetrics()
+	kc := &MessageConsumer{Topic: "orders", ClientID: "consumer-1", GroupID: "billing", Handler: &nopHandler{}}
+	metrics.registerConsumer(kc, func(ctx context.Context) (*BacklogReport, error) {
+		return &BacklogReport{Partitions: []PartitionBacklog{
+			{Topic: "orders", Partition: 0, Lag: 5},
+			{Topic: "orders", Partition: 1, Lag: 0},
+			{Topic: "orders", Partition: 2, Error: fmt.Errorf("timed out")},
+		}}, nil
+	})
+
+	topic := "orders"
+	for i := 0; i < 3; i++ {
+		kc.handleMessage(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: int32(i % 2), Offset: kafka.Offset(i)}, Value: []byte("v")})
+	}
+	metrics.pollError(kc)
+	if latency := kc.GetLatency(); len(latency) != 2 {
+		t.Errorf("latency expected per partition but was %+v", latency)
+	}
+
+	body := scrape(t, metrics)
+	expectLines(t, body,
+		`okfw_kafka_consumed_total{client_id="consumer-1",group="billing",topic="orders"} 3`,
+		`okfw_kafka_poll_errors_total{client_id="consumer-1",group="billing",topic="orders"} 1`,
+		"# TYPE okfw_kafka_consumer_lag gauge",
+		`okfw_kafka_consumer_lag{client_id="consumer-1",group="billing",topic="orders",partition="0"} 5`,
+		`okfw_kafka_consumer_lag{client_id="consumer-1",group="billing",topic="orders",partition="1"} 0`,
+		`okfw_kafka_consumer_lag_errors_total{client_id="consumer-1",group="billing"} 1`,
+		`okfw_kafka_handling_latency_seconds_count{client_id="consumer-1",group="billing",topic="orders"} 3`,
+	)
+	if strings.Contains(body, `okfw_kafka_handling_latency_seconds_count{client_id="consumer-1",group="billing",topic="orders",partition=`) {
+		t.Errorf("latency histograms expected per topic\n%s", body)
+	}
+}
+
+func TestMetricsConsumerRebalance(t *testing.T) {
+	defer SetLagCacheTTL(getLagCacheTTL())
+	SetLagCacheTTL(0)
+	metrics := NewMetrics()
+	partitions := []PartitionBacklog{{Topic: "orders", Partition: 0, Lag: 5}, {Topic: "orders", Partition: 1, Lag: 2}}
+	kc := &MessageConsumer{Topic: "orders", ClientID: "consumer-1", GroupID: "billing"}
+	other := &MessageConsumer{Topic: "orders", ClientID: "consumer-2", GroupID: "billing"}
+	metrics.registerConsumer(kc, func(ctx context.Context) (*BacklogReport, error) {
+		return &BacklogReport{Partitions: partitions}, nil
+	})
+	metrics.registerConsumer(other, func(ctx context.Context) (*BacklogReport, error) {
+		return &BacklogReport{Partitions: []PartitionBacklog{{Topic: "orders", Partition: 2, Lag: 1}}}, nil
+	})
+	expectLines(t, scrape(t, metrics),
+		`okfw_kafka_consumer_lag{client_id="consumer-1",group="billing",topic="orders",partition="1"} 2`)
+
+	//partition 1 was revoked by a rebalance
+	partitions = []PartitionBacklog{{Topic: "orders", Partition: 0, Lag: 3}}
+	body := scrape(t, metrics)
+	expectLines(t, body,
+		`okfw_kafka_consumer_lag{client_id="consumer-1",group="billing",topic="orders",partition="0"} 3`,
+		`okfw_kafka_consumer_lag{client_id="consumer-2",group="billing",topic="orders",partition="2"} 1`)
+	if strings.Contains(body, `client_id="consumer-1",group="billing",topic="orders",partition="1"`) {
+		t.Errorf("lag of revoked partition still exported\n%s", body)
+	}
+}
+
+func TestMetricsLagCache(t *testing.T) {
+	defer SetLagCacheTTL(getLagCacheTTL())
+	SetLagCacheTTL(time.Hour)
+	metrics := NewMetrics()
+	kc := &MessageConsumer{Topic: "orders", ClientID: "consumer-1", GroupID: "billing"}
+	queries := 0
+	var err error
+	metrics.registerConsumer(kc, func(ctx context.Context) (*BacklogReport, error) {
+		queries++
+		return &BacklogReport{Partitions: []PartitionBacklog{{Topic: "orders", Partition: 0, Lag: int64(queries)}}}, err
+	})
+	for i := 0; i < 3; i++ {
+		expectLines(t, scrape(t, metrics), `okfw_kafka_consumer_lag{client_id="consumer-1",group="billing",topic="orders",partition="0"} 1`)
+	}
+	if queries != 1 {
+		t.Errorf("lag expected to be queried once within the ttl but was queried [%d] times", queries)
+	}
+
+	//a failed query is counted once and retried after the ttl
+	SetLagCacheTTL(0)
+	err = fmt.Errorf("timed out")
+	scrape(t, metrics)
+	SetLagCacheTTL(time.Hour)
+	body := scrape(t, metrics)
+	expectLines(t, body, `okfw_kafka_consumer_lag_errors_total{client_id="consumer-1",group="billing"} 1`)
+	if queries != 2 {
+		t.Errorf("lag expected to be queried twice but was queried [%d] times", queries)
+	}
+}
+
+func TestMetricsBuckets(t *testing.T) {
+	metrics := NewMetrics(0.5, 0.1)
+	kc := &MessageConsumer{Topic: "orders", ClientID: "consumer-1", GroupID: "billing"}
+	metrics.consumerLatency(kc, "orders", 0, false, 200*time.Millisecond)
+	expectLines(t, scrape(t, metrics),
+		`okfw_kafka_handling_latency_seconds_bucket{client_id="consumer-1",group="billing",topic="orders",le="0.1"} 0`,
+		`okfw_kafka_handling_latency_seconds_bucket{client_id="consumer-1",group="billing",topic="orders",le="0.5"} 1`,
+		`okfw_kafka_handling_latency_seconds_bucket{client_id="consumer-1",group="billing",topic="orders",le="+Inf"} 1`,
+	)
+
+	//the registry keeps a copy of the default buckets
+	defaults := NewMetrics()
+	bound := DefaultLatencyBuckets[0]
+	DefaultLatencyBuckets[0] = 100
+	defer func() { DefaultLatencyBuckets[0] = bound }()
+	if defaults.buckets[0] != bound {
+		t.Errorf("default buckets expected to be copied but was %v", defaults.buckets)
+	}
+}
+
+func TestMetricsRegisterWhileDelivering(t *testing.T) {
+	tp := &TopicProducer{ClientID: "producer-1", MessageCount: 100}
+	topic := "orders"
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			tp.handleDeliveryReport(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: kafka.Offset(i)}})
+		}
+	}()
+	NewMetrics().RegisterProducer(tp)
+	<-done
+}
+
+func TestMetricsLabelEscaping(t *testing.T) {
+	labels := formatLabels([]string{"topic", "a\"b\\c\nd"})
+	if labels != `topic="a\"b\\c\nd"` {
+		t.Errorf("labels [%s]", labels)
+	}
+}
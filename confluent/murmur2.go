@@ -0,0 +1,68 @@
+package confluent
+
+//Murmur2Partitioner selects the partition like the default partitioner of the java kafka client
+//messages without key are left to librdkafka
+type Murmur2Partitioner struct{}
+
+//NewMurmur2Partitioner creates a java compatible partitioner
+func NewMurmur2Partitioner() *Murmur2Partitioner {
+	return &Murmur2Partitioner{}
+}
+
+//Partition returns the murmur2 partition of the key
+func (p *Murmur2Partitioner) Partition(topic string, key []byte, partitionCount int32) int32 {
+	if key == nil || partitionCount <= 0 {
+		return PartitionAny
+	}
+	return PartitionForKey(key, partitionCount)
+}
+
+//PartitionForKey computes the partition of the key like the java kafka client
+//PartitionAny is returned for a partition count less than one
+func PartitionForKey(key []byte, partitionCount int32) int32 {
+	if partitionCount <= 0 {
+		return PartitionAny
+	}
+	return int32(uint32(murmur2(key))&0x7fffffff) % partitionCount
+}
+
+//murmur2 is the hash used by the java kafka client (org.apache.kafka.common.utils.Utils.murmur2)
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	length4 := length / 4
+	for i := 0; i < length4; i++ {
+		i4 := i * 4
+		k := uint32(data[i4]) | uint32(data[i4+1])<<8 | uint32(data[i4+2])<<16 | uint32(data[i4+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return int32(h)
+}
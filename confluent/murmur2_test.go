@@ -0,0 +1,60 @@
+package confluent
+
+import "testing"
+
+//test vectors of the java kafka client org.apache.kafka.common.utils.UtilsTest
+func TestMurmur2(t *testing.T) {
+	cases := []struct {
+		key  string
+		hash int32
+	}{
+		{"21", -973932308},
+		{"foobar", -790332482},
+		{"a-little-bit-long-string", -985981536},
+		{"a-little-bit-longer-string", -1486304829},
+		{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+		{"abc", 479470107},
+	}
+	for _, c := range cases {
+		if hash := murmur2([]byte(c.key)); hash != c.hash {
+			t.Errorf("murmur2 [%s] expected [%d] but was [%d]", c.key, c.hash, hash)
+		}
+	}
+}
+
+func TestPartitionForKey(t *testing.T) {
+	cases := []struct {
+		key            string
+		partitionCount int32
+		partition      int32
+	}{
+		{"21", 10, 0},
+		{"foobar", 10, 6},
+		{"abc", 3, 0},
+		{"a-little-bit-long-string", 7, 1},
+	}
+	for _, c := range cases {
+		if partition := PartitionForKey([]byte(c.key), c.partitionCount); partition != c.partition {
+			t.Errorf("partition [%s] count [%d] expected [%d] but was [%d]", c.key, c.partitionCount, c.partition, partition)
+		}
+	}
+}
+
+func TestMurmur2PartitionerWithoutKey(t *testing.T) {
+	p := NewMurmur2Partitioner()
+	if partition := p.Partition("topic", nil, 10); partition != PartitionAny {
+		t.Errorf("expected [%d] but was [%d]", PartitionAny, partition)
+	}
+}
+
+func TestPartitionForKeyWithoutPartitions(t *testing.T) {
+	for _, partitionCount := range []int32{0, -1} {
+		if partition := PartitionForKey([]byte("21"), partitionCount); partition != PartitionAny {
+			t.Errorf("partition count [%d] expected [%d] but was [%d]", partitionCount, PartitionAny, partition)
+		}
+	}
+	p := NewMurmur2Partitioner()
+	if partition := p.Partition("topic", []byte("21"), 0); partition != PartitionAny {
+		t.Errorf("expected [%d] but was [%d]", PartitionAny, partition)
+	}
+}
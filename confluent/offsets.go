@@ -0,0 +1,326 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//OffsetResetMode defines the target of an offset reset
+type OffsetResetMode int
+
+const (
+	//ResetToEarliest moves the offsets to the low watermark
+	ResetToEarliest OffsetResetMode = iota
+	//ResetToLatest moves the offsets to the high watermark
+	ResetToLatest
+	//ResetToTimestamp moves the offsets to the first message at or after the timestamp
+	ResetToTimestamp
+	//ResetToOffset moves the offsets to an explicit offset
+	ResetToOffset
+	//ResetShiftBy moves the offsets by a relative amount
+	ResetShiftBy
+)
+
+//OffsetReset describes the offset reset of a group
+type OffsetReset struct {
+	Mode      OffsetResetMode
+	Timestamp time.Time
+	Offset    int64
+	Shift     int64
+}
+
+//OffsetChange holds the current and target committed offset of a partition
+//Current is kafka.OffsetInvalid if the group has no committed offset
+type OffsetChange struct {
+	Topic     string
+	Partition int32
+	Current   int64
+	Target    int64
+	Low       int64
+	High      int64
+}
+
+//OffsetManager shows and changes the committed offsets of a consumer group without joining the group
+type OffsetManager struct {
+	GroupID     string
+	Consumer    *kafka.Consumer
+	Timeout     time.Duration
+	client      offsetClient
+	groupClient func(groupID string) (lagClient, func(), error)
+}
+
+//offsetClient is implemented by the kafka consumer, replaced in tests
+type offsetClient interface {
+	lagClient
+	OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error)
+	CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+}
+
+func newOffsetManager(groupID string) (*OffsetManager, error) {
+	inspector, err := newLagInspector(groupID)
+	if err != nil {
+		return nil, err
+	}
+	return &OffsetManager{
+		GroupID:  groupID,
+		Consumer: inspector.Consumer,
+		Timeout:  defaultAdminTimeout,
+	}, nil
+}
+
+//Close closes the consumer
+func (m *OffsetManager) Close() {
+	m.Consumer.Close()
+}
+
+func (m *OffsetManager) getClient() offsetClient {
+	if m.client != nil {
+		return m.client
+	}
+	return m.Consumer
+}
+
+//openGroupClient returns a client reading the committed offsets of another group and the function to close it
+func (m *OffsetManager) openGroupClient(groupID string) (lagClient, func(), error) {
+	if m.groupClient != nil {
+		return m.groupClient(groupID)
+	}
+	inspector, err := newLagInspector(groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return inspector.Consumer, inspector.Close, nil
+}
+
+func (m *OffsetManager) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, m.Timeout)
+}
+
+//GetCommittedOffsets returns the committed offsets and watermarks of the group for all partitions of the topics
+//the target of the returned changes is the current offset
+func (m *OffsetManager) GetCommittedOffsets(ctx context.Context, topics ...string) ([]OffsetChange, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+	return m.committedOffsets(ctx, m.GroupID, topics)
+}
+
+func (m *OffsetManager) committedOffsets(ctx context.Context, groupID string, topics []string) ([]OffsetChange, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("no topics given for group [%s]", groupID)
+	}
+	var consumer lagClient = m.getClient()
+	if groupID != m.GroupID {
+		other, closeOther, err := m.openGroupClient(groupID)
+		if err != nil {
+			return nil, err
+		}
+		defer closeOther()
+		consumer = other
+	}
+
+	toppars, err := topicPartitions(ctx, consumer, topics)
+	if err != nil {
+		return nil, err
+	}
+	toppars, err = consumer.Committed(toppars, remainingMs(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("cannot get committed offsets of group [%s] error [%v]", groupID, err)
+	}
+
+	report := queryBacklog(ctx, consumer, toppars)
+	err = report.FirstError()
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]OffsetChange, len(report.Partitions))
+	for i, partition := range report.Partitions {
+		changes[i] = OffsetChange{
+			Topic:     partition.Topic,
+			Partition: partition.Partition,
+			Current:   partition.Committed,
+			Target:    partition.Committed,
+			Low:       partition.Low,
+			High:      partition.High,
+		}
+	}
+	return changes, nil
+}
+
+//PlanReset computes the target offsets of the reset for all partitions of the topics
+func (m *OffsetManager) PlanReset(ctx context.Context, reset OffsetReset, topics ...string) ([]OffsetChange, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	changes, err := m.committedOffsets(ctx, m.GroupID, topics)
+	if err != nil {
+		return nil, err
+	}
+
+	var timestampOffsets map[PartitionRef]int64
+	if reset.Mode == ResetToTimestamp {
+		timestampOffsets, err = m.offsetsForTimestamp(ctx, changes, reset.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range changes {
+		change := &changes[i]
+		switch reset.Mode {
+		case ResetToEarliest:
+			change.Target = change.Low
+		case ResetToLatest:
+			change.Target = change.High
+		case ResetToTimestamp:
+			change.Target = timestampOffsets[PartitionRef{Topic: change.Topic, Partition: change.Partition}]
+		case ResetToOffset:
+			change.Target = reset.Offset
+		case ResetShiftBy:
+			current := change.Current
+			if current < 0 {
+				current = change.Low
+			}
+			change.Target = current + reset.Shift
+		default:
+			return nil, fmt.Errorf("offset reset mode unknown [%d]", reset.Mode)
+		}
+		change.Target = clampOffset(change.Target, change.Low, change.High)
+	}
+	return changes, nil
+}
+
+//PlanCopy computes the target offsets to take over the committed offsets of the source group
+//partitions without committed offset in the source group are not changed
+func (m *OffsetManager) PlanCopy(ctx context.Context, sourceGroupID string, topics ...string) ([]OffsetChange, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	changes, err := m.committedOffsets(ctx, m.GroupID, topics)
+	if err != nil {
+		return nil, err
+	}
+	source, err := m.committedOffsets(ctx, sourceGroupID, topics)
+	if err != nil {
+		return nil, err
+	}
+	sourceOffsets := map[PartitionRef]int64{}
+	for _, change := range source {
+		sourceOffsets[PartitionRef{Topic: change.Topic, Partition: change.Partition}] = change.Current
+	}
+	for i := range changes {
+		offset := sourceOffsets[PartitionRef{Topic: changes[i].Topic, Partition: changes[i].Partition}]
+		if offset >= 0 {
+			changes[i].Target = offset
+		}
+	}
+	return changes, nil
+}
+
+//Commit commits the target offsets of the changes, unchanged partitions are skipped
+//the group must not have active members, the broker refuses the commit of a non member while the group has active members
+func (m *OffsetManager) Commit(ctx context.Context, changes []OffsetChange) error {
+	var toppars []kafka.TopicPartition
+	for _, change := range changes {
+		if change.Target < 0 || change.Target == change.Current {
+			continue
+		}
+		topic := change.Topic
+		toppars = append(toppars, kafka.TopicPartition{Topic: &topic, Partition: change.Partition, Offset: kafka.Offset(change.Target)})
+	}
+	if len(toppars) == 0 {
+		return nil
+	}
+	return m.commitOffsets(toppars)
+}
+
+func (m *OffsetManager) commitOffsets(toppars []kafka.TopicPartition) error {
+	committed, err := m.getClient().CommitOffsets(toppars)
+	if err != nil {
+		if isActiveGroupError(err) {
+			return fmt.Errorf("group [%s] has active members, stop the consumers before changing offsets error [%v]", m.GroupID, err)
+		}
+		return fmt.Errorf("cannot commit offsets of group [%s] error [%v]", m.GroupID, err)
+	}
+	return commitResultError(m.GroupID, committed)
+}
+
+//commitResultError returns an error with all partitions the broker refused to commit
+func commitResultError(groupID string, committed []kafka.TopicPartition) error {
+	var failed []string
+	active := false
+	for _, toppar := range committed {
+		if toppar.Error == nil {
+			continue
+		}
+		active = active || isActiveGroupError(toppar.Error)
+		failed = append(failed, fmt.Sprintf("%s[%d] error [%v]", topicName(toppar.Topic), toppar.Partition, toppar.Error))
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	if active {
+		return fmt.Errorf("group [%s] has active members, stop the consumers before changing offsets partitions [%s]", groupID, strings.Join(failed, ", "))
+	}
+	return fmt.Errorf("cannot commit offsets of group [%s] partitions [%s]", groupID, strings.Join(failed, ", "))
+}
+
+//offsetsForTimestamp looks up the first offset at or after the timestamp per partition
+func (m *OffsetManager) offsetsForTimestamp(ctx context.Context, changes []OffsetChange, timestamp time.Time) (map[PartitionRef]int64, error) {
+	times := make([]kafka.TopicPartition, len(changes))
+	for i, change := range changes {
+		topic := change.Topic
+		times[i] = kafka.TopicPartition{Topic: &topic, Partition: change.Partition, Offset: kafka.Offset(timestamp.UnixNano() / int64(time.Millisecond))}
+	}
+	offsets, err := m.getClient().OffsetsForTimes(times, remainingMs(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("cannot get offsets for timestamp [%s] error [%v]", timestamp, err)
+	}
+	high := map[PartitionRef]int64{}
+	for _, change := range changes {
+		high[PartitionRef{Topic: change.Topic, Partition: change.Partition}] = change.High
+	}
+
+	result := map[PartitionRef]int64{}
+	for _, toppar := range offsets {
+		ref := PartitionRef{Topic: *toppar.Topic, Partition: toppar.Partition}
+		if toppar.Error != nil {
+			return nil, fmt.Errorf("cannot get offset for timestamp [%s] error [%v]", ref, toppar.Error)
+		}
+		offset := int64(toppar.Offset)
+		if offset < 0 {
+			//no message after the timestamp
+			offset = high[ref]
+		}
+		result[ref] = offset
+	}
+	return result, nil
+}
+
+func isActiveGroupError(err error) bool {
+	kafkaErr, ok := err.(kafka.Error)
+	if !ok {
+		return false
+	}
+	switch kafkaErr.Code() {
+	case kafka.ErrUnknownMemberID, kafka.ErrRebalanceInProgress, kafka.ErrIllegalGeneration:
+		return true
+	}
+	return false
+}
+
+func clampOffset(offset int64, low int64, high int64) int64 {
+	if offset < low {
+		return low
+	}
+	if offset > high {
+		return high
+	}
+	return offset
+}
@@ -0,0 +1,197 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+func TestCommitResultError(t *testing.T) {
+	orders := "orders"
+	committed := []kafka.TopicPartition{
+		{Topic: &orders, Partition: 0, Offset: 5},
+		{Topic: &orders, Partition: 1, Offset: 7, Error: fmt.Errorf("offset metadata too large")},
+		{Topic: &orders, Partition: 2, Offset: 9, Error: fmt.Errorf("not coordinator")},
+	}
+	err := commitResultError("segmenter", committed)
+	if err == nil {
+		t.Fatalf("partition errors expected to fail the commit")
+	}
+	for _, part := range []string{"group [segmenter]", "orders[1] error [offset metadata too large]", "orders[2] error [not coordinator]"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("commit error [%v] misses [%s]", err, part)
+		}
+	}
+	if strings.Contains(err.Error(), "orders[0]") {
+		t.Errorf("commit error [%v] contains committed partition", err)
+	}
+
+	err = commitResultError("segmenter", committed[:1])
+	if err != nil {
+		t.Errorf("commit without partition errors expected to succeed but was [%v]", err)
+	}
+}
+
+func TestClampOffset(t *testing.T) {
+	cases := []struct{ offset, low, high, expected int64 }{
+		{5, 0, 10, 5},
+		{-3, 0, 10, 0},
+		{12, 2, 10, 10},
+	}
+	for _, c := range cases {
+		if offset := clampOffset(c.offset, c.low, c.high); offset != c.expected {
+			t.Errorf("clamp [%d] to [%d..%d] expected [%d] but was [%d]", c.offset, c.low, c.high, c.expected, offset)
+		}
+	}
+}
+
+//fakeOffsetClient adds the timestamp lookup and the commits to the fake lag client
+type fakeOffsetClient struct {
+	*fakeLagClient
+	timeOffsets map[PartitionRef]kafka.Offset
+	times       []kafka.TopicPartition
+	commits     [][]kafka.TopicPartition
+	commitErr   error
+}
+
+func (c *fakeOffsetClient) OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error) {
+	c.times = times
+	var offsets []kafka.TopicPartition
+	for _, toppar := range times {
+		toppar.Offset = c.timeOffsets[PartitionRef{Topic: *toppar.Topic, Partition: toppar.Partition}]
+		offsets = append(offsets, toppar)
+	}
+	return offsets, nil
+}
+
+func (c *fakeOffsetClient) CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	c.commits = append(c.commits, offsets)
+	if c.commitErr != nil {
+		return nil, c.commitErr
+	}
+	return offsets, nil
+}
+
+//newTestOffsetManager manages group billing on orders[0] with offsets 0..10 committed at 8 and orders[1] with offsets 2..5 without commit
+func newTestOffsetManager() (*OffsetManager, *fakeOffsetClient) {
+	client := &fakeOffsetClient{fakeLagClient: newFakeLagClient(), timeOffsets: map[PartitionRef]kafka.Offset{{"orders", 0}: 6, {"orders", 1}: kafka.OffsetEnd}}
+	return &OffsetManager{GroupID: "billing", Timeout: time.Second, client: client}, client
+}
+
+func targets(changes []OffsetChange) []int64 {
+	var result []int64
+	for _, change := range changes {
+		result = append(result, change.Target)
+	}
+	return result
+}
+
+func TestPlanReset(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		reset   OffsetReset
+		targets []int64
+	}{
+		{"earliest", OffsetReset{Mode: ResetToEarliest}, []int64{0, 2}},
+		{"latest", OffsetReset{Mode: ResetToLatest}, []int64{10, 5}},
+		{"offset", OffsetReset{Mode: ResetToOffset, Offset: 4}, []int64{4, 4}},
+		{"offset beyond high", OffsetReset{Mode: ResetToOffset, Offset: 20}, []int64{10, 5}},
+		{"shift back", OffsetReset{Mode: ResetShiftBy, Shift: -3}, []int64{5, 2}},
+		{"shift forward", OffsetReset{Mode: ResetShiftBy, Shift: 3}, []int64{10, 5}},
+		{"timestamp", OffsetReset{Mode: ResetToTimestamp, Timestamp: timestamp}, []int64{6, 5}},
+	}
+	for _, test := range tests {
+		m, client := newTestOffsetManager()
+		changes, err := m.PlanReset(context.Background(), test.reset, "orders")
+		if err != nil {
+			t.Errorf("%s cannot plan reset error [%v]", test.name, err)
+			continue
+		}
+		if actual := targets(changes); !reflect.DeepEqual(actual, test.targets) {
+			t.Errorf("%s expected targets %v but was %v", test.name, test.targets, actual)
+		}
+		if changes[0].Current != 8 || changes[1].Current != int64(kafka.OffsetInvalid) || changes[1].Low != 2 || changes[1].High != 5 {
+			t.Errorf("%s expected current offsets and watermarks but was %+v", test.name, changes)
+		}
+		if test.reset.Mode == ResetToTimestamp && (len(client.times) != 2 || int64(client.times[0].Offset) != 1700000000000) {
+			t.Errorf("timestamp expected in milliseconds but was %v", client.times)
+		}
+		if len(client.commits) != 0 {
+			t.Errorf("%s plan expected not to commit", test.name)
+		}
+	}
+
+	m, _ := newTestOffsetManager()
+	if _, err := m.PlanReset(context.Background(), OffsetReset{Mode: OffsetResetMode(9)}, "orders"); err == nil {
+		t.Errorf("unknown mode expected error")
+	}
+	m, client := newTestOffsetManager()
+	client.partitions[PartitionRef{"orders", 1}] = watermarks{err: kafka.NewError(kafka.ErrLeaderNotAvailable, "Broker: Leader not available", false)}
+	if _, err := m.PlanReset(context.Background(), OffsetReset{Mode: ResetToEarliest}, "orders"); err == nil {
+		t.Errorf("watermark error expected to fail the plan")
+	}
+}
+
+func TestPlanCopy(t *testing.T) {
+	m, _ := newTestOffsetManager()
+	source := newFakeLagClient()
+	source.committed = map[PartitionRef]kafka.Offset{{"orders", 0}: 3}
+	var opened []string
+	closed := 0
+	m.groupClient = func(groupID string) (lagClient, func(), error) {
+		opened = append(opened, groupID)
+		return source, func() { closed++ }, nil
+	}
+
+	changes, err := m.PlanCopy(context.Background(), "audit", "orders")
+	if err != nil {
+		t.Fatalf("cannot plan copy error [%v]", err)
+	}
+	//partitions without committed offset in the source group keep their offset
+	if actual := targets(changes); !reflect.DeepEqual(actual, []int64{3, int64(kafka.OffsetInvalid)}) {
+		t.Errorf("expected targets [3 %d] but was %v", kafka.OffsetInvalid, actual)
+	}
+	if !reflect.DeepEqual(opened, []string{"audit"}) || closed != 1 {
+		t.Errorf("source group client expected opened and closed once but was %v closed [%d]", opened, closed)
+	}
+
+	m.groupClient = func(groupID string) (lagClient, func(), error) {
+		return nil, nil, fmt.Errorf("cannot create consumer")
+	}
+	if _, err := m.PlanCopy(context.Background(), "audit", "orders"); err == nil {
+		t.Errorf("source group client error expected")
+	}
+}
+
+func TestCommitChanges(t *testing.T) {
+	m, client := newTestOffsetManager()
+	changes := []OffsetChange{
+		{Topic: "orders", Partition: 0, Current: 8, Target: 3},
+		{Topic: "orders", Partition: 1, Current: int64(kafka.OffsetInvalid), Target: 2},
+		{Topic: "orders", Partition: 2, Current: 4, Target: 4},
+		{Topic: "orders", Partition: 3, Current: 4, Target: int64(kafka.OffsetInvalid)},
+	}
+	if err := m.Commit(context.Background(), changes); err != nil {
+		t.Fatalf("cannot commit error [%v]", err)
+	}
+	//only the changed partitions are committed in a single commit
+	if len(client.commits) != 1 || len(client.commits[0]) != 2 || client.commits[0][0].Offset != 3 || client.commits[0][1].Offset != 2 {
+		t.Errorf("expected one commit of orders[0]@3 and orders[1]@2 but was %v", client.commits)
+	}
+
+	if err := m.Commit(context.Background(), changes[2:]); err != nil || len(client.commits) != 1 {
+		t.Errorf("unchanged offsets expected no commit but was %v error [%v]", client.commits, err)
+	}
+
+	client.commitErr = kafka.NewError(kafka.ErrUnknownMemberID, "Broker: Unknown member", false)
+	err := m.Commit(context.Background(), changes)
+	if err == nil || !strings.Contains(err.Error(), "has active members") {
+		t.Errorf("active group expected error but was [%v]", err)
+	}
+}
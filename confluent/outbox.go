@@ -0,0 +1,598 @@
+package confluent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+const (
+	outboxSuffix       = ".outbox"
+	outboxRecordHeader = 8
+	//outboxRecordMessageV1 is the message record without timestamp and headers written by earlier versions
+	outboxRecordMessageV1 = byte(1)
+	outboxRecordAck       = byte(2)
+	outboxRecordMessage   = byte(3)
+
+	defaultOutboxSegmentBytes = 64 * 1024 * 1024
+	defaultOutboxMaxBytes     = 1024 * 1024 * 1024
+	defaultFsyncInterval      = time.Second
+)
+
+//ErrOutboxFull is returned when the outbox reached its size limit
+var ErrOutboxFull = errors.New("outbox size limit reached")
+
+//errOutboxRecordTruncated is returned for a record that ends after the end of the segment
+var errOutboxRecordTruncated = errors.New("outbox record truncated")
+
+//FsyncPolicy defines when the outbox segments are synced to disk
+type FsyncPolicy int
+
+const (
+	//FsyncAlways syncs after every record
+	FsyncAlways FsyncPolicy = iota
+	//FsyncInterval syncs at most once per interval
+	FsyncInterval
+	//FsyncNever leaves syncing to the operating system
+	FsyncNever
+)
+
+//OutboxConfig configures the disk backed outbox
+type OutboxConfig struct {
+	Directory     string
+	SegmentBytes  int64
+	MaxBytes      int64
+	Fsync         FsyncPolicy
+	FsyncInterval time.Duration
+}
+
+//OutboxMessage is a journaled message
+type OutboxMessage struct {
+	Topic     string
+	Partition int32
+	Key       []byte
+	Value     []byte
+	Timestamp time.Time
+	Headers   []kafka.Header
+}
+
+//OutboxStats holds the outbox depth and counters
+//Retrying is the number of pending messages waiting to be sent again by the producer
+type OutboxStats struct {
+	PendingMessages int64
+	PendingBytes    int64
+	Segments        int
+	DiskBytes       int64
+	Journaled       int64
+	Acknowledged    int64
+	Retrying        int64
+}
+
+//Outbox journals messages in append only segment files until they are acknowledged
+type Outbox struct {
+	config      OutboxConfig
+	mutex       sync.Mutex
+	segments    []*outboxSegment
+	active      *outboxSegment
+	pending     map[uint64]outboxLocation
+	nextSeq     uint64
+	nextSegment uint64
+	lastSync    time.Time
+	stats       OutboxStats
+}
+
+type outboxSegment struct {
+	id      uint64
+	path    string
+	file    *os.File
+	size    int64
+	pending int
+}
+
+type outboxLocation struct {
+	segment *outboxSegment
+	offset  int64
+	size    int64
+}
+
+//OpenOutbox opens the outbox directory and restores the unacknowledged messages
+func OpenOutbox(config OutboxConfig) (*Outbox, error) {
+	if config.Directory == "" {
+		return nil, fmt.Errorf("outbox directory missing")
+	}
+	if config.SegmentBytes <= 0 {
+		config.SegmentBytes = defaultOutboxSegmentBytes
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultOutboxMaxBytes
+	}
+	if config.FsyncInterval <= 0 {
+		config.FsyncInterval = defaultFsyncInterval
+	}
+	err := os.MkdirAll(config.Directory, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create outbox directory [%s] error [%v]", config.Directory, err)
+	}
+
+	o := &Outbox{
+		config:      config,
+		pending:     map[uint64]outboxLocation{},
+		nextSeq:     1,
+		nextSegment: 1,
+	}
+	err = o.load()
+	if err == nil && len(o.segments) > 0 {
+		//continue writing the last segment
+		o.active = o.segments[len(o.segments)-1]
+	} else if err == nil {
+		err = o.rotate()
+	}
+	if err != nil {
+		o.closeSegments()
+		return nil, err
+	}
+	o.removeAcknowledgedSegments()
+
+	return o, nil
+}
+
+//load reads all segments in order and rebuilds the pending index
+func (o *Outbox) load() error {
+	files, err := ioutil.ReadDir(o.config.Directory)
+	if err != nil {
+		return fmt.Errorf("cannot read outbox directory [%s] error [%v]", o.config.Directory, err)
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), outboxSuffix) {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, outboxSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segment := &outboxSegment{id: id, path: filepath.Join(o.config.Directory, name)}
+		segment.file, err = os.OpenFile(segment.path, os.O_RDWR, 0644)
+		if err != nil {
+			return fmt.Errorf("cannot open outbox segment [%s] error [%v]", segment.path, err)
+		}
+		o.segments = append(o.segments, segment)
+		err = o.loadSegment(segment, i == len(names)-1)
+		if err != nil {
+			return err
+		}
+		if id >= o.nextSegment {
+			o.nextSegment = id + 1
+		}
+	}
+	o.stats.Segments = len(o.segments)
+	return nil
+}
+
+//loadSegment indexes the pending messages of the segment
+//a torn write is cut off at the end of the newest segment, any other unreadable record is an error
+func (o *Outbox) loadSegment(segment *outboxSegment, newest bool) error {
+	info, err := segment.file.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot read outbox segment [%s] error [%v]", segment.path, err)
+	}
+	reader := bufio.NewReader(segment.file)
+	var offset int64
+	for {
+		recordType, seq, _, size, err := readOutboxRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if newest && isTornWrite(segment.file, offset, size, info.Size(), err) {
+				break
+			}
+			return fmt.Errorf("cannot read outbox segment [%s] offset [%d] error [%v]", segment.path, offset, err)
+		}
+		switch recordType {
+		case outboxRecordMessage, outboxRecordMessageV1:
+			o.pending[seq] = outboxLocation{segment: segment, offset: offset, size: size}
+			segment.pending++
+			o.stats.PendingBytes += size
+		case outboxRecordAck:
+			o.removePending(seq)
+		}
+		if seq >= o.nextSeq {
+			o.nextSeq = seq + 1
+		}
+		offset += size
+	}
+
+	err = segment.file.Truncate(offset)
+	if err == nil {
+		_, err = segment.file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot truncate outbox segment [%s] error [%v]", segment.path, err)
+	}
+	segment.size = offset
+	o.stats.DiskBytes += offset
+	o.stats.PendingMessages = int64(len(o.pending))
+	return nil
+}
+
+//isTornWrite returns true if the unreadable record at the offset is the last write of the segment
+//the record is truncated, has a checksum mismatch and ends with the file or the rest of the file is zeroed
+func isTornWrite(file *os.File, offset int64, size int64, fileSize int64, err error) bool {
+	if err == errOutboxRecordTruncated || offset+size == fileSize {
+		return true
+	}
+	rest := make([]byte, fileSize-offset)
+	_, err = file.ReadAt(rest, offset)
+	if err != nil {
+		return false
+	}
+	for _, b := range rest {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *Outbox) removePending(seq uint64) bool {
+	location, ok := o.pending[seq]
+	if !ok {
+		return false
+	}
+	delete(o.pending, seq)
+	location.segment.pending--
+	o.stats.PendingBytes -= location.size
+	o.stats.PendingMessages = int64(len(o.pending))
+	return true
+}
+
+//rotate starts a new active segment
+func (o *Outbox) rotate() error {
+	if o.active != nil {
+		err := o.active.file.Sync()
+		if err != nil {
+			return fmt.Errorf("cannot sync outbox segment [%s] error [%v]", o.active.path, err)
+		}
+	}
+	segment := &outboxSegment{
+		id:   o.nextSegment,
+		path: filepath.Join(o.config.Directory, fmt.Sprintf("%020d%s", o.nextSegment, outboxSuffix)),
+	}
+	var err error
+	segment.file, err = os.OpenFile(segment.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot create outbox segment [%s] error [%v]", segment.path, err)
+	}
+	o.nextSegment++
+	o.active = segment
+	o.segments = append(o.segments, segment)
+	o.stats.Segments = len(o.segments)
+	return nil
+}
+
+//Append journals the message and returns its sequence number
+func (o *Outbox) Append(m OutboxMessage) (uint64, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.active == nil {
+		return 0, fmt.Errorf("outbox is closed")
+	}
+	body := encodeOutboxMessage(m)
+	size := int64(outboxRecordHeader + 9 + len(body))
+	if o.stats.DiskBytes+size > o.config.MaxBytes {
+		return 0, ErrOutboxFull
+	}
+	if o.active.size > 0 && o.active.size+size > o.config.SegmentBytes {
+		err := o.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	seq := o.nextSeq
+	offset := o.active.size
+	err := o.write(outboxRecordMessage, seq, body)
+	if err != nil {
+		return 0, err
+	}
+	o.nextSeq++
+	o.pending[seq] = outboxLocation{segment: o.active, offset: offset, size: size}
+	o.active.pending++
+	o.stats.PendingBytes += size
+	o.stats.PendingMessages = int64(len(o.pending))
+	o.stats.Journaled++
+
+	return seq, nil
+}
+
+//Ack removes the message from the outbox
+func (o *Outbox) Ack(seq uint64) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.active == nil {
+		return fmt.Errorf("outbox is closed")
+	}
+	if !o.removePending(seq) {
+		return nil
+	}
+	//acknowledgements are written regardless of the size limit to be able to free space
+	err := o.write(outboxRecordAck, seq, nil)
+	if err != nil {
+		return err
+	}
+	o.stats.Acknowledged++
+	o.removeAcknowledgedSegments()
+
+	return nil
+}
+
+//Pending returns the sequence numbers of the unacknowledged messages in journal order
+func (o *Outbox) Pending() []uint64 {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	seqs := make([]uint64, 0, len(o.pending))
+	for seq := range o.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+func (o *Outbox) isPending(seq uint64) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	_, ok := o.pending[seq]
+	return ok
+}
+
+//Read reads a pending message from the journal
+func (o *Outbox) Read(seq uint64) (OutboxMessage, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	location, ok := o.pending[seq]
+	if !ok {
+		return OutboxMessage{}, fmt.Errorf("outbox message not pending [%d]", seq)
+	}
+	buffer := make([]byte, location.size)
+	_, err := location.segment.file.ReadAt(buffer, location.offset)
+	if err != nil {
+		return OutboxMessage{}, fmt.Errorf("cannot read outbox message [%d] error [%v]", seq, err)
+	}
+	recordType, _, body, _, err := readOutboxRecord(bytes.NewReader(buffer))
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+	return decodeOutboxMessage(recordType, body)
+}
+
+//Stats returns the outbox depth and counters
+func (o *Outbox) Stats() OutboxStats {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.stats
+}
+
+//Close syncs and closes the segment files
+func (o *Outbox) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.active == nil {
+		return nil
+	}
+	err := o.active.file.Sync()
+	o.closeSegments()
+	o.active = nil
+	return err
+}
+
+func (o *Outbox) closeSegments() {
+	for _, segment := range o.segments {
+		segment.file.Close()
+	}
+}
+
+//write appends a record to the active segment and applies the fsync policy
+func (o *Outbox) write(recordType byte, seq uint64, body []byte) error {
+	record := make([]byte, outboxRecordHeader+9+len(body))
+	record[outboxRecordHeader] = recordType
+	binary.BigEndian.PutUint64(record[outboxRecordHeader+1:], seq)
+	copy(record[outboxRecordHeader+9:], body)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(record)-outboxRecordHeader))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(record[outboxRecordHeader:]))
+
+	_, err := o.active.file.Write(record)
+	if err != nil {
+		return fmt.Errorf("cannot write outbox segment [%s] error [%v]", o.active.path, err)
+	}
+	o.active.size += int64(len(record))
+	o.stats.DiskBytes += int64(len(record))
+
+	switch o.config.Fsync {
+	case FsyncAlways:
+		err = o.active.file.Sync()
+	case FsyncInterval:
+		if time.Since(o.lastSync) >= o.config.FsyncInterval {
+			err = o.active.file.Sync()
+			o.lastSync = time.Now()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot sync outbox segment [%s] error [%v]", o.active.path, err)
+	}
+	return nil
+}
+
+//removeAcknowledgedSegments deletes the oldest segments without pending messages
+//segments are removed in order only, as newer segments hold the acknowledgements of older ones
+func (o *Outbox) removeAcknowledgedSegments() {
+	for len(o.segments) > 0 && o.segments[0] != o.active && o.segments[0].pending == 0 {
+		segment := o.segments[0]
+		segment.file.Close()
+		os.Remove(segment.path)
+		o.stats.DiskBytes -= segment.size
+		o.segments = o.segments[1:]
+	}
+	o.stats.Segments = len(o.segments)
+}
+
+//readOutboxRecord reads a record and returns its type, sequence, body and size on disk
+//the size is also returned with a checksum mismatch, a record ending after the end of the reader is errOutboxRecordTruncated
+func readOutboxRecord(reader io.Reader) (byte, uint64, []byte, int64, error) {
+	header := make([]byte, outboxRecordHeader)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, 0, nil, 0, errOutboxRecordTruncated
+		}
+		return 0, 0, nil, 0, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < 9 {
+		return 0, 0, nil, 0, fmt.Errorf("outbox record length invalid [%d]", length)
+	}
+	size := int64(outboxRecordHeader) + int64(length)
+	data := make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, 0, nil, size, errOutboxRecordTruncated
+	}
+	if err != nil {
+		return 0, 0, nil, size, fmt.Errorf("cannot read outbox record error [%v]", err)
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return 0, 0, nil, size, fmt.Errorf("outbox record checksum mismatch")
+	}
+	return data[0], binary.BigEndian.Uint64(data[1:9]), data[9:], size, nil
+}
+
+func encodeOutboxMessage(m OutboxMessage) []byte {
+	body := make([]byte, 0, 2+len(m.Topic)+24+len(m.Key)+len(m.Value))
+	body = append(body, byte(len(m.Topic)>>8), byte(len(m.Topic)))
+	body = append(body, m.Topic...)
+	body = appendInt32(body, m.Partition)
+	body = appendBytes(body, m.Key)
+	body = appendBytes(body, m.Value)
+	body = appendInt64(body, timestampMs(m.Timestamp))
+	return appendHeaders(body, m.Headers)
+}
+
+//decodeOutboxMessage decodes the message record, the version 1 record has no timestamp and headers
+func decodeOutboxMessage(recordType byte, body []byte) (OutboxMessage, error) {
+	var m OutboxMessage
+	if len(body) < 2 {
+		return m, fmt.Errorf("outbox message truncated")
+	}
+	topicLength := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	if len(body) < topicLength+4 {
+		return m, fmt.Errorf("outbox message truncated")
+	}
+	m.Topic = string(body[:topicLength])
+	body = body[topicLength:]
+	m.Partition = int32(binary.BigEndian.Uint32(body))
+	body = body[4:]
+
+	var err error
+	m.Key, body, err = readBytes(body)
+	if err != nil {
+		return m, err
+	}
+	m.Value, body, err = readBytes(body)
+	if err != nil || recordType == outboxRecordMessageV1 {
+		return m, err
+	}
+	if len(body) < 8 {
+		return m, fmt.Errorf("outbox message truncated")
+	}
+	m.Timestamp = msToTime(int64(binary.BigEndian.Uint64(body)))
+	m.Headers, _, err = readHeaders(body[8:])
+	return m, err
+}
+
+func appendInt32(buffer []byte, value int32) []byte {
+	var encoded [4]byte
+	binary.BigEndian.PutUint32(encoded[:], uint32(value))
+	return append(buffer, encoded[:]...)
+}
+
+//appendBytes writes the length prefixed bytes, nil is written as length -1
+func appendBytes(buffer []byte, value []byte) []byte {
+	if value == nil {
+		return appendInt32(buffer, -1)
+	}
+	buffer = appendInt32(buffer, int32(len(value)))
+	return append(buffer, value...)
+}
+
+//appendHeaders writes the header count and the length prefixed keys and values
+func appendHeaders(buffer []byte, headers []kafka.Header) []byte {
+	buffer = appendInt32(buffer, int32(len(headers)))
+	for _, header := range headers {
+		buffer = appendBytes(buffer, []byte(header.Key))
+		buffer = appendBytes(buffer, header.Value)
+	}
+	return buffer
+}
+
+func readHeaders(buffer []byte) ([]kafka.Header, []byte, error) {
+	if len(buffer) < 4 {
+		return nil, nil, fmt.Errorf("message headers truncated")
+	}
+	count := int32(binary.BigEndian.Uint32(buffer))
+	buffer = buffer[4:]
+	var headers []kafka.Header
+	for i := int32(0); i < count; i++ {
+		key, rest, err := readBytes(buffer)
+		if err != nil {
+			return nil, nil, err
+		}
+		var value []byte
+		value, buffer, err = readBytes(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		headers = append(headers, kafka.Header{Key: string(key), Value: value})
+	}
+	return headers, buffer, nil
+}
+
+func readBytes(buffer []byte) ([]byte, []byte, error) {
+	if len(buffer) < 4 {
+		return nil, nil, fmt.Errorf("message truncated")
+	}
+	length := int32(binary.BigEndian.Uint32(buffer))
+	buffer = buffer[4:]
+	if length < 0 {
+		return nil, buffer, nil
+	}
+	if len(buffer) < int(length) {
+		return nil, nil, fmt.Errorf("message truncated")
+	}
+	value := make([]byte, length)
+	copy(value, buffer[:length])
+	return value, buffer[length:], nil
+}
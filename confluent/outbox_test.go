@@ -0,0 +1,543 @@
+package confluent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+func tempOutboxDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatalf("cannot create temp dir error [%v]", err)
+	}
+	return dir
+}
+
+func openTestOutbox(t *testing.T, config OutboxConfig) *Outbox {
+	o, err := OpenOutbox(config)
+	if err != nil {
+		t.Fatalf("cannot open outbox error [%v]", err)
+	}
+	return o
+}
+
+func testOutboxMessage(i int) OutboxMessage {
+	return OutboxMessage{Topic: "orders", Partition: int32(i % 3), Key: []byte(fmt.Sprintf("key-%d", i)), Value: []byte(fmt.Sprintf("value-%d", i))}
+}
+
+func appendTestMessages(t *testing.T, o *Outbox, count int) []uint64 {
+	var seqs []uint64
+	for i := 0; i < count; i++ {
+		seq, err := o.Append(testOutboxMessage(i))
+		if err != nil {
+			t.Fatalf("cannot append message [%d] error [%v]", i, err)
+		}
+		seqs = append(seqs, seq)
+	}
+	return seqs
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+outboxSuffix))
+	if err != nil {
+		t.Fatalf("cannot list segments error [%v]", err)
+	}
+	return files
+}
+
+func TestOutboxAppendReadAck(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	o := openTestOutbox(t, OutboxConfig{Directory: dir})
+	defer o.Close()
+
+	seqs := appendTestMessages(t, o, 3)
+	if !reflect.DeepEqual(seqs, []uint64{1, 2, 3}) {
+		t.Errorf("sequences expected [1 2 3] but was %v", seqs)
+	}
+	for i, seq := range seqs {
+		m, err := o.Read(seq)
+		if err != nil || !reflect.DeepEqual(m, testOutboxMessage(i)) {
+			t.Errorf("message [%d] expected [%v] but was [%v] error [%v]", seq, testOutboxMessage(i), m, err)
+		}
+	}
+
+	err := o.Ack(2)
+	if err != nil {
+		t.Fatalf("cannot ack error [%v]", err)
+	}
+	if pending := o.Pending(); !reflect.DeepEqual(pending, []uint64{1, 3}) {
+		t.Errorf("pending expected [1 3] but was %v", pending)
+	}
+	if _, err = o.Read(2); err == nil {
+		t.Errorf("read of acknowledged message expected error")
+	}
+	if err = o.Ack(2); err != nil {
+		t.Errorf("ack again expected no error but was [%v]", err)
+	}
+	stats := o.Stats()
+	if stats.PendingMessages != 2 || stats.Journaled != 3 || stats.Acknowledged != 1 || stats.Segments != 1 || stats.PendingBytes <= 0 {
+		t.Errorf("stats unexpected %+v", stats)
+	}
+
+	//nil and empty payloads are kept apart
+	seq, _ := o.Append(OutboxMessage{Topic: "t", Key: nil, Value: []byte{}})
+	m, err := o.Read(seq)
+	if err != nil || m.Key != nil || m.Value == nil || len(m.Value) != 0 {
+		t.Errorf("nil key and empty value not kept [%#v] error [%v]", m, err)
+	}
+}
+
+func TestOutboxSegmentRotation(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	o := openTestOutbox(t, OutboxConfig{Directory: dir, SegmentBytes: 130})
+	defer o.Close()
+
+	//the records of the test messages take 61 bytes, two fit into a segment
+	appendTestMessages(t, o, 6)
+	stats := o.Stats()
+	if stats.Segments != 3 {
+		t.Errorf("expected [3] segments but was [%d]", stats.Segments)
+	}
+	files := segmentFiles(t, dir)
+	if len(files) != stats.Segments {
+		t.Errorf("segment files expected [%d] but was [%d]", stats.Segments, len(files))
+	}
+	var size int64
+	for _, file := range files {
+		info, _ := os.Stat(file)
+		size += info.Size()
+		if info.Size() > 130 {
+			t.Errorf("segment [%s] exceeds the limit size [%d]", file, info.Size())
+		}
+	}
+	if size != stats.DiskBytes {
+		t.Errorf("disk bytes expected [%d] but was [%d]", size, stats.DiskBytes)
+	}
+}
+
+func TestOutboxReplayOrderAfterRestart(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	config := OutboxConfig{Directory: dir, SegmentBytes: 120}
+	o := openTestOutbox(t, config)
+	seqs := appendTestMessages(t, o, 8)
+	for _, seq := range []uint64{seqs[1], seqs[4], seqs[5]} {
+		o.Ack(seq)
+	}
+	o.Close()
+
+	o = openTestOutbox(t, config)
+	defer o.Close()
+	expected := []uint64{seqs[0], seqs[2], seqs[3], seqs[6], seqs[7]}
+	if pending := o.Pending(); !reflect.DeepEqual(pending, expected) {
+		t.Fatalf("pending after restart expected %v but was %v", expected, pending)
+	}
+	for _, seq := range expected {
+		m, err := o.Read(seq)
+		if err != nil || !reflect.DeepEqual(m, testOutboxMessage(int(seq-1))) {
+			t.Errorf("message [%d] after restart was [%v] error [%v]", seq, m, err)
+		}
+	}
+	seq, err := o.Append(testOutboxMessage(8))
+	if err != nil || seq != 9 {
+		t.Errorf("sequence after restart expected [9] but was [%d] error [%v]", seq, err)
+	}
+	if stats := o.Stats(); stats.PendingMessages != 6 {
+		t.Errorf("pending messages expected [6] but was [%d]", stats.PendingMessages)
+	}
+}
+
+func TestOutboxTornWrite(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	config := OutboxConfig{Directory: dir}
+	o := openTestOutbox(t, config)
+	appendTestMessages(t, o, 2)
+	o.Close()
+
+	files := segmentFiles(t, dir)
+	info, _ := os.Stat(files[0])
+	err := os.Truncate(files[0], info.Size()-3)
+	if err != nil {
+		t.Fatalf("cannot truncate segment error [%v]", err)
+	}
+
+	o = openTestOutbox(t, config)
+	defer o.Close()
+	if pending := o.Pending(); !reflect.DeepEqual(pending, []uint64{1}) {
+		t.Errorf("pending after torn write expected [1] but was %v", pending)
+	}
+	info, _ = os.Stat(files[0])
+	if info.Size() != o.Stats().DiskBytes {
+		t.Errorf("torn record not cut off size [%d] disk bytes [%d]", info.Size(), o.Stats().DiskBytes)
+	}
+	seq, err := o.Append(testOutboxMessage(1))
+	if err != nil || seq != 2 {
+		t.Errorf("append after torn write expected seq [2] but was [%d] error [%v]", seq, err)
+	}
+}
+
+func corruptRecord(t *testing.T, file string, record int, records int) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("cannot read segment error [%v]", err)
+	}
+	data[record*len(data)/records+outboxRecordHeader+12] ^= 0xff
+	ioutil.WriteFile(file, data, 0644)
+}
+
+func TestOutboxCorruptRecord(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	config := OutboxConfig{Directory: dir}
+	o := openTestOutbox(t, config)
+	appendTestMessages(t, o, 3)
+	o.Close()
+
+	//a corrupt record followed by others is no torn write
+	file := segmentFiles(t, dir)[0]
+	corruptRecord(t, file, 1, 3)
+	if _, err := OpenOutbox(config); err == nil {
+		t.Errorf("corrupt record in the middle of the segment expected error")
+	}
+
+	//a corrupt last record is cut off like a torn write
+	corruptRecord(t, file, 1, 3)
+	corruptRecord(t, file, 2, 3)
+	o = openTestOutbox(t, config)
+	defer o.Close()
+	if pending := o.Pending(); !reflect.DeepEqual(pending, []uint64{1, 2}) {
+		t.Errorf("pending after corrupt last record expected [1 2] but was %v", pending)
+	}
+}
+
+func TestOutboxCorruptOlderSegment(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	config := OutboxConfig{Directory: dir, SegmentBytes: 70}
+	o := openTestOutbox(t, config)
+	appendTestMessages(t, o, 3)
+	o.Close()
+
+	//the last record of an older segment is not written last
+	corruptRecord(t, segmentFiles(t, dir)[0], 0, 1)
+	if _, err := OpenOutbox(config); err == nil {
+		t.Errorf("corrupt record of an older segment expected error")
+	}
+}
+
+func TestOutboxZeroedTail(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	config := OutboxConfig{Directory: dir}
+	o := openTestOutbox(t, config)
+	appendTestMessages(t, o, 2)
+	o.Close()
+
+	//a crash can leave the file extended with zeros
+	file := segmentFiles(t, dir)[0]
+	data, _ := ioutil.ReadFile(file)
+	ioutil.WriteFile(file, append(data, make([]byte, 100)...), 0644)
+
+	o = openTestOutbox(t, config)
+	defer o.Close()
+	if pending := o.Pending(); !reflect.DeepEqual(pending, []uint64{1, 2}) {
+		t.Errorf("pending after zeroed tail expected [1 2] but was %v", pending)
+	}
+	if o.Stats().DiskBytes != int64(len(data)) {
+		t.Errorf("zeroed tail expected to be cut off disk bytes [%d] expected [%d]", o.Stats().DiskBytes, len(data))
+	}
+}
+
+func TestOutboxTimestampAndHeaders(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	config := OutboxConfig{Directory: dir}
+	o := openTestOutbox(t, config)
+	timestamp := time.Unix(1600000000, 123*int64(time.Millisecond))
+	headers := []kafka.Header{{Key: "traceparent", Value: []byte("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")}, {Key: "empty", Value: nil}}
+	seq, err := o.Append(OutboxMessage{Topic: "orders", Key: []byte("k"), Value: []byte("v"), Timestamp: timestamp, Headers: headers})
+	if err != nil {
+		t.Fatalf("cannot append error [%v]", err)
+	}
+	o.Close()
+
+	o = openTestOutbox(t, config)
+	defer o.Close()
+	m, err := o.Read(seq)
+	if err != nil || !m.Timestamp.Equal(timestamp) || !reflect.DeepEqual(m.Headers, headers) {
+		t.Errorf("timestamp [%v] and headers %v expected after restart but was [%v] %v error [%v]", timestamp, headers, m.Timestamp, m.Headers, err)
+	}
+}
+
+func TestOutboxVersion1Record(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	config := OutboxConfig{Directory: dir}
+	o := openTestOutbox(t, config)
+
+	//a message record of the first format without timestamp and headers
+	body := []byte{0, 6}
+	body = append(body, "orders"...)
+	body = appendInt32(body, 2)
+	body = appendBytes(body, []byte("k"))
+	body = appendBytes(body, []byte("v"))
+	o.mutex.Lock()
+	o.write(outboxRecordMessageV1, 1, body)
+	o.mutex.Unlock()
+	o.Close()
+
+	o = openTestOutbox(t, config)
+	defer o.Close()
+	m, err := o.Read(1)
+	expected := OutboxMessage{Topic: "orders", Partition: 2, Key: []byte("k"), Value: []byte("v")}
+	if err != nil || !reflect.DeepEqual(m, expected) {
+		t.Errorf("version 1 record expected [%v] but was [%v] error [%v]", expected, m, err)
+	}
+}
+
+func TestOutboxSizeLimit(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	o := openTestOutbox(t, OutboxConfig{Directory: dir, SegmentBytes: 100, MaxBytes: 300})
+	defer o.Close()
+
+	var seqs []uint64
+	for {
+		seq, err := o.Append(testOutboxMessage(len(seqs)))
+		if err == ErrOutboxFull {
+			break
+		}
+		if err != nil {
+			t.Fatalf("cannot append error [%v]", err)
+		}
+		seqs = append(seqs, seq)
+		if len(seqs) > 100 {
+			t.Fatalf("size limit not applied")
+		}
+	}
+	if o.Stats().DiskBytes > 300 {
+		t.Errorf("disk bytes exceed the limit [%d]", o.Stats().DiskBytes)
+	}
+
+	//acknowledgements are written when full and free the acknowledged segments
+	for _, seq := range seqs {
+		err := o.Ack(seq)
+		if err != nil {
+			t.Fatalf("cannot ack when full error [%v]", err)
+		}
+	}
+	_, err := o.Append(testOutboxMessage(0))
+	if err != nil {
+		t.Errorf("append after acks expected no error but was [%v]", err)
+	}
+}
+
+func TestOutboxCompaction(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	o := openTestOutbox(t, OutboxConfig{Directory: dir, SegmentBytes: 60})
+	defer o.Close()
+
+	//one message per segment
+	seqs := appendTestMessages(t, o, 4)
+	if segments := len(segmentFiles(t, dir)); segments != 4 {
+		t.Fatalf("expected [4] segments but was [%d]", segments)
+	}
+
+	//the second segment is kept while the first has pending messages
+	o.Ack(seqs[1])
+	if segments := len(segmentFiles(t, dir)); segments != 4 {
+		t.Errorf("segments removed out of order, expected [4] but was [%d]", segments)
+	}
+	o.Ack(seqs[0])
+	if segments := len(segmentFiles(t, dir)); segments != 2 {
+		t.Errorf("acknowledged segments expected to be removed, expected [2] but was [%d]", segments)
+	}
+
+	//the active segment is kept even without pending messages
+	o.Ack(seqs[2])
+	o.Ack(seqs[3])
+	files := segmentFiles(t, dir)
+	if len(files) != 1 || o.Stats().Segments != 1 || o.Stats().PendingMessages != 0 {
+		t.Errorf("expected the active segment only but was %v stats %+v", files, o.Stats())
+	}
+	o.Close()
+
+	o = openTestOutbox(t, OutboxConfig{Directory: dir, SegmentBytes: 60})
+	defer o.Close()
+	if pending := o.Pending(); len(pending) != 0 {
+		t.Errorf("no pending messages expected after compaction but was %v", pending)
+	}
+}
+
+func TestOutboxFsyncPolicy(t *testing.T) {
+	for _, policy := range []FsyncPolicy{FsyncAlways, FsyncInterval, FsyncNever} {
+		dir := tempOutboxDir(t)
+		defer os.RemoveAll(dir)
+		config := OutboxConfig{Directory: dir, Fsync: policy, FsyncInterval: time.Hour}
+		o := openTestOutbox(t, config)
+		appendTestMessages(t, o, 1)
+		firstSync := o.lastSync
+		appendTestMessages(t, o, 1)
+
+		switch policy {
+		case FsyncInterval:
+			if firstSync.IsZero() || o.lastSync != firstSync {
+				t.Errorf("interval policy expected a single sync per interval first [%v] last [%v]", firstSync, o.lastSync)
+			}
+		default:
+			if !o.lastSync.IsZero() {
+				t.Errorf("policy [%d] expected no interval sync but was [%v]", policy, o.lastSync)
+			}
+		}
+		o.Close()
+
+		o = openTestOutbox(t, config)
+		if pending := o.Pending(); len(pending) != 2 {
+			t.Errorf("policy [%d] expected [2] messages after reopen but was %v", policy, pending)
+		}
+		o.Close()
+	}
+}
+
+func TestOutboxClosed(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	o := openTestOutbox(t, OutboxConfig{Directory: dir})
+	appendTestMessages(t, o, 1)
+	if err := o.Close(); err != nil {
+		t.Errorf("close expected no error but was [%v]", err)
+	}
+	if err := o.Close(); err != nil {
+		t.Errorf("close again expected no error but was [%v]", err)
+	}
+	if _, err := o.Append(testOutboxMessage(0)); err == nil {
+		t.Errorf("append after close expected error")
+	}
+	if err := o.Ack(1); err == nil {
+		t.Errorf("ack after close expected error")
+	}
+	if _, err := OpenOutbox(OutboxConfig{}); err == nil {
+		t.Errorf("open without directory expected error")
+	}
+}
+
+func TestOutboxDeliveryAcknowledged(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	o := openTestOutbox(t, OutboxConfig{Directory: dir})
+	defer o.Close()
+	seq := appendTestMessages(t, o, 1)[0]
+
+	var results []DeliveryResult
+	tp := &TopicProducer{ClientID: "outbox", MessageCount: 1}
+	topic := "orders"
+	tp.handleDeliveryReport(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 5},
+		Opaque:         &deliveryOpaque{outbox: o, outboxSeq: seq, callback: func(result DeliveryResult) { results = append(results, result) }},
+	})
+	if len(o.Pending()) != 0 || tp.SuccessCount != 1 || tp.GetInFlightCount() != 0 || len(results) != 1 {
+		t.Errorf("delivered message expected acknowledged pending %v success [%d] in flight [%d] results %v",
+			o.Pending(), tp.SuccessCount, tp.GetInFlightCount(), results)
+	}
+}
+
+func TestOutboxFailedDeliveryRetried(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	o := openTestOutbox(t, OutboxConfig{Directory: dir})
+	defer o.Close()
+	seq := appendTestMessages(t, o, 1)[0]
+
+	var results []DeliveryResult
+	tp := &TopicProducer{ClientID: "outbox", MessageCount: 1}
+	topic := "orders"
+	tp.handleDeliveryReport(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Error: fmt.Errorf("message timed out")},
+		Opaque:         &deliveryOpaque{outbox: o, outboxSeq: seq, callback: func(result DeliveryResult) { results = append(results, result) }},
+	})
+
+	if !reflect.DeepEqual(o.Pending(), []uint64{seq}) {
+		t.Errorf("failed message expected to stay in the outbox but pending was %v", o.Pending())
+	}
+	if tp.FailedCount != 0 || len(results) != 0 || len(tp.takeDeliveryErrors()) != 0 {
+		t.Errorf("failed message of the outbox expected not to be reported failed count [%d] results %v", tp.FailedCount, results)
+	}
+	if tp.GetInFlightCount() != 1 {
+		t.Errorf("retry expected to be in flight but was [%d]", tp.GetInFlightCount())
+	}
+	if len(tp.outboxRetries) != 1 || tp.outboxRetries[0].seq != seq || tp.outboxRetries[0].callback == nil {
+		t.Errorf("retry with callback expected to be scheduled but was %v", tp.outboxRetries)
+	}
+
+	//after the retry loop stopped the message waits for the next start
+	tp.stopOutboxRetry()
+	tp.MessageCount = 1
+	tp.handleDeliveryReport(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Error: fmt.Errorf("message timed out")},
+		Opaque:         &deliveryOpaque{outbox: o, outboxSeq: seq},
+	})
+	if tp.GetInFlightCount() != 0 || tp.getOutboxRetryCount() != 0 || tp.FailedCount != 0 {
+		t.Errorf("no retry expected after stop in flight [%d] retries [%d] failed [%d]", tp.GetInFlightCount(), tp.getOutboxRetryCount(), tp.FailedCount)
+	}
+}
+
+func TestEnableOutboxRollback(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	config := OutboxConfig{Directory: dir}
+	o := openTestOutbox(t, config)
+	appendTestMessages(t, o, 2)
+	o.Close()
+
+	//the replay fails as the closed producer rejects the messages
+	tp := &TopicProducer{ClientID: "outbox", closed: true}
+	err := tp.EnableOutbox(config)
+	if err == nil {
+		t.Fatalf("enable outbox expected replay error")
+	}
+	if tp.getOutbox() != nil || !tp.outboxStopped || tp.GetInFlightCount() != 0 {
+		t.Errorf("outbox expected to be rolled back outbox [%v] stopped [%t] in flight [%d]", tp.getOutbox(), tp.outboxStopped, tp.GetInFlightCount())
+	}
+	if stats := tp.GetOutboxStats(); stats != (OutboxStats{}) {
+		t.Errorf("stats of a rolled back outbox expected empty but was %+v", stats)
+	}
+
+	o = openTestOutbox(t, config)
+	defer o.Close()
+	if pending := o.Pending(); len(pending) != 2 {
+		t.Errorf("messages expected to stay in the outbox after rollback but was %v", pending)
+	}
+}
+
+func TestEnableOutboxReplayExceedsQueue(t *testing.T) {
+	dir := tempOutboxDir(t)
+	defer os.RemoveAll(dir)
+	config := OutboxConfig{Directory: dir}
+	o := openTestOutbox(t, config)
+	appendTestMessages(t, o, 50)
+	o.Close()
+
+	//the backlog is larger than the local queue
+	tp := newMockClusterProducer(t, kafka.ConfigMap{"queue.buffering.max.messages": 5})
+	err := tp.EnableOutbox(config)
+	if err != nil {
+		t.Fatalf("cannot replay backlog larger than the queue error [%v]", err)
+	}
+	if result := tp.Flush(10 * time.Second); result.Undelivered != 0 {
+		t.Fatalf("replayed messages not delivered %+v", result)
+	}
+	if stats := tp.GetOutboxStats(); stats.PendingMessages != 0 || tp.SuccessCount != 50 {
+		t.Errorf("replayed messages expected acknowledged but was %+v success [%d]", stats, tp.SuccessCount)
+	}
+}
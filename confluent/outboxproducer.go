@@ -0,0 +1,199 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//outboxRetryDelay is the wait time before a message with failed delivery is sent again
+const outboxRetryDelay = time.Second
+
+//outboxReplayQueueFull waits without timeout for space in the local queue, the messages left from a previous run may exceed the queue size
+var outboxReplayQueueFull = QueueFullConfig{Policy: QueueFullBlock}
+
+type outboxRetry struct {
+	seq       uint64
+	callback  DeliveryCallback
+	notBefore time.Time
+}
+
+//EnableOutbox journals all messages in a disk backed outbox until the broker acknowledged them
+//messages left from a previous run are sent again in journal order waiting for space in the local queue, must be called before the first send
+//a message with failed delivery stays in the outbox and is sent again, it is not reported as failed
+func (tp *TopicProducer) EnableOutbox(config OutboxConfig) error {
+	if outbox := tp.getOutbox(); outbox != nil {
+		return fmt.Errorf("outbox already enabled [%s]", outbox.config.Directory)
+	}
+	outbox, err := OpenOutbox(config)
+	if err != nil {
+		return err
+	}
+	tp.outboxMutex.Lock()
+	tp.outbox = outbox
+	tp.outboxRetries = nil
+	tp.outboxResending = 0
+	tp.outboxWake = make(chan struct{}, 1)
+	tp.outboxDone = make(chan struct{})
+	tp.outboxStopped = false
+	tp.outboxMutex.Unlock()
+	tp.outboxWait.Add(1)
+	go tp.runOutboxRetry(outbox)
+
+	for _, seq := range outbox.Pending() {
+		err = tp.resendOutboxMessage(outbox, seq, nil, outboxReplayQueueFull)
+		if err != nil {
+			//messages already replayed are acknowledged by their delivery reports or sent on the next start
+			tp.disableOutbox()
+			return fmt.Errorf("cannot replay outbox message [%d] error [%v]", seq, err)
+		}
+	}
+	return nil
+}
+
+//GetOutboxStats returns the outbox depth and counters
+func (tp *TopicProducer) GetOutboxStats() OutboxStats {
+	outbox := tp.getOutbox()
+	if outbox == nil {
+		return OutboxStats{}
+	}
+	stats := outbox.Stats()
+	stats.Retrying = int64(tp.getOutboxRetryCount())
+	return stats
+}
+
+func (tp *TopicProducer) getOutbox() *Outbox {
+	tp.outboxMutex.Lock()
+	defer tp.outboxMutex.Unlock()
+	return tp.outbox
+}
+
+//getOutboxRetryCount returns the messages waiting to be sent again
+func (tp *TopicProducer) getOutboxRetryCount() int {
+	tp.outboxMutex.Lock()
+	defer tp.outboxMutex.Unlock()
+	return len(tp.outboxRetries) + tp.outboxResending
+}
+
+//handleOutboxDelivery removes the delivered message from the outbox or schedules it to be sent again
+func (tp *TopicProducer) handleOutboxDelivery(opaque *deliveryOpaque, m *kafka.Message) {
+	if m.TopicPartition.Error == nil {
+		opaque.outbox.Ack(opaque.outboxSeq)
+		return
+	}
+	tp.scheduleOutboxRetry(outboxRetry{seq: opaque.outboxSeq, callback: opaque.callback, notBefore: time.Now().Add(outboxRetryDelay)})
+}
+
+//scheduleOutboxRetry queues the message to be sent again, after the retry loop stopped the message stays in the outbox for the next start
+func (tp *TopicProducer) scheduleOutboxRetry(retry outboxRetry) {
+	tp.outboxMutex.Lock()
+	defer tp.outboxMutex.Unlock()
+	if tp.outboxStopped {
+		return
+	}
+	tp.outboxRetries = append(tp.outboxRetries, retry)
+	select {
+	case tp.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+//nextOutboxRetry takes the oldest retry, it is counted as resending until resendDone
+func (tp *TopicProducer) nextOutboxRetry() (outboxRetry, bool) {
+	tp.outboxMutex.Lock()
+	defer tp.outboxMutex.Unlock()
+	if len(tp.outboxRetries) == 0 {
+		return outboxRetry{}, false
+	}
+	retry := tp.outboxRetries[0]
+	tp.outboxRetries = tp.outboxRetries[1:]
+	tp.outboxResending++
+	return retry, true
+}
+
+func (tp *TopicProducer) resendDone() {
+	tp.outboxMutex.Lock()
+	defer tp.outboxMutex.Unlock()
+	tp.outboxResending--
+}
+
+//runOutboxRetry sends the scheduled messages again in the order of their failed deliveries
+func (tp *TopicProducer) runOutboxRetry(outbox *Outbox) {
+	defer tp.outboxWait.Done()
+	for {
+		retry, ok := tp.nextOutboxRetry()
+		if !ok {
+			select {
+			case <-tp.outboxDone:
+				return
+			case <-tp.outboxWake:
+			}
+			continue
+		}
+		select {
+		case <-tp.outboxDone:
+			tp.resendDone()
+			return
+		case <-time.After(time.Until(retry.notBefore)):
+		}
+		err := tp.resendOutboxMessage(outbox, retry.seq, retry.callback, tp.getQueueFullConfig())
+		if err != nil && outbox.isPending(retry.seq) {
+			//not enqueued, e.g. the local queue is full
+			tp.scheduleOutboxRetry(outboxRetry{seq: retry.seq, callback: retry.callback, notBefore: time.Now().Add(outboxRetryDelay)})
+		}
+		tp.resendDone()
+	}
+}
+
+//resendOutboxMessage reads the journaled message and enqueues it with its timestamp and headers without journaling it again
+func (tp *TopicProducer) resendOutboxMessage(outbox *Outbox, seq uint64, callback DeliveryCallback, queueFull QueueFullConfig) error {
+	journaled, err := outbox.Read(seq)
+	if err != nil {
+		return err
+	}
+	m := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &journaled.Topic,
+			Partition: journaled.Partition,
+		},
+		Key:       journaled.Key,
+		Value:     journaled.Value,
+		Timestamp: journaled.Timestamp,
+		Headers:   journaled.Headers,
+	}
+	return tp.enqueueMessage(context.Background(), m, &deliveryOpaque{callback: callback, outbox: outbox, outboxSeq: seq}, queueFull)
+}
+
+//stopOutboxRetry stops the retry loop, the scheduled messages stay in the outbox for the next start
+func (tp *TopicProducer) stopOutboxRetry() {
+	tp.outboxMutex.Lock()
+	done := tp.outboxDone
+	stopped := tp.outboxStopped
+	tp.outboxStopped = true
+	tp.outboxRetries = nil
+	tp.outboxMutex.Unlock()
+	if done == nil || stopped {
+		return
+	}
+	close(done)
+	tp.outboxWait.Wait()
+}
+
+func (tp *TopicProducer) closeOutbox() {
+	outbox := tp.getOutbox()
+	if outbox == nil {
+		return
+	}
+	outbox.Close()
+}
+
+//disableOutbox stops the retry loop and closes the outbox after a failed replay
+func (tp *TopicProducer) disableOutbox() {
+	tp.stopOutboxRetry()
+	tp.closeOutbox()
+	tp.outboxMutex.Lock()
+	defer tp.outboxMutex.Unlock()
+	tp.outbox = nil
+}
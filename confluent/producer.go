@@ -1,96 +1,56 @@
 package confluent
 
 import (
+	"context"
 	"fmt"
-	"time"
-
-	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
-//MessageProducer holds the kafka producer and some message counters
+//MessageProducer sends messages to a single topic with a TopicProducer
 type MessageProducer struct {
-	SuccessCount int64
-	FailedCount  int64
-	MessageCount int64
-	Topic        string
-	ClientID     string
-	Producer     *kafka.Producer
+	*TopicProducer
+	Topic string
 }
 
 func newMessageProducer(topic string, clientID string) (*MessageProducer, error) {
-	kp := &MessageProducer{
-		Topic:    topic,
-		ClientID: clientID,
+	if topic == "" {
+		return nil, fmt.Errorf("producer topic missing")
 	}
-
-	var err error
-
-	kp.Producer, err = kafka.NewProducer(
-		&kafka.ConfigMap{
-			"bootstrap.servers":                     "localhost",
-			"acks":                                  "all",
-			"compression.type":                      "lz4",
-			"retries":                               10000000,
-			"client.id":                             clientID,
-			"max.in.flight.requests.per.connection": 5,
-			"enable.idempotence":                    true,
-		})
+	tp, err := newTopicProducer(clientID)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create new producer error [%#v]", err)
+		return nil, err
 	}
-
-	// Delivery report handler for produced messages
-	go func() {
-		for e := range kp.Producer.Events() {
-			switch ev := e.(type) {
-			case *kafka.Message:
-				if ev.TopicPartition.Error != nil {
-					kp.FailedCount++
-				} else {
-					kp.SuccessCount++
-				}
-				kp.MessageCount--
-			}
-		}
-	}()
-
-	return kp, nil
+	return &MessageProducer{
+		TopicProducer: tp,
+		Topic:         topic,
+	}, nil
 }
 
-//Close the producer
-func (kp *MessageProducer) Close() {
-	kp.Producer.Close()
+//SendKeyValue send message with key and value
+func (kp *MessageProducer) SendKeyValue(key []byte, value []byte) error {
+	return kp.Send(kp.Topic, PartitionAny, key, value)
 }
 
-//GetMessageCounter returns the address to the message counter
-func (kp *MessageProducer) GetMessageCounter() *int64 {
-	return &kp.MessageCount
+//SendTombstone sends a message without value to delete the key from the compacted topic
+func (kp *MessageProducer) SendTombstone(key []byte) error {
+	return kp.TopicProducer.SendTombstone(kp.Topic, PartitionAny, key)
 }
 
-//SendKeyValue send message with key and value
-func (kp *MessageProducer) SendKeyValue(key []byte, value []byte) error {
-	err := kp.Producer.Produce(
-		&kafka.Message{
-			TopicPartition: kafka.TopicPartition{
-				Topic:     &kp.Topic,
-				Partition: kafka.PartitionAny,
-			},
-			Key:   key,
-			Value: value,
-		},
-		nil)
-	if err == nil {
-		kp.SuccessCount++
-	}
-	kp.MessageCount++
+//SendKeyValueContext send message with key and value, a send blocked by a full queue ends with the context
+func (kp *MessageProducer) SendKeyValueContext(ctx context.Context, key []byte, value []byte) error {
+	return kp.SendContext(ctx, kp.Topic, PartitionAny, key, value)
+}
 
-	return err
+//SendKeyValueAsync sends message with key and value and calls the callback with the delivery result
+func (kp *MessageProducer) SendKeyValueAsync(key []byte, value []byte, callback DeliveryCallback) error {
+	return kp.SendAsync(kp.Topic, PartitionAny, key, value, callback)
+}
 
+//SendKeyValueSync sends message with key and value and blocks until the broker acknowledged the message or the context is done
+func (kp *MessageProducer) SendKeyValueSync(ctx context.Context, key []byte, value []byte) (DeliveryResult, error) {
+	return kp.SendSync(ctx, kp.Topic, PartitionAny, key, value)
 }
 
 //WaitUntilSendComplete wait until all messages are sent
 func (kp *MessageProducer) WaitUntilSendComplete() {
-	for kp.MessageCount > 0 {
-		time.Sleep(time.Second * 1)
-	}
+	kp.FlushContext(context.Background())
 }
@@ -0,0 +1,442 @@
+//Package providertest checks that an okfw kafka provider behaves like the others
+//the suite runs against the in-memory provider and, given a cluster, against the confluent provider
+package providertest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+//Config describes the provider under test, zero values take the defaults
+type Config struct {
+	//NewProvider creates the provider for a check
+	NewProvider func(t *testing.T) okfwkafka.Provider
+	//NewTopic returns the name of a topic without messages, the default is a unique name for clusters with topic auto creation
+	NewTopic func(t *testing.T) string
+	//NewSubject returns the name of a subject without schemas, the default is a unique name
+	NewSubject func(t *testing.T) string
+	//PollTimeout is passed to Process
+	PollTimeout time.Duration
+	//Timeout limits the wait for messages and committed offsets
+	Timeout time.Duration
+	//Messages is the number of messages of the ordering check
+	Messages int
+	//Keys is the number of keys the messages of the ordering check are spread over
+	Keys int
+	//SkipSchemas skips the schema checks for providers without schema registry
+	SkipSchemas bool
+}
+
+var uniqueCounter int64
+
+func (c Config) withDefaults() Config {
+	if c.NewTopic == nil {
+		c.NewTopic = func(t *testing.T) string {
+			return uniqueName("okfw-conformance")
+		}
+	}
+	if c.NewSubject == nil {
+		c.NewSubject = func(t *testing.T) string {
+			return uniqueName("okfw-conformance") + "-value"
+		}
+	}
+	if c.PollTimeout <= 0 {
+		c.PollTimeout = 100 * time.Millisecond
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 30 * time.Second
+	}
+	if c.Messages <= 0 {
+		c.Messages = 100
+	}
+	if c.Keys <= 0 {
+		c.Keys = 10
+	}
+	return c
+}
+
+func uniqueName(prefix string) string {
+	return fmt.Sprintf("%s-%d-%d", prefix, time.Now().UnixNano(), atomic.AddInt64(&uniqueCounter, 1))
+}
+
+//Run runs all checks as sub tests
+func Run(t *testing.T, config Config) {
+	if config.NewProvider == nil {
+		t.Fatalf("provider factory missing")
+	}
+	config = config.withDefaults()
+	t.Run("Ordering", func(t *testing.T) { checkOrdering(t, config) })
+	t.Run("Backlog", func(t *testing.T) { checkBacklog(t, config) })
+	t.Run("Counters", func(t *testing.T) { checkCounters(t, config) })
+	t.Run("Handler", func(t *testing.T) { checkHandler(t, config) })
+	t.Run("EmptyPoll", func(t *testing.T) { checkEmptyPoll(t, config) })
+	t.Run("Close", func(t *testing.T) { checkClose(t, config) })
+	t.Run("InvalidArguments", func(t *testing.T) { checkInvalidArguments(t, config) })
+	t.Run("Schemas", func(t *testing.T) {
+		if config.SkipSchemas {
+			t.Skip("schema checks disabled")
+		}
+		checkSchemas(t, config)
+	})
+}
+
+//received is a message passed to the handler
+type received struct {
+	context *okfwkafka.MessageContext
+	key     []byte
+	value   []byte
+}
+
+//recorder is a handler keeping all messages
+type recorder struct {
+	mutex    sync.Mutex
+	messages []received
+}
+
+func (r *recorder) Handle(context *okfwkafka.MessageContext, key []byte, value []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.messages = append(r.messages, received{context: context, key: key, value: value})
+}
+
+func (r *recorder) get() []received {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]received{}, r.messages...)
+}
+
+//fixture is a producer and a consumer on a fresh topic
+type fixture struct {
+	config   Config
+	topic    string
+	provider okfwkafka.Provider
+	producer okfwkafka.MessageProducer
+	consumer okfwkafka.MessageConsumer
+	handler  *recorder
+}
+
+//newFixture creates the producer, the consumer is created by consumer() after the first messages created the topic
+func newFixture(t *testing.T, config Config) *fixture {
+	f := &fixture{config: config, topic: config.NewTopic(t), provider: config.NewProvider(t), handler: &recorder{}}
+	var err error
+	f.producer, err = f.provider.NewProducer(f.topic, uniqueName("producer"))
+	if err != nil {
+		t.Fatalf("cannot create producer error [%v]", err)
+	}
+	return f
+}
+
+func (f *fixture) startConsumer(t *testing.T) {
+	var err error
+	f.consumer, err = f.provider.NewConsumer(f.topic, uniqueName("consumer"), f.handler)
+	if err != nil {
+		t.Fatalf("cannot create consumer error [%v]", err)
+	}
+}
+
+func (f *fixture) close() {
+	if f.consumer != nil {
+		f.consumer.Close()
+	}
+	f.producer.Close()
+}
+
+//send sends the messages and waits until they are delivered if the producer supports it
+func (f *fixture) send(t *testing.T, messages ...[2][]byte) {
+	for _, m := range messages {
+		err := f.producer.SendKeyValue(m[0], m[1])
+		if err != nil {
+			t.Fatalf("cannot send message [%s] error [%v]", m[0], err)
+		}
+	}
+	if flusher, ok := f.producer.(interface{ WaitUntilSendComplete() }); ok {
+		flusher.WaitUntilSendComplete()
+	}
+}
+
+//consume processes until the handler got count messages in total
+func (f *fixture) consume(t *testing.T, count int) []received {
+	deadline := time.Now().Add(f.config.Timeout)
+	for len(f.handler.get()) < count && time.Now().Before(deadline) {
+		err := f.consumer.Process(int(f.config.PollTimeout / time.Millisecond))
+		if err != nil {
+			t.Logf("process error [%v]", err)
+		}
+	}
+	messages := f.handler.get()
+	if len(messages) < count {
+		t.Fatalf("expected [%d] messages but got [%d] within [%s]", count, len(messages), f.config.Timeout)
+	}
+	return messages
+}
+
+//awaitBacklog waits until the backlog of the consumer is expected, offsets may be committed asynchronously
+func (f *fixture) awaitBacklog(t *testing.T, expected int) {
+	deadline := time.Now().Add(f.config.Timeout)
+	for {
+		backlog, err := f.consumer.GetBacklog()
+		if err == nil && backlog == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected backlog [%d] but was [%d] error [%v]", expected, backlog, err)
+		}
+		time.Sleep(f.config.PollTimeout)
+	}
+}
+
+func keyValue(key string, value string) [2][]byte {
+	return [2][]byte{[]byte(key), []byte(value)}
+}
+
+//checkOrdering sends sequences per key and expects each key in order as messages of a key share a partition
+func checkOrdering(t *testing.T, config Config) {
+	f := newFixture(t, config)
+	defer f.close()
+
+	messages := make([][2][]byte, config.Messages)
+	for i := range messages {
+		messages[i] = keyValue(fmt.Sprintf("key-%d", i%config.Keys), fmt.Sprintf("%d", i/config.Keys))
+	}
+	f.send(t, messages...)
+	f.startConsumer(t)
+
+	next := map[string]int{}
+	for _, m := range f.consume(t, config.Messages) {
+		var sequence int
+		fmt.Sscanf(string(m.value), "%d", &sequence)
+		key := string(m.key)
+		if sequence != next[key] {
+			t.Errorf("key [%s] expected sequence [%d] but got [%d]", key, next[key], sequence)
+		}
+		next[key] = sequence + 1
+	}
+	if len(next) != config.Keys {
+		t.Errorf("expected [%d] keys but got [%d]", config.Keys, len(next))
+	}
+}
+
+//checkBacklog expects the backlog to follow the produced and consumed messages
+func checkBacklog(t *testing.T, config Config) {
+	f := newFixture(t, config)
+	defer f.close()
+
+	f.send(t, keyValue("key-0", "0"), keyValue("key-1", "0"))
+	f.startConsumer(t)
+	f.consume(t, 2)
+	f.awaitBacklog(t, 0)
+
+	f.send(t, keyValue("key-0", "1"), keyValue("key-1", "1"), keyValue("key-2", "0"))
+	f.awaitBacklog(t, 3)
+
+	f.consume(t, 5)
+	f.awaitBacklog(t, 0)
+}
+
+//checkCounters expects the consumer counter to count the handled messages
+func checkCounters(t *testing.T, config Config) {
+	f := newFixture(t, config)
+	defer f.close()
+
+	f.send(t, keyValue("key-0", "0"), keyValue("key-0", "1"), keyValue("key-1", "0"))
+	f.startConsumer(t)
+	counter := f.consumer.GetMessageCounter()
+	if counter == nil {
+		t.Fatalf("message counter missing")
+	}
+	f.consume(t, 3)
+	if *counter != 3 {
+		t.Errorf("expected message counter [3] but was [%d]", *counter)
+	}
+	if f.consumer.GetMessageCounter() != counter {
+		t.Errorf("message counter address changed")
+	}
+}
+
+//checkHandler expects the handler to get key, value and timestamp of each message once
+func checkHandler(t *testing.T, config Config) {
+	f := newFixture(t, config)
+	defer f.close()
+
+	before := time.Now()
+	f.send(t, keyValue("key-0", "value"), [2][]byte{[]byte("key-1"), {}})
+	f.startConsumer(t)
+	messages := f.consume(t, 2)
+
+	time.Sleep(config.PollTimeout)
+	f.consumer.Process(int(config.PollTimeout / time.Millisecond))
+	if len(f.handler.get()) != 2 {
+		t.Errorf("expected [2] handled messages but got [%d]", len(f.handler.get()))
+	}
+
+	expected := map[string][]byte{"key-0": []byte("value"), "key-1": {}}
+	for _, m := range messages {
+		value, ok := expected[string(m.key)]
+		if !ok {
+			t.Errorf("unexpected key [%s]", m.key)
+			continue
+		}
+		delete(expected, string(m.key))
+		if !bytes.Equal(m.value, value) {
+			t.Errorf("key [%s] expected value [%s] but got [%s]", m.key, value, m.value)
+		}
+		if m.context == nil {
+			t.Errorf("key [%s] without message context", m.key)
+			continue
+		}
+		//the broker clock may differ
+		if m.context.Timestamp.Before(before.Add(-time.Minute)) || m.context.Timestamp.After(time.Now().Add(time.Minute)) {
+			t.Errorf("key [%s] timestamp [%s] not around the send time [%s]", m.key, m.context.Timestamp, before)
+		}
+	}
+}
+
+//checkEmptyPoll expects Process to return within the timeout without calling the handler if no message is left
+func checkEmptyPoll(t *testing.T, config Config) {
+	f := newFixture(t, config)
+	defer f.close()
+
+	f.send(t, keyValue("key-0", "0"))
+	f.startConsumer(t)
+	f.consume(t, 1)
+
+	start := time.Now()
+	err := f.consumer.Process(int(config.PollTimeout / time.Millisecond))
+	if err != nil {
+		t.Errorf("process without messages error [%v]", err)
+	}
+	if elapsed := time.Since(start); elapsed > config.PollTimeout+time.Second {
+		t.Errorf("process took [%s] with poll timeout [%s]", elapsed, config.PollTimeout)
+	}
+	if len(f.handler.get()) != 1 {
+		t.Errorf("handler called without message")
+	}
+}
+
+//checkClose expects closing twice to be harmless and closed clients to return errors
+func checkClose(t *testing.T, config Config) {
+	f := newFixture(t, config)
+	f.send(t, keyValue("key-0", "0"))
+	f.startConsumer(t)
+	f.consume(t, 1)
+
+	noPanic(t, "close consumer", f.consumer.Close)
+	noPanic(t, "close consumer again", f.consumer.Close)
+	noPanic(t, "close producer", f.producer.Close)
+	noPanic(t, "close producer again", f.producer.Close)
+
+	noPanic(t, "process after close", func() {
+		if f.consumer.Process(int(config.PollTimeout/time.Millisecond)) == nil {
+			t.Errorf("process after close without error")
+		}
+	})
+	noPanic(t, "send after close", func() {
+		if f.producer.SendKeyValue([]byte("key-0"), []byte("1")) == nil {
+			t.Errorf("send after close without error")
+		}
+	})
+}
+
+//checkInvalidArguments expects errors instead of clients for a missing handler or topic
+func checkInvalidArguments(t *testing.T, config Config) {
+	provider := config.NewProvider(t)
+	noPanic(t, "consumer without handler", func() {
+		consumer, err := provider.NewConsumer(config.NewTopic(t), uniqueName("consumer"), nil)
+		if err == nil {
+			consumer.Close()
+			t.Errorf("consumer without handler without error")
+		}
+	})
+	noPanic(t, "consumer without topic", func() {
+		consumer, err := provider.NewConsumer("", uniqueName("consumer"), &recorder{})
+		if err == nil {
+			consumer.Close()
+			t.Errorf("consumer without topic without error")
+		}
+	})
+	noPanic(t, "producer without topic", func() {
+		producer, err := provider.NewProducer("", uniqueName("producer"))
+		if err == nil {
+			producer.Close()
+			t.Errorf("producer without topic without error")
+		}
+	})
+}
+
+func noPanic(t *testing.T, action string, call func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("%s panic [%v]", action, r)
+		}
+	}()
+	call()
+}
+
+//checkSchemas expects schema ids by subject version and stable ids for registering again
+func checkSchemas(t *testing.T, config Config) {
+	resolver, err := config.NewProvider(t).NewSchemaResolver()
+	if err != nil {
+		t.Fatalf("cannot create schema resolver error [%v]", err)
+	}
+	subject := config.NewSubject(t)
+	first := `{"type":"record","name":"Conformance","fields":[{"name":"id","type":"long"}]}`
+	second := `{"type":"record","name":"Conformance","fields":[{"name":"id","type":"long"},{"name":"name","type":"string","default":""}]}`
+
+	if _, err := resolver.GetSchemaBySubject(subject, 1); err == nil {
+		t.Errorf("unknown subject [%s] without error", subject)
+	}
+
+	firstID, err := resolver.RegisterNewSchema(subject, first)
+	if err != nil {
+		t.Fatalf("cannot register schema error [%v]", err)
+	}
+	if firstID <= 0 {
+		t.Errorf("schema id invalid [%d]", firstID)
+	}
+	again, err := resolver.RegisterNewSchema(subject, first)
+	if err != nil || again != firstID {
+		t.Errorf("registering again expected id [%d] but got [%d] error [%v]", firstID, again, err)
+	}
+	secondID, err := resolver.RegisterNewSchema(subject, second)
+	if err != nil {
+		t.Fatalf("cannot register second schema error [%v]", err)
+	}
+	if secondID == firstID {
+		t.Errorf("second schema got the id of the first [%d]", firstID)
+	}
+
+	for version, expected := range map[int]int{1: firstID, 2: secondID} {
+		id, err := resolver.GetSchemaBySubject(subject, version)
+		if err != nil || id != expected {
+			t.Errorf("version [%d] expected id [%d] but got [%d] error [%v]", version, expected, id, err)
+		}
+	}
+	if _, err := resolver.GetSchemaBySubject(subject, 3); err == nil {
+		t.Errorf("unknown version without error")
+	}
+
+	byID, ok := resolver.(interface {
+		GetSchemaByID(id int) (string, error)
+	})
+	if !ok {
+		return
+	}
+	if schema, err := byID.GetSchemaByID(firstID); err != nil || schema == "" {
+		t.Errorf("schema id [%d] expected schema but got [%s] error [%v]", firstID, schema, err)
+	}
+	unknown := firstID
+	if secondID > unknown {
+		unknown = secondID
+	}
+	//ids are not reused so an id far beyond the registered ones is unknown
+	unknown += 1000000
+	if _, err := byID.GetSchemaByID(unknown); err == nil {
+		t.Errorf("unknown schema id [%d] without error", unknown)
+	}
+}
@@ -0,0 +1,113 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//Offsets to start a topic reader from
+const (
+	//OffsetBeginning starts with the first available message
+	OffsetBeginning = int64(kafka.OffsetBeginning)
+	//OffsetEnd starts after the last message
+	OffsetEnd = int64(kafka.OffsetEnd)
+)
+
+//TopicReader reads partitions of a topic from a start offset without joining a consumer group or committing offsets
+type TopicReader struct {
+	Topic    string
+	Consumer *kafka.Consumer
+	mutex    sync.Mutex
+	atEnd    map[int32]bool
+}
+
+//newTopicReader assigns the partitions of the topic starting at the offset, no partitions means all partitions
+func newTopicReader(topic string, clientID string, partitions []int32, offset int64) (*TopicReader, error) {
+	consumer, err := kafka.NewConsumer(
+		&kafka.ConfigMap{
+			"bootstrap.servers":      bootstrapServers,
+			"group.id":               clientID + "-reader",
+			"enable.auto.commit":     false,
+			"enable.partition.eof":   true,
+			"go.logs.channel.enable": true,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create kafka consumer error [%#v]", err)
+	}
+	go newEventLogger(clientID + "-reader").forwardLogs(consumer.Logs())
+	r := &TopicReader{Topic: topic, Consumer: consumer, atEnd: map[int32]bool{}}
+
+	if len(partitions) == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultAdminTimeout)
+		defer cancel()
+		toppars, err := topicPartitions(ctx, consumer, []string{topic})
+		if err != nil {
+			consumer.Close()
+			return nil, err
+		}
+		for _, toppar := range toppars {
+			partitions = append(partitions, toppar.Partition)
+		}
+	}
+
+	toppars := make([]kafka.TopicPartition, len(partitions))
+	for i, partition := range partitions {
+		toppars[i] = kafka.TopicPartition{Topic: &r.Topic, Partition: partition, Offset: kafka.Offset(offset)}
+		r.atEnd[partition] = false
+	}
+	err = consumer.Assign(toppars)
+	if err != nil {
+		consumer.Close()
+		return nil, fmt.Errorf("cannot assign partitions of topic [%s] error [%v]", topic, err)
+	}
+	return r, nil
+}
+
+//ReadMessage polls the next message, nil is returned if there was no message within the timeout
+func (r *TopicReader) ReadMessage(timeoutMs int) (*kafka.Message, error) {
+	switch e := r.Consumer.Poll(timeoutMs).(type) {
+	case *kafka.Message:
+		if e.TopicPartition.Error != nil {
+			return nil, fmt.Errorf("topic reader [%s] message error [%v]", e.TopicPartition, e.TopicPartition.Error)
+		}
+		r.setAtEnd(e.TopicPartition.Partition, false)
+		return e, nil
+	case kafka.PartitionEOF:
+		r.setAtEnd(e.Partition, true)
+	case kafka.Error:
+		return nil, fmt.Errorf("topic reader [%s] error [%v]", r.Topic, e)
+	}
+	return nil, nil
+}
+
+func (r *TopicReader) setAtEnd(partition int32, atEnd bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.atEnd[partition] = atEnd
+}
+
+//AtEnd returns true if all assigned partitions are read up to the last message
+func (r *TopicReader) AtEnd() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, atEnd := range r.atEnd {
+		if !atEnd {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *TopicReader) isAtEnd(partition int32) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.atEnd[partition]
+}
+
+//Close closes the consumer
+func (r *TopicReader) Close() {
+	r.Consumer.Close()
+}
@@ -0,0 +1,352 @@
+package confluent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"gopkg.in/yaml.v2"
+)
+
+//TopicChangeType is the kind of change to reconcile a topic with its spec
+type TopicChangeType string
+
+const (
+	//TopicCreate creates a missing topic
+	TopicCreate TopicChangeType = "create"
+	//TopicIncreasePartitions adds partitions to a topic
+	TopicIncreasePartitions TopicChangeType = "partitions"
+	//TopicAlterConfig changes topic config entries
+	TopicAlterConfig TopicChangeType = "config"
+)
+
+//TopicSpecFile holds the topic specs of a service
+type TopicSpecFile struct {
+	Topics []TopicSpec `json:"topics"`
+}
+
+//TopicChange is a single change of a topic plan
+type TopicChange struct {
+	Type    TopicChangeType
+	Spec    TopicSpec
+	Current TopicSpec
+	Config  map[string]string
+}
+
+//TopicPlan holds the changes to reconcile the cluster with the specs and the refused unsafe changes
+type TopicPlan struct {
+	Changes []TopicChange
+	Refused []string
+}
+
+//LoadTopicSpecs reads the topic spec file, files ending with .yaml or .yml are parsed as yaml, others as json
+//every topic needs a name, a partition count and a replication factor
+func LoadTopicSpecs(path string) ([]TopicSpec, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read topic spec file [%s] error [%v]", path, err)
+	}
+	extension := strings.ToLower(filepath.Ext(path))
+	specs, err := parseTopicSpecs(content, extension == ".yaml" || extension == ".yml")
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse topic spec file [%s] error [%v]", path, err)
+	}
+	return specs, nil
+}
+
+//parseTopicSpecs parses and validates the json or yaml topic specs
+func parseTopicSpecs(content []byte, isYAML bool) ([]TopicSpec, error) {
+	var document interface{}
+	var err error
+	if isYAML {
+		document, err = decodeYAML(content)
+	} else {
+		document, err = decodeJSON(content)
+	}
+	if err != nil {
+		return nil, err
+	}
+	specFile, err := decodeTopicSpecFile(document)
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range specFile.Topics {
+		if spec.Topic == "" || spec.Partitions <= 0 {
+			return nil, fmt.Errorf("topic spec invalid [%s] partitions [%d]", spec.Topic, spec.Partitions)
+		}
+		if spec.ReplicationFactor <= 0 {
+			//the admin api of the client cannot create topics with the broker default
+			return nil, fmt.Errorf("topic spec invalid [%s] replication factor missing", spec.Topic)
+		}
+	}
+	return specFile.Topics, nil
+}
+
+//decodeYAML parses the yaml document into string keyed maps like the json decoder
+func decodeYAML(content []byte) (interface{}, error) {
+	var document interface{}
+	err := yaml.Unmarshal(content, &document)
+	if err != nil {
+		return nil, err
+	}
+	return stringKeys(document)
+}
+
+//stringKeys converts the maps of a yaml document to string keys and the scalars other than strings to their yaml text
+func stringKeys(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, entry := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("yaml key [%v] is not a string", key)
+			}
+			var err error
+			converted[name], err = stringKeys(entry)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return converted, nil
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, entry := range v {
+			var err error
+			converted[i], err = stringKeys(entry)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return converted, nil
+	case nil, string:
+		return v, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+//decodeTopicSpecFile converts the parsed json or yaml document, numbers are accepted as strings too
+func decodeTopicSpecFile(document interface{}) (*TopicSpecFile, error) {
+	root, ok := document.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("topic spec document is not a mapping")
+	}
+	topics, ok := root["topics"].([]interface{})
+	if !ok && root["topics"] != nil {
+		return nil, fmt.Errorf("topics is not a list")
+	}
+	specFile := &TopicSpecFile{}
+	for i, topic := range topics {
+		entry, ok := topic.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("topic [%d] is not a mapping", i)
+		}
+		var spec TopicSpec
+		var err error
+		spec.Topic, err = specString(entry["topic"])
+		if err == nil {
+			spec.Partitions, err = specInt(entry["partitions"])
+		}
+		if err == nil {
+			spec.ReplicationFactor, err = specInt(entry["replicationFactor"])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("topic [%d] invalid error [%v]", i, err)
+		}
+		if entry["config"] != nil {
+			config, ok := entry["config"].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("topic [%s] config is not a mapping", spec.Topic)
+			}
+			spec.Config = map[string]string{}
+			for name, value := range config {
+				spec.Config[name], err = specString(value)
+				if err != nil {
+					return nil, fmt.Errorf("topic [%s] config [%s] invalid error [%v]", spec.Topic, name, err)
+				}
+			}
+		}
+		specFile.Topics = append(specFile.Topics, spec)
+	}
+	return specFile, nil
+}
+
+func specString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("scalar expected but was [%v]", value)
+}
+
+func specInt(value interface{}) (int, error) {
+	text, err := specString(value)
+	if err != nil || text == "" {
+		return 0, err
+	}
+	number, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("integer expected but was [%s]", text)
+	}
+	return number, nil
+}
+
+//PlanTopics compares the specs with the cluster metadata and topic configs
+//config entries not listed in the spec are not changed
+func (a *TopicAdmin) PlanTopics(ctx context.Context, specs []TopicSpec) (*TopicPlan, error) {
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+
+	metadata, err := getClusterMetadata(ctx, a.AdminClient)
+	if err != nil {
+		return nil, err
+	}
+	return planTopics(ctx, specs, metadata, a.DescribeTopicConfig)
+}
+
+//planTopics compares the specs with the metadata, the config of a topic is only described if its spec lists config entries
+func planTopics(ctx context.Context, specs []TopicSpec, metadata *ClusterMetadata, describeConfig func(ctx context.Context, topic string) (ConfigResult, error)) (*TopicPlan, error) {
+	plan := &TopicPlan{}
+	for _, spec := range specs {
+		topicMetadata, exists := metadata.Topics[spec.Topic]
+		if exists && topicMetadata.Error != nil && !isUnknownTopic(topicMetadata.Error) {
+			//e.g. authorization failed or leader not available, the topic may exist
+			return nil, fmt.Errorf("cannot plan topic [%s] metadata error [%v]", spec.Topic, topicMetadata.Error)
+		}
+		if !exists || len(topicMetadata.Partitions) == 0 {
+			if spec.ReplicationFactor <= 0 {
+				plan.Refused = append(plan.Refused, fmt.Sprintf("topic [%s] cannot be created without replication factor", spec.Topic))
+				continue
+			}
+			plan.Changes = append(plan.Changes, TopicChange{Type: TopicCreate, Spec: spec, Config: spec.Config})
+			continue
+		}
+
+		current := TopicSpec{
+			Topic:             spec.Topic,
+			Partitions:        len(topicMetadata.Partitions),
+			ReplicationFactor: len(topicMetadata.Partitions[0].Replicas),
+		}
+		switch {
+		case spec.Partitions < current.Partitions:
+			plan.Refused = append(plan.Refused, fmt.Sprintf("topic [%s] partitions cannot decrease from [%d] to [%d]", spec.Topic, current.Partitions, spec.Partitions))
+		case spec.Partitions > current.Partitions:
+			plan.Changes = append(plan.Changes, TopicChange{Type: TopicIncreasePartitions, Spec: spec, Current: current})
+		}
+		if spec.ReplicationFactor > 0 && spec.ReplicationFactor != current.ReplicationFactor {
+			plan.Refused = append(plan.Refused, fmt.Sprintf("topic [%s] replication factor cannot change from [%d] to [%d]", spec.Topic, current.ReplicationFactor, spec.ReplicationFactor))
+		}
+
+		if len(spec.Config) == 0 {
+			continue
+		}
+		config, err := describeConfig(ctx, spec.Topic)
+		if err != nil {
+			return nil, err
+		}
+		current.Config = map[string]string{}
+		changed := map[string]string{}
+		for name, value := range spec.Config {
+			current.Config[name] = config.Config[name].Value
+			if config.Config[name].Value != value {
+				changed[name] = value
+			}
+		}
+		if len(changed) > 0 {
+			plan.Changes = append(plan.Changes, TopicChange{Type: TopicAlterConfig, Spec: spec, Current: current, Config: changed})
+		}
+	}
+	return plan, nil
+}
+
+func isUnknownTopic(err error) bool {
+	kafkaErr, ok := err.(kafka.Error)
+	return ok && (kafkaErr.Code() == kafka.ErrUnknownTopicOrPart || kafkaErr.Code() == kafka.ErrUnknownTopic)
+}
+
+//HasChanges returns true if the plan changes the cluster
+func (p *TopicPlan) HasChanges() bool {
+	return len(p.Changes) > 0
+}
+
+//Write prints the plan
+func (p *TopicPlan) Write(writer io.Writer) {
+	if !p.HasChanges() && len(p.Refused) == 0 {
+		fmt.Fprintf(writer, "topics are up to date\n")
+		return
+	}
+	for _, change := range p.Changes {
+		switch change.Type {
+		case TopicCreate:
+			fmt.Fprintf(writer, "+ create topic [%s] partitions [%d] replication factor [%d]%s\n", change.Spec.Topic, change.Spec.Partitions, change.Spec.ReplicationFactor, formatConfig(change.Config))
+		case TopicIncreasePartitions:
+			fmt.Fprintf(writer, "~ topic [%s] partitions [%d] -> [%d]\n", change.Spec.Topic, change.Current.Partitions, change.Spec.Partitions)
+		case TopicAlterConfig:
+			for _, name := range sortedKeys(change.Config) {
+				fmt.Fprintf(writer, "~ topic [%s] config [%s] [%s] -> [%s]\n", change.Spec.Topic, name, change.Current.Config[name], change.Config[name])
+			}
+		}
+	}
+	for _, refused := range p.Refused {
+		fmt.Fprintf(writer, "! refused %s\n", refused)
+	}
+}
+
+//ApplyTopicPlan executes the plan, plans with refused changes are not applied
+func (a *TopicAdmin) ApplyTopicPlan(ctx context.Context, plan *TopicPlan) error {
+	if len(plan.Refused) > 0 {
+		return fmt.Errorf("topic plan contains unsafe changes [%s]", strings.Join(plan.Refused, ", "))
+	}
+	for _, change := range plan.Changes {
+		var err error
+		switch change.Type {
+		case TopicCreate:
+			err = a.CreateTopic(ctx, change.Spec)
+		case TopicIncreasePartitions:
+			var results []TopicResult
+			results, err = a.CreatePartitions(ctx, map[string]int{change.Spec.Topic: change.Spec.Partitions})
+			if err == nil {
+				err = firstTopicError(results)
+			}
+		case TopicAlterConfig:
+			err = a.AlterTopicConfig(ctx, change.Spec.Topic, change.Config)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot apply [%s] to topic [%s] error [%v]", change.Type, change.Spec.Topic, err)
+		}
+	}
+	return nil
+}
+
+func formatConfig(config map[string]string) string {
+	if len(config) == 0 {
+		return ""
+	}
+	var entries []string
+	for _, name := range sortedKeys(config) {
+		entries = append(entries, name+"="+config[name])
+	}
+	return " config [" + strings.Join(entries, ", ") + "]"
+}
+
+func sortedKeys(config map[string]string) []string {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
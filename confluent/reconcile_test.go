@@ -0,0 +1,241 @@
+package confluent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+var expectedTopicSpecs = []TopicSpec{
+	{Topic: "customer-state", Partitions: 6, ReplicationFactor: 3, Config: map[string]string{"cleanup.policy": "compact", "retention.ms": "-1"}},
+	{Topic: "orders", Partitions: 12, ReplicationFactor: 2},
+}
+
+const topicSpecJSON = `{
+  "topics": [
+    {
+      "topic": "customer-state",
+      "partitions": 6,
+      "replicationFactor": 3,
+      "config": {
+        "cleanup.policy": "compact",
+        "retention.ms": "-1"
+      }
+    },
+    {"topic": "orders", "partitions": 12, "replicationFactor": 2}
+  ]
+}`
+
+const topicSpecYAML = `# topics of the customer service
+---
+topics:
+  - topic: customer-state
+    partitions: 6
+    replicationFactor: 3
+    config:
+      cleanup.policy: compact # state store
+      "retention.ms": -1
+  - topic: 'orders'
+    partitions: "12"
+    replicationFactor: 2
+`
+
+func TestLoadTopicSpecs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "specs")
+	if err != nil {
+		t.Fatalf("cannot create temp dir error [%v]", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{"topics.json": topicSpecJSON, "topics.yaml": topicSpecYAML, "topics.YML": topicSpecYAML} {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, []byte(content), 0644)
+		specs, err := LoadTopicSpecs(path)
+		if err != nil {
+			t.Errorf("cannot load [%s] error [%v]", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(specs, expectedTopicSpecs) {
+			t.Errorf("specs of [%s] expected %+v but was %+v", name, expectedTopicSpecs, specs)
+		}
+	}
+	if _, err = LoadTopicSpecs(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("missing file expected error")
+	}
+}
+
+func TestParseTopicSpecsInvalid(t *testing.T) {
+	cases := []struct {
+		name    string
+		yaml    bool
+		content string
+		err     string
+	}{
+		{"replication factor missing json", false, `{"topics": [{"topic": "a", "partitions": 1}]}`, "replication factor missing"},
+		{"replication factor missing yaml", true, "topics:\n- topic: a\n  partitions: 1\n", "replication factor missing"},
+		{"replication factor zero", false, `{"topics": [{"topic": "a", "partitions": 1, "replicationFactor": 0}]}`, "replication factor missing"},
+		{"partitions missing", true, "topics:\n  - topic: a\n    replicationFactor: 1\n", "partitions [0]"},
+		{"topic missing", false, `{"topics": [{"partitions": 1, "replicationFactor": 1}]}`, "topic spec invalid"},
+		{"partitions not a number", true, "topics:\n  - topic: a\n    partitions: six\n    replicationFactor: 1\n", "integer expected"},
+		{"config not a mapping", false, `{"topics": [{"topic": "a", "partitions": 1, "replicationFactor": 1, "config": ["x"]}]}`, "config is not a mapping"},
+		{"topics not a list", true, "topics: all\n", "not a list"},
+		{"document not a mapping", true, "- a\n", "not a mapping"},
+		{"json invalid", false, `{"topics": [`, "EOF"},
+		{"yaml indentation", true, "topics:\n  - topic: a\n      partitions: 1\n", "yaml: line 3"},
+		{"yaml topic not a mapping", true, "topics: [a, b]\n", "topic [0] is not a mapping"},
+		{"yaml key not a string", true, "topics:\n  - topic: a\n    1: x\n", "key [1] is not a string"},
+	}
+	for _, c := range cases {
+		_, err := parseTopicSpecs([]byte(c.content), c.yaml)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("[%s] expected error [%s] but was [%v]", c.name, c.err, err)
+		}
+	}
+}
+
+func TestDecodeYAML(t *testing.T) {
+	cases := []struct {
+		content  string
+		expected interface{}
+	}{
+		{"", nil},
+		{"a: 1\nb: text\nc:\nd: true\ne: 1.5\n", map[string]interface{}{"a": "1", "b": "text", "c": nil, "d": "true", "e": "1.5"}},
+		{"a:\n  b: [x, 2]\n  c: {d: z}\n", map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{"x", "2"}, "c": map[string]interface{}{"d": "z"}}}},
+		{"base: &base\n  retention.ms: -1\ncopy: *base\n", map[string]interface{}{"base": map[string]interface{}{"retention.ms": "-1"}, "copy": map[string]interface{}{"retention.ms": "-1"}}},
+	}
+	for _, c := range cases {
+		value, err := decodeYAML([]byte(c.content))
+		if err != nil {
+			t.Errorf("cannot decode [%q] error [%v]", c.content, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, c.expected) {
+			t.Errorf("yaml [%q] expected %#v but was %#v", c.content, c.expected, value)
+		}
+	}
+}
+
+func testClusterMetadata(topics map[string][2]int) *ClusterMetadata {
+	metadata := &ClusterMetadata{Topics: map[string]TopicInfo{}}
+	for name, layout := range topics {
+		info := TopicInfo{Topic: name}
+		for partition := 0; partition < layout[0]; partition++ {
+			info.Partitions = append(info.Partitions, PartitionInfo{ID: int32(partition), Replicas: make([]int32, layout[1])})
+		}
+		metadata.Topics[name] = info
+	}
+	return metadata
+}
+
+func TestPlanTopics(t *testing.T) {
+	metadata := testClusterMetadata(map[string][2]int{"existing": {6, 3}, "shrink": {6, 3}, "replicas": {4, 2}})
+	configs := map[string]map[string]ConfigValue{
+		"existing": {"cleanup.policy": {Value: "compact"}, "retention.ms": {Value: "1000"}},
+	}
+	var described []string
+	describe := func(ctx context.Context, topic string) (ConfigResult, error) {
+		described = append(described, topic)
+		return ConfigResult{Name: topic, Config: configs[topic]}, nil
+	}
+
+	specs := []TopicSpec{
+		{Topic: "new", Partitions: 3, ReplicationFactor: 2, Config: map[string]string{"cleanup.policy": "compact"}},
+		{Topic: "existing", Partitions: 8, ReplicationFactor: 3, Config: map[string]string{"cleanup.policy": "compact", "retention.ms": "2000", "segment.ms": "60000"}},
+		{Topic: "shrink", Partitions: 3, ReplicationFactor: 3},
+		{Topic: "replicas", Partitions: 4, ReplicationFactor: 3},
+		{Topic: "no-replication-factor", Partitions: 1},
+	}
+	plan, err := planTopics(context.Background(), specs, metadata, describe)
+	if err != nil {
+		t.Fatalf("cannot plan error [%v]", err)
+	}
+
+	expected := []TopicChange{
+		{Type: TopicCreate, Spec: specs[0], Config: specs[0].Config},
+		{Type: TopicIncreasePartitions, Spec: specs[1], Current: TopicSpec{Topic: "existing", Partitions: 6, ReplicationFactor: 3}},
+		{Type: TopicAlterConfig, Spec: specs[1],
+			Current: TopicSpec{Topic: "existing", Partitions: 6, ReplicationFactor: 3, Config: map[string]string{"cleanup.policy": "compact", "retention.ms": "1000", "segment.ms": ""}},
+			Config:  map[string]string{"retention.ms": "2000", "segment.ms": "60000"}},
+	}
+	if !reflect.DeepEqual(plan.Changes, expected) {
+		t.Errorf("changes expected\n%+v\nbut was\n%+v", expected, plan.Changes)
+	}
+	expectedRefused := []string{
+		"topic [shrink] partitions cannot decrease from [6] to [3]",
+		"topic [replicas] replication factor cannot change from [2] to [3]",
+		"topic [no-replication-factor] cannot be created without replication factor",
+	}
+	if !reflect.DeepEqual(plan.Refused, expectedRefused) {
+		t.Errorf("refused expected %v but was %v", expectedRefused, plan.Refused)
+	}
+	if !reflect.DeepEqual(described, []string{"existing"}) {
+		t.Errorf("only topics with config in the spec expected to be described but was %v", described)
+	}
+
+	err = (&TopicAdmin{}).ApplyTopicPlan(context.Background(), plan)
+	if err == nil || !strings.Contains(err.Error(), "unsafe changes") {
+		t.Errorf("plan with refused changes expected not to be applied but was [%v]", err)
+	}
+
+	var output bytes.Buffer
+	plan.Write(&output)
+	for _, line := range []string{
+		"+ create topic [new] partitions [3] replication factor [2] config [cleanup.policy=compact]",
+		"~ topic [existing] partitions [6] -> [8]",
+		"~ topic [existing] config [retention.ms] [1000] -> [2000]",
+		"~ topic [existing] config [segment.ms] [] -> [60000]",
+		"! refused topic [shrink] partitions cannot decrease from [6] to [3]",
+	} {
+		if !strings.Contains(output.String(), line+"\n") {
+			t.Errorf("plan output misses [%s] in\n%s", line, output.String())
+		}
+	}
+}
+
+func TestPlanTopicsUpToDate(t *testing.T) {
+	metadata := testClusterMetadata(map[string][2]int{"orders": {12, 2}})
+	describe := func(ctx context.Context, topic string) (ConfigResult, error) {
+		return ConfigResult{Config: map[string]ConfigValue{"retention.ms": {Value: "1000"}}}, nil
+	}
+	specs := []TopicSpec{{Topic: "orders", Partitions: 12, ReplicationFactor: 2, Config: map[string]string{"retention.ms": "1000"}}}
+	plan, err := planTopics(context.Background(), specs, metadata, describe)
+	if err != nil || plan.HasChanges() || len(plan.Refused) != 0 {
+		t.Errorf("plan expected without changes but was %+v error [%v]", plan, err)
+	}
+	var output bytes.Buffer
+	plan.Write(&output)
+	if output.String() != "topics are up to date\n" {
+		t.Errorf("plan output unexpected [%s]", output.String())
+	}
+
+	unknown := testClusterMetadata(nil)
+	unknown.Topics["orders"] = TopicInfo{Topic: "orders", Error: kafka.NewError(kafka.ErrUnknownTopicOrPart, "", false)}
+	plan, err = planTopics(context.Background(), specs, unknown, describe)
+	if err != nil || len(plan.Changes) != 1 || plan.Changes[0].Type != TopicCreate {
+		t.Errorf("unknown topic expected to be created but was %+v error [%v]", plan, err)
+	}
+	for _, code := range []kafka.ErrorCode{kafka.ErrTopicAuthorizationFailed, kafka.ErrLeaderNotAvailable} {
+		unavailable := testClusterMetadata(nil)
+		unavailable.Topics["orders"] = TopicInfo{Topic: "orders", Error: kafka.NewError(code, "", false)}
+		plan, err = planTopics(context.Background(), specs, unavailable, describe)
+		if err == nil {
+			t.Errorf("metadata error [%v] expected to fail the plan but was %+v", code, plan)
+		}
+	}
+
+	failing := func(ctx context.Context, topic string) (ConfigResult, error) {
+		return ConfigResult{}, fmt.Errorf("describe failed")
+	}
+	_, err = planTopics(context.Background(), specs, metadata, failing)
+	if err == nil {
+		t.Errorf("describe error expected to fail the plan")
+	}
+}
@@ -2,17 +2,23 @@ package confluent
 
 import (
 	"fmt"
+	"sync"
 
 	schemaregistry "github.com/landoop/schema-registry"
 	"github.com/rbock44/okfw-kafka-go/kafka"
 )
 
+//schemaClientMutex guards the registry url and the registry client
+var schemaClientMutex sync.Mutex
+
 var schemaClient *schemaregistry.Client
 
 func getKafkaSchemaClient() *schemaregistry.Client {
+	schemaClientMutex.Lock()
+	defer schemaClientMutex.Unlock()
 	var err error
 	if schemaClient == nil {
-		schemaClient, err = schemaregistry.NewClient(schemaregistry.DefaultUrl)
+		schemaClient, err = schemaregistry.NewClient(schemaRegistryURL)
 		if err != nil {
 			panic(fmt.Sprintf("schema registry client creation error [%v]\n", err))
 		}
@@ -20,6 +26,12 @@ func getKafkaSchemaClient() *schemaregistry.Client {
 	return schemaClient
 }
 
+func getSchemaRegistryURL() string {
+	schemaClientMutex.Lock()
+	defer schemaClientMutex.Unlock()
+	return schemaRegistryURL
+}
+
 type schemaClientType struct{}
 
 func newSchemaResolver() kafka.SchemaResolver {
@@ -34,6 +46,11 @@ func (c *schemaClientType) GetSchemaBySubject(subject string, version int) (sche
 	return schema.ID, nil
 }
 
+//GetSchemaByID returns the schema of the id
+func (c *schemaClientType) GetSchemaByID(id int) (string, error) {
+	return getKafkaSchemaClient().GetSchemaByID(id)
+}
+
 func (c *schemaClientType) RegisterNewSchema(subject string, content string) (schemaID int, err error) {
 	id, err := getKafkaSchemaClient().RegisterNewSchema(subject, content)
 	if err != nil {
@@ -0,0 +1,315 @@
+package confluent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	schemaregistry "github.com/landoop/schema-registry"
+)
+
+//schemaRegistryContentType is the content type of the schema registry rest api
+const schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+//compatibilityLevels are the compatibility levels accepted by the schema registry
+var compatibilityLevels = map[string]bool{
+	"NONE": true, "BACKWARD": true, "BACKWARD_TRANSITIVE": true, "FORWARD": true,
+	"FORWARD_TRANSITIVE": true, "FULL": true, "FULL_TRANSITIVE": true,
+}
+
+//SchemaAdmin administrates the subjects, schemas and compatibility levels of the schema registry
+//subjects and schemas use the registry client, compatibility levels are requested directly
+type SchemaAdmin struct {
+	URL        string
+	HTTPClient *http.Client
+	client     *schemaregistry.Client
+	clientErr  error
+}
+
+//RegisteredSchema is a schema version of a subject
+type RegisteredSchema struct {
+	Subject string `json:"subject,omitempty"`
+	Version int    `json:"version,omitempty"`
+	ID      int    `json:"id"`
+	Schema  string `json:"schema"`
+}
+
+//schemaRegistryError is the error body of the schema registry
+type schemaRegistryError struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+func newSchemaAdmin() *SchemaAdmin {
+	return newSchemaAdminURL(getSchemaRegistryURL())
+}
+
+func newSchemaAdminURL(registryURL string) *SchemaAdmin {
+	registryURL = strings.TrimSuffix(registryURL, "/")
+	if !strings.Contains(registryURL, "://") {
+		registryURL = "http://" + registryURL
+	}
+	admin := &SchemaAdmin{
+		URL:        registryURL,
+		HTTPClient: &http.Client{Timeout: defaultAdminTimeout},
+	}
+	admin.client, admin.clientErr = schemaregistry.NewClient(registryURL, schemaregistry.UsingClient(admin.HTTPClient))
+	return admin
+}
+
+func (a *SchemaAdmin) registry() (*schemaregistry.Client, error) {
+	if a.clientErr != nil {
+		return nil, fmt.Errorf("cannot create schema registry client for [%s] error [%v]", a.URL, a.clientErr)
+	}
+	return a.client, nil
+}
+
+//Subjects returns the registered subjects
+func (a *SchemaAdmin) Subjects() ([]string, error) {
+	client, err := a.registry()
+	if err != nil {
+		return nil, err
+	}
+	subjects, err := client.Subjects()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list subjects error [%v]", registryError(err, http.MethodGet, "/subjects"))
+	}
+	return subjects, nil
+}
+
+//Versions returns the registered versions of the subject
+func (a *SchemaAdmin) Versions(subject string) ([]int, error) {
+	client, err := a.registry()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := client.Versions(url.PathEscape(subject))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list versions of subject [%s] error [%v]", subject, registryError(err, http.MethodGet, subjectPath(subject, "versions")))
+	}
+	return versions, nil
+}
+
+//GetSchemaByID returns the schema with the id
+func (a *SchemaAdmin) GetSchemaByID(id int) (RegisteredSchema, error) {
+	schema := RegisteredSchema{ID: id}
+	client, err := a.registry()
+	if err != nil {
+		return schema, err
+	}
+	schema.Schema, err = client.GetSchemaByID(id)
+	if err != nil {
+		return schema, fmt.Errorf("cannot get schema [%d] error [%v]", id, registryError(err, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id)))
+	}
+	return schema, nil
+}
+
+//GetSchema returns the version of the subject, version 0 returns the latest version
+func (a *SchemaAdmin) GetSchema(subject string, version int) (RegisteredSchema, error) {
+	client, err := a.registry()
+	if err != nil {
+		return RegisteredSchema{}, err
+	}
+	var schema schemaregistry.Schema
+	if version <= 0 {
+		schema, err = client.GetLatestSchema(url.PathEscape(subject))
+	} else {
+		schema, err = client.GetSchemaBySubject(url.PathEscape(subject), version)
+	}
+	if err != nil {
+		err = registryError(err, http.MethodGet, subjectPath(subject, "versions", versionPath(version)))
+		return RegisteredSchema{}, fmt.Errorf("cannot get schema of subject [%s] version [%s] error [%v]", subject, versionPath(version), err)
+	}
+	return RegisteredSchema{Subject: schema.Subject, Version: schema.Version, ID: schema.ID, Schema: schema.Schema}, nil
+}
+
+//Register registers the schema for the subject and returns its id, an already registered schema keeps its id
+func (a *SchemaAdmin) Register(subject string, schema string) (int, error) {
+	client, err := a.registry()
+	if err != nil {
+		return 0, err
+	}
+	id, err := client.RegisterNewSchema(url.PathEscape(subject), schema)
+	if err != nil {
+		return 0, fmt.Errorf("cannot register schema for subject [%s] error [%v]", subject, registryError(err, http.MethodPost, subjectPath(subject, "versions")))
+	}
+	return id, nil
+}
+
+//TestCompatibility tests the schema against the version of the subject, version 0 tests against the latest version
+func (a *SchemaAdmin) TestCompatibility(subject string, version int, schema string) (bool, error) {
+	var result struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	path := "/compatibility" + subjectPath(subject, "versions", versionPath(version))
+	err := a.request(http.MethodPost, path, map[string]string{"schema": schema}, &result)
+	if err != nil {
+		return false, fmt.Errorf("cannot test compatibility with subject [%s] error [%v]", subject, err)
+	}
+	return result.IsCompatible, nil
+}
+
+//GetCompatibility returns the compatibility level of the subject, an empty subject returns the global level
+//a subject without own level returns the global level
+func (a *SchemaAdmin) GetCompatibility(subject string) (string, error) {
+	var result struct {
+		CompatibilityLevel string `json:"compatibilityLevel"`
+	}
+	err := a.request(http.MethodGet, configPath(subject), nil, &result)
+	if err != nil && subject != "" && isSchemaRegistryNotFound(err) {
+		return a.GetCompatibility("")
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot get compatibility of subject [%s] error [%v]", subject, err)
+	}
+	return result.CompatibilityLevel, nil
+}
+
+//SetCompatibility sets the compatibility level of the subject, an empty subject sets the global level
+func (a *SchemaAdmin) SetCompatibility(subject string, level string) error {
+	level = strings.ToUpper(level)
+	if !compatibilityLevels[level] {
+		return fmt.Errorf("compatibility level unknown [%s]", level)
+	}
+	err := a.request(http.MethodPut, configPath(subject), map[string]string{"compatibility": level}, nil)
+	if err != nil {
+		return fmt.Errorf("cannot set compatibility of subject [%s] error [%v]", subject, err)
+	}
+	return nil
+}
+
+//DeleteSubject soft deletes all versions of the subject and returns the deleted versions
+//soft deleted schemas stay readable by id so consumers can still decode existing messages
+func (a *SchemaAdmin) DeleteSubject(subject string) ([]int, error) {
+	client, err := a.registry()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := client.DeleteSubject(url.PathEscape(subject))
+	if err != nil {
+		return nil, fmt.Errorf("cannot delete subject [%s] error [%v]", subject, registryError(err, http.MethodDelete, subjectPath(subject)))
+	}
+	return versions, nil
+}
+
+//SchemasEqual compares two avro schemas ignoring formatting
+func SchemasEqual(a string, b string) (bool, error) {
+	normalizedA, err := NormalizeSchema(a)
+	if err != nil {
+		return false, err
+	}
+	normalizedB, err := NormalizeSchema(b)
+	if err != nil {
+		return false, err
+	}
+	return normalizedA == normalizedB, nil
+}
+
+//NormalizeSchema formats the avro schema as indented json with sorted keys
+func NormalizeSchema(schema string) (string, error) {
+	parsed, err := decodeJSON([]byte(schema))
+	if err != nil {
+		return "", fmt.Errorf("cannot parse schema error [%v]", err)
+	}
+	normalized, err := json.MarshalIndent(parsed, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("cannot format schema error [%v]", err)
+	}
+	return string(normalized), nil
+}
+
+//request sends the calls the registry client does not provide
+func (a *SchemaAdmin) request(method string, path string, body interface{}, result interface{}) error {
+	var content []byte
+	if body != nil {
+		var err error
+		content, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	request, err := http.NewRequest(method, a.URL+path, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", schemaRegistryContentType)
+	if body != nil {
+		request.Header.Set("Content-Type", schemaRegistryContentType)
+	}
+
+	response, err := a.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		registryErr := schemaregistry.ResourceError{ErrorCode: response.StatusCode, Method: method, URI: path}
+		if len(responseBody) > 0 {
+			registryErr.Message = "\n" + string(responseBody)
+		}
+		return registryError(registryErr, method, path)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(responseBody, result)
+}
+
+//registryError maps the error body of the schema registry to the error code and message of the resource error
+//the registry client keeps the body of the schema registry content type as message and drops method and uri of a json body
+func registryError(err error, method string, path string) error {
+	registryErr, ok := err.(schemaregistry.ResourceError)
+	if !ok {
+		return err
+	}
+	if registryErr.Method == "" {
+		registryErr.Method = method
+		registryErr.URI = path
+		if registryErr.Message != "" {
+			registryErr.Message = ": " + registryErr.Message
+		}
+		return registryErr
+	}
+	var registryBody schemaRegistryError
+	if json.Unmarshal([]byte(strings.TrimPrefix(registryErr.Message, "\n")), &registryBody) == nil && registryBody.ErrorCode != 0 {
+		registryErr.ErrorCode = registryBody.ErrorCode
+		registryErr.Message = ": " + registryBody.Message
+	}
+	return registryErr
+}
+
+//isSchemaRegistryNotFound returns true for the not found http status and the registry not found error codes
+func isSchemaRegistryNotFound(err error) bool {
+	registryErr, ok := err.(schemaregistry.ResourceError)
+	return ok && (registryErr.ErrorCode == http.StatusNotFound || registryErr.ErrorCode/100 == http.StatusNotFound)
+}
+
+func subjectPath(subject string, elements ...string) string {
+	path := "/subjects/" + url.PathEscape(subject)
+	for _, element := range elements {
+		path += "/" + element
+	}
+	return path
+}
+
+func versionPath(version int) string {
+	if version <= 0 {
+		return "latest"
+	}
+	return fmt.Sprintf("%d", version)
+}
+
+func configPath(subject string) string {
+	if subject == "" {
+		return "/config"
+	}
+	return "/config/" + url.PathEscape(subject)
+}
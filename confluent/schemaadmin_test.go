@@ -0,0 +1,182 @@
+package confluent
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//registryResponse is the canned response of the test schema registry for a method and escaped path
+type registryResponse struct {
+	status      int
+	contentType string
+	body        string
+}
+
+//newTestSchemaRegistry serves the responses and records the escaped paths of the requests
+func newTestSchemaRegistry(t *testing.T, responses map[string]registryResponse) (*SchemaAdmin, func() []string) {
+	var mutex sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.EscapedPath()
+		mutex.Lock()
+		requests = append(requests, key)
+		mutex.Unlock()
+		response, ok := responses[key]
+		if !ok {
+			response = registryResponse{status: http.StatusNotFound, body: `{"error_code": 404, "message": "HTTP 404 Not Found"}`}
+		}
+		if response.contentType == "" {
+			response.contentType = schemaRegistryContentType
+		}
+		if response.status == 0 {
+			response.status = http.StatusOK
+		}
+		w.Header().Set("Content-Type", response.contentType)
+		w.WriteHeader(response.status)
+		fmt.Fprint(w, response.body)
+	}))
+	t.Cleanup(server.Close)
+	return newSchemaAdminURL(server.URL), func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+func TestSchemaAdminCompatibilityFallback(t *testing.T) {
+	admin, requests := newTestSchemaRegistry(t, map[string]registryResponse{
+		"GET /config":        {body: `{"compatibilityLevel": "FULL"}`},
+		"GET /config/orders": {body: `{"compatibilityLevel": "BACKWARD"}`},
+		"GET /config/users":  {status: http.StatusNotFound, body: `{"error_code": 40401, "message": "Subject not found."}`},
+		"GET /config/broken": {status: http.StatusInternalServerError, body: `{"error_code": 50001, "message": "Error in the backend datastore"}`},
+	})
+
+	tests := []struct {
+		subject  string
+		expected string
+	}{
+		{"", "FULL"},
+		{"orders", "BACKWARD"},
+		{"users", "FULL"},
+	}
+	for _, test := range tests {
+		level, err := admin.GetCompatibility(test.subject)
+		if err != nil || level != test.expected {
+			t.Errorf("subject [%s] expected level [%s] but was [%s] error [%v]", test.subject, test.expected, level, err)
+		}
+	}
+	expected := "GET /config,GET /config/orders,GET /config/users,GET /config"
+	if actual := strings.Join(requests(), ","); actual != expected {
+		t.Errorf("expected requests [%s] but was [%s]", expected, actual)
+	}
+
+	//only not found falls back to the global level
+	_, err := admin.GetCompatibility("broken")
+	if err == nil || !strings.Contains(err.Error(), "50001") {
+		t.Errorf("backend error expected but was [%v]", err)
+	}
+}
+
+func TestSchemaAdminErrorBody(t *testing.T) {
+	invalid := `{"error_code": 42201, "message": "Input schema is an invalid Avro schema"}`
+	admin, _ := newTestSchemaRegistry(t, map[string]registryResponse{
+		"POST /subjects/registry/versions":               {status: http.StatusUnprocessableEntity, body: invalid},
+		"POST /subjects/json/versions":                   {status: http.StatusUnprocessableEntity, contentType: "application/json", body: invalid},
+		"PUT /config/registry":                           {status: http.StatusUnprocessableEntity, body: `{"error_code": 42203, "message": "Invalid compatibility level"}`},
+		"GET /subjects/plain/versions":                   {status: http.StatusBadGateway, contentType: "text/plain", body: "bad gateway"},
+		"GET /subjects/missing/versions/15":              {status: http.StatusNotFound, body: `{"error_code": 40402, "message": "Version not found."}`},
+		"DELETE /subjects/missing":                       {status: http.StatusNotFound, body: `{"error_code": 40401, "message": "Subject not found."}`},
+		"POST /compatibility/subjects/x/versions/latest": {status: http.StatusNotFound, contentType: "text/html", body: "<html></html>"},
+	})
+
+	expectError := func(name string, err error, code int, message string) {
+		if err == nil {
+			t.Errorf("%s expected error", name)
+			return
+		}
+		if !strings.Contains(err.Error(), fmt.Sprintf("error code %d%s", code, message)) {
+			t.Errorf("%s expected error code [%d] and message [%s] but was [%v]", name, code, message, err)
+		}
+	}
+	_, err := admin.Register("registry", `"string"`)
+	expectError("register", err, 42201, ": Input schema is an invalid Avro schema")
+	_, err = admin.Register("json", `"string"`)
+	expectError("register json", err, 42201, ": Input schema is an invalid Avro schema")
+	if !strings.Contains(err.Error(), "POST") || !strings.Contains(err.Error(), "/subjects/json/versions") {
+		t.Errorf("error of a json body expected method and uri but was [%v]", err)
+	}
+	err = admin.SetCompatibility("registry", "backward")
+	expectError("set compatibility", err, 42203, ": Invalid compatibility level")
+	_, err = admin.Versions("plain")
+	expectError("versions", err, http.StatusBadGateway, "\nbad gateway")
+	_, err = admin.GetSchema("missing", 15)
+	expectError("get schema", err, 40402, ": Version not found.")
+	_, err = admin.DeleteSubject("missing")
+	expectError("delete subject", err, 40401, ": Subject not found.")
+	_, err = admin.TestCompatibility("x", 0, `"string"`)
+	expectError("test compatibility", err, http.StatusNotFound, "\n<html></html>")
+
+	err = admin.SetCompatibility("registry", "sideways")
+	if err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("unknown level expected error but was [%v]", err)
+	}
+}
+
+func TestSchemaAdminSubjectEscaping(t *testing.T) {
+	subject := "team/orders value?"
+	escaped := "team%2Forders%20value%3F"
+	schema := `{"subject": "team/orders value?", "version": 2, "id": 7, "schema": "\"string\""}`
+	admin, requests := newTestSchemaRegistry(t, map[string]registryResponse{
+		"GET /subjects/" + escaped + "/versions":                  {body: `[1, 2]`},
+		"GET /subjects/" + escaped + "/versions/latest":           {body: schema},
+		"GET /subjects/" + escaped + "/versions/2":                {body: schema},
+		"POST /subjects/" + escaped + "/versions":                 {body: `{"id": 7}`},
+		"POST /compatibility/subjects/" + escaped + "/versions/2": {body: `{"is_compatible": true}`},
+		"GET /config/" + escaped:                                  {body: `{"compatibilityLevel": "NONE"}`},
+		"PUT /config/" + escaped:                                  {body: `{"compatibility": "NONE"}`},
+		"DELETE /subjects/" + escaped:                             {body: `[1, 2]`},
+		"GET /schemas/ids/7":                                      {body: `{"schema": "\"string\""}`},
+	})
+
+	versions, err := admin.Versions(subject)
+	if err != nil || len(versions) != 2 {
+		t.Errorf("versions expected [1 2] but was %v error [%v]", versions, err)
+	}
+	for _, version := range []int{0, 2} {
+		registered, err := admin.GetSchema(subject, version)
+		if err != nil || registered.ID != 7 || registered.Version != 2 || registered.Subject != subject || registered.Schema != `"string"` {
+			t.Errorf("version [%d] expected schema 7 but was %+v error [%v]", version, registered, err)
+		}
+	}
+	id, err := admin.Register(subject, `"string"`)
+	if err != nil || id != 7 {
+		t.Errorf("register expected id [7] but was [%d] error [%v]", id, err)
+	}
+	compatible, err := admin.TestCompatibility(subject, 2, `"string"`)
+	if err != nil || !compatible {
+		t.Errorf("test compatibility expected compatible but was [%t] error [%v]", compatible, err)
+	}
+	level, err := admin.GetCompatibility(subject)
+	if err != nil || level != "NONE" {
+		t.Errorf("compatibility expected [NONE] but was [%s] error [%v]", level, err)
+	}
+	err = admin.SetCompatibility(subject, "none")
+	if err != nil {
+		t.Errorf("set compatibility error [%v]", err)
+	}
+	versions, err = admin.DeleteSubject(subject)
+	if err != nil || len(versions) != 2 {
+		t.Errorf("delete expected versions [1 2] but was %v error [%v]", versions, err)
+	}
+	registered, err := admin.GetSchemaByID(7)
+	if err != nil || registered.ID != 7 || registered.Schema != `"string"` {
+		t.Errorf("schema 7 expected but was %+v error [%v]", registered, err)
+	}
+	if len(requests()) != 9 {
+		t.Errorf("expected [9] requests but was %v", requests())
+	}
+}
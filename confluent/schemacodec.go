@@ -0,0 +1,133 @@
+package confluent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+//wireHeaderSize is the size of the magic byte and schema id header of the confluent wire format
+const wireHeaderSize = 5
+
+//SchemaCodec decodes and encodes the confluent wire format with the avro schemas of the registry
+type SchemaCodec struct {
+	mutex    sync.Mutex
+	byID     map[int]*AvroCodec
+	subjects map[string]int
+}
+
+func newSchemaCodec() *SchemaCodec {
+	return &SchemaCodec{
+		byID:     map[int]*AvroCodec{},
+		subjects: map[string]int{},
+	}
+}
+
+//IsWireFormat returns true if the data starts with the magic byte and schema id header
+func IsWireFormat(data []byte) bool {
+	return len(data) >= wireHeaderSize && data[0] == 0
+}
+
+//Decode decodes the wire format data with the schema given in the header
+func (c *SchemaCodec) Decode(data []byte) (schemaID int, value interface{}, err error) {
+	reader := bytes.NewReader(data)
+	id, err := readSchemaID(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	schemaID = int(id)
+	codec, err := c.GetCodec(schemaID)
+	if err != nil {
+		return schemaID, nil, err
+	}
+	value, err = codec.Decode(reader)
+	if err != nil {
+		return schemaID, nil, fmt.Errorf("cannot decode message with schema [%d] error [%v]", schemaID, err)
+	}
+	return schemaID, value, nil
+}
+
+//DecodeJSON decodes the wire format data with the schema given in the header to the avro json encoding
+func (c *SchemaCodec) DecodeJSON(data []byte) (schemaID int, value []byte, err error) {
+	reader := bytes.NewReader(data)
+	id, err := readSchemaID(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	schemaID = int(id)
+	codec, err := c.GetCodec(schemaID)
+	if err != nil {
+		return schemaID, nil, err
+	}
+	value, err = codec.DecodeJSON(data[wireHeaderSize:])
+	if err != nil {
+		return schemaID, nil, fmt.Errorf("cannot decode message with schema [%d] error [%v]", schemaID, err)
+	}
+	return schemaID, value, nil
+}
+
+//EncodeJSON encodes the document in the avro json encoding with the latest schema of the subject to the wire format
+func (c *SchemaCodec) EncodeJSON(subject string, data []byte) ([]byte, error) {
+	schemaID, err := c.getLatestSchemaID(subject)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := c.GetCodec(schemaID)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := codec.EncodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode message with subject [%s] error [%v]", subject, err)
+	}
+	buffer := &bytes.Buffer{}
+	writeSchemaID(buffer, uint32(schemaID))
+	buffer.Write(encoded)
+	return buffer.Bytes(), nil
+}
+
+//GetCodec returns the cached codec of the schema id
+func (c *SchemaCodec) GetCodec(schemaID int) (*AvroCodec, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	codec, ok := c.byID[schemaID]
+	if ok {
+		return codec, nil
+	}
+	schema, err := getKafkaSchemaClient().GetSchemaByID(schemaID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get schema [%d] error [%v]", schemaID, err)
+	}
+	codec, err = NewAvroCodec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse schema [%d] error [%v]", schemaID, err)
+	}
+	c.byID[schemaID] = codec
+	return codec, nil
+}
+
+//getLatestSchemaID returns the schema id of the latest version of the subject, cached for the lifetime of the codec
+func (c *SchemaCodec) getLatestSchemaID(subject string) (int, error) {
+	c.mutex.Lock()
+	schemaID, ok := c.subjects[subject]
+	c.mutex.Unlock()
+	if ok {
+		return schemaID, nil
+	}
+	schema, err := getKafkaSchemaClient().GetLatestSchema(subject)
+	if err != nil {
+		return 0, fmt.Errorf("cannot get latest schema of subject [%s] error [%v]", subject, err)
+	}
+	c.mutex.Lock()
+	c.subjects[subject] = schema.ID
+	c.mutex.Unlock()
+	return schema.ID, nil
+}
+
+//writeSchemaID writes the magic byte and schema id header
+func writeSchemaID(buffer *bytes.Buffer, schemaID uint32) {
+	var header [wireHeaderSize]byte
+	binary.BigEndian.PutUint32(header[1:], schemaID)
+	buffer.Write(header[:])
+}
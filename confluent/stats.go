@@ -0,0 +1,166 @@
+package confluent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//ClientStats are the statistics emitted by librdkafka every statistics interval
+//counters are totals since the client was created, times are in the librdkafka units given by the field names
+type ClientStats struct {
+	Name          string                 `json:"name"`
+	ClientID      string                 `json:"client_id"`
+	Type          string                 `json:"type"`
+	Time          int64                  `json:"time"`
+	QueueMsgs     int64                  `json:"msg_cnt"`
+	QueueBytes    int64                  `json:"msg_size"`
+	ReplyQueue    int64                  `json:"replyq"`
+	Tx            int64                  `json:"tx"`
+	TxBytes       int64                  `json:"tx_bytes"`
+	Rx            int64                  `json:"rx"`
+	RxBytes       int64                  `json:"rx_bytes"`
+	TxMsgs        int64                  `json:"txmsgs"`
+	TxMsgBytes    int64                  `json:"txmsg_bytes"`
+	RxMsgs        int64                  `json:"rxmsgs"`
+	RxMsgBytes    int64                  `json:"rxmsg_bytes"`
+	Brokers       map[string]BrokerStats `json:"brokers"`
+	Topics        map[string]TopicStats  `json:"topics"`
+	ConsumerGroup *ConsumerGroupStats    `json:"cgrp"`
+	receivedTime  time.Time
+}
+
+//BrokerStats are the statistics of a broker connection
+type BrokerStats struct {
+	Name           string      `json:"name"`
+	NodeID         int32       `json:"nodeid"`
+	State          string      `json:"state"`
+	OutbufMsgs     int64       `json:"outbuf_msg_cnt"`
+	OutbufRequests int64       `json:"outbuf_cnt"`
+	WaitResponses  int64       `json:"waitresp_cnt"`
+	Tx             int64       `json:"tx"`
+	TxErrors       int64       `json:"txerrs"`
+	TxRetries      int64       `json:"txretries"`
+	RequestTimeout int64       `json:"req_timeouts"`
+	Rx             int64       `json:"rx"`
+	RxErrors       int64       `json:"rxerrs"`
+	RttMicros      WindowStats `json:"rtt"`
+	ThrottleMillis WindowStats `json:"throttle"`
+}
+
+//WindowStats are the rolling window statistics of a latency
+type WindowStats struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+	Avg int64 `json:"avg"`
+	P50 int64 `json:"p50"`
+	P95 int64 `json:"p95"`
+	P99 int64 `json:"p99"`
+	Cnt int64 `json:"cnt"`
+}
+
+//TopicStats are the statistics of a topic
+type TopicStats struct {
+	Topic      string                    `json:"topic"`
+	Partitions map[string]PartitionStats `json:"partitions"`
+}
+
+//PartitionStats are the statistics of a partition, the partition -1 holds the messages without partition yet
+type PartitionStats struct {
+	Partition       int32 `json:"partition"`
+	Leader          int32 `json:"leader"`
+	QueueMsgs       int64 `json:"msgq_cnt"`
+	XmitQueueMsgs   int64 `json:"xmit_msgq_cnt"`
+	FetchQueueMsgs  int64 `json:"fetchq_cnt"`
+	TxMsgs          int64 `json:"txmsgs"`
+	RxMsgs          int64 `json:"rxmsgs"`
+	AppOffset       int64 `json:"app_offset"`
+	CommittedOffset int64 `json:"committed_offset"`
+	LowOffset       int64 `json:"lo_offset"`
+	HighOffset      int64 `json:"hi_offset"`
+	ConsumerLag     int64 `json:"consumer_lag"`
+}
+
+//ConsumerGroupStats are the statistics of the consumer group membership
+type ConsumerGroupStats struct {
+	State          string `json:"state"`
+	JoinState      string `json:"join_state"`
+	RebalanceCount int64  `json:"rebalance_cnt"`
+	AssignmentSize int64  `json:"assignment_size"`
+}
+
+//StatsCallback is called with the parsed statistics of a client and must not block
+type StatsCallback func(stats *ClientStats)
+
+//ParseStats parses the librdkafka statistics json
+func ParseStats(data string) (*ClientStats, error) {
+	stats := &ClientStats{}
+	err := json.Unmarshal([]byte(data), stats)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse librdkafka statistics error [%v]", err)
+	}
+	stats.receivedTime = time.Now()
+	return stats, nil
+}
+
+//ReceivedTime returns the time the statistics were received
+func (s *ClientStats) ReceivedTime() time.Time {
+	return s.receivedTime
+}
+
+//statsRecorder keeps the latest statistics of a client and passes them to the callback
+type statsRecorder struct {
+	mutex    sync.Mutex
+	latest   *ClientStats
+	callback StatsCallback
+}
+
+//handle parses the statistics, statistics that cannot be parsed are dropped and nil is returned
+func (r *statsRecorder) handle(data string) *ClientStats {
+	stats, err := ParseStats(data)
+	if err != nil {
+		return nil
+	}
+	r.mutex.Lock()
+	r.latest = stats
+	callback := r.callback
+	r.mutex.Unlock()
+
+	if callback != nil {
+		callback(stats)
+	}
+	return stats
+}
+
+func (r *statsRecorder) setCallback(callback StatsCallback) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.callback = callback
+}
+
+func (r *statsRecorder) get() *ClientStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.latest
+}
+
+//SetStatsCallback sets the callback called with the statistics of the producer
+func (tp *TopicProducer) SetStatsCallback(callback StatsCallback) {
+	tp.stats.setCallback(callback)
+}
+
+//GetStats returns the latest statistics of the producer, nil if statistics are disabled or not yet received
+func (tp *TopicProducer) GetStats() *ClientStats {
+	return tp.stats.get()
+}
+
+//SetStatsCallback sets the callback called with the statistics of the consumer
+func (kc *MessageConsumer) SetStatsCallback(callback StatsCallback) {
+	kc.stats.setCallback(callback)
+}
+
+//GetStats returns the latest statistics of the consumer, nil if statistics are disabled or not yet received
+func (kc *MessageConsumer) GetStats() *ClientStats {
+	return kc.stats.get()
+}
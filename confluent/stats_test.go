@@ -0,0 +1,87 @@
+package confluent
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+//readStatsFixture returns the statistics of a consumer in group billing that read 10 messages of the topic orders with 4 partitions
+func readStatsFixture(t *testing.T) string {
+	data, err := ioutil.ReadFile("testdata/librdkafka_stats.json")
+	if err != nil {
+		t.Fatalf("cannot read statistics fixture error [%v]", err)
+	}
+	return string(data)
+}
+
+func TestParseStats(t *testing.T) {
+	stats, err := ParseStats(readStatsFixture(t))
+	if err != nil {
+		t.Fatalf("cannot parse statistics error [%v]", err)
+	}
+	if stats.Name != "billing-1#consumer-3" || stats.ClientID != "billing-1" || stats.Type != "consumer" || stats.Time != 1792385049 || stats.RxMsgs != 10 || stats.Tx != 33 {
+		t.Errorf("unexpected client statistics %+v", stats)
+	}
+	if stats.ReceivedTime().IsZero() {
+		t.Errorf("received time expected")
+	}
+
+	if len(stats.Brokers) != 2 {
+		t.Fatalf("expected [2] brokers but was [%d]", len(stats.Brokers))
+	}
+	broker := stats.Brokers["127.0.0.1:42867/1"]
+	if broker.Name != "127.0.0.1:42867/1" || broker.NodeID != 1 || broker.State != "UP" || broker.Tx != 22 || broker.Rx != 21 {
+		t.Errorf("unexpected broker statistics %+v", broker)
+	}
+	if broker.RttMicros.Cnt != 1 || broker.RttMicros.Max != 500637 {
+		t.Errorf("unexpected broker round trip time %+v", broker.RttMicros)
+	}
+	if coordinator := stats.Brokers["GroupCoordinator"]; coordinator.NodeID != 1 || coordinator.State != "UP" {
+		t.Errorf("unexpected group coordinator statistics %+v", coordinator)
+	}
+
+	topic, ok := stats.Topics["orders"]
+	if !ok || topic.Topic != "orders" || len(topic.Partitions) != 5 {
+		t.Fatalf("expected topic orders with 4 partitions and the internal partition but was %+v", topic)
+	}
+	committed := int64(0)
+	for _, key := range []string{"0", "1", "2", "3"} {
+		partition := topic.Partitions[key]
+		if partition.Leader != 1 || partition.ConsumerLag != 0 || partition.CommittedOffset != partition.HighOffset || partition.LowOffset != 0 {
+			t.Errorf("unexpected partition [%s] statistics %+v", key, partition)
+		}
+		committed += partition.CommittedOffset
+	}
+	if committed != 10 {
+		t.Errorf("expected [10] committed messages but was [%d]", committed)
+	}
+	if partition := topic.Partitions["0"]; partition.Partition != 0 || partition.RxMsgs != 2 || partition.AppOffset != 2 {
+		t.Errorf("unexpected partition [0] statistics %+v", partition)
+	}
+	internal := topic.Partitions["-1"]
+	if internal.Partition != -1 || internal.Leader != -1 || internal.CommittedOffset != -1001 || internal.ConsumerLag != -1 {
+		t.Errorf("unexpected internal partition statistics %+v", internal)
+	}
+
+	group := stats.ConsumerGroup
+	if group == nil || group.State != "up" || group.JoinState != "steady" || group.RebalanceCount != 1 || group.AssignmentSize != 4 {
+		t.Errorf("unexpected consumer group statistics %+v", group)
+	}
+}
+
+func TestParseStatsInvalid(t *testing.T) {
+	if _, err := ParseStats("{"); err == nil {
+		t.Errorf("invalid statistics expected error")
+	}
+
+	//statistics that cannot be parsed keep the latest statistics and are not passed to the callback
+	var calls int
+	recorder := &statsRecorder{}
+	recorder.setCallback(func(stats *ClientStats) { calls++ })
+	if recorder.handle(readStatsFixture(t)) == nil || recorder.handle("{") != nil {
+		t.Errorf("expected the fixture parsed and the invalid statistics dropped")
+	}
+	if calls != 1 || recorder.get() == nil || recorder.get().ClientID != "billing-1" {
+		t.Errorf("expected one callback and the fixture as latest statistics but was [%d] calls", calls)
+	}
+}
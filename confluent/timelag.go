@@ -0,0 +1,171 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//probePollMs is the poll timeout of the timestamp probe
+const probePollMs = 100
+
+//partitionTimestamps tracks the timestamp of the last processed message per partition
+type partitionTimestamps struct {
+	mutex      sync.Mutex
+	timestamps map[PartitionRef]time.Time
+}
+
+func (t *partitionTimestamps) set(topic string, partition int32, timestamp time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.timestamps == nil {
+		t.timestamps = map[PartitionRef]time.Time{}
+	}
+	t.timestamps[PartitionRef{Topic: topic, Partition: partition}] = timestamp
+}
+
+//remove forgets the partitions, e.g. when they are revoked from the consumer
+func (t *partitionTimestamps) remove(partitions []kafka.TopicPartition) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, partition := range partitions {
+		if partition.Topic != nil {
+			delete(t.timestamps, PartitionRef{Topic: *partition.Topic, Partition: partition.Partition})
+		}
+	}
+}
+
+func (t *partitionTimestamps) get(topic string, partition int32) (time.Time, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	timestamp, ok := t.timestamps[PartitionRef{Topic: topic, Partition: partition}]
+	return timestamp, ok
+}
+
+//timestampProbe reads single messages with its own consumer to get their timestamps
+//the mutex serializes the probes and the close of the consumer
+type timestampProbe struct {
+	mutex    sync.Mutex
+	consumer *kafka.Consumer
+	closed   bool
+}
+
+func newTimestampProbe(clientID string) (*timestampProbe, error) {
+	consumer, err := kafka.NewConsumer(
+		&kafka.ConfigMap{
+			"bootstrap.servers":      bootstrapServers,
+			"group.id":               clientID + "-timestamp-probe",
+			"enable.auto.commit":     false,
+			"enable.partition.eof":   true,
+			"go.logs.channel.enable": true,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create timestamp probe consumer error [%#v]", err)
+	}
+	go newEventLogger(clientID + "-timestamp-probe").forwardLogs(consumer.Logs())
+	return &timestampProbe{consumer: consumer}, nil
+}
+
+//timestampAt returns the timestamp of the first message at or after the offset
+func (p *timestampProbe) timestampAt(ctx context.Context, topic string, partition int32, offset int64) (time.Time, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return time.Time{}, fmt.Errorf("timestamp probe closed")
+	}
+
+	err := p.consumer.Assign([]kafka.TopicPartition{{Topic: &topic, Partition: partition, Offset: kafka.Offset(offset)}})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot assign [%s[%d]] error [%v]", topic, partition, err)
+	}
+	defer p.consumer.Unassign()
+
+	for ctx.Err() == nil {
+		switch e := p.consumer.Poll(probePollMs).(type) {
+		case *kafka.Message:
+			if e.TopicPartition.Partition == partition && e.TopicPartition.Topic != nil && *e.TopicPartition.Topic == topic {
+				if e.TimestampType == kafka.TimestampNotAvailable {
+					return time.Time{}, fmt.Errorf("no timestamp at [%s[%d]@%d]", topic, partition, e.TopicPartition.Offset)
+				}
+				return e.Timestamp, nil
+			}
+		case kafka.PartitionEOF:
+			return time.Time{}, fmt.Errorf("no message at [%s[%d]@%d]", topic, partition, offset)
+		case kafka.Error:
+			return time.Time{}, fmt.Errorf("timestamp probe [%s[%d]@%d] error [%v]", topic, partition, offset, e)
+		}
+	}
+	return time.Time{}, fmt.Errorf("timestamp probe [%s[%d]@%d] error [%v]", topic, partition, offset, ctx.Err())
+}
+
+//close waits for a running probe before closing the consumer
+func (p *timestampProbe) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	p.consumer.Close()
+}
+
+//GetTimeLagReport returns the backlog report with the time the consumer is behind per partition
+//the time lag is the difference between the latest message and the last processed message
+func (kc *MessageConsumer) GetTimeLagReport(ctx context.Context) (*BacklogReport, error) {
+	report, err := kc.GetBacklogReport(ctx)
+	if err != nil {
+		return nil, err
+	}
+	probe, err := kc.getTimestampProbe()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range report.Partitions {
+		backlog := &report.Partitions[i]
+		if backlog.Error != nil || backlog.High <= backlog.Low {
+			continue
+		}
+		backlog.LatestTimestamp, backlog.Error = probe.timestampAt(ctx, backlog.Topic, backlog.Partition, backlog.High-1)
+		if backlog.Error != nil {
+			continue
+		}
+
+		processed, ok := kc.lastProcessed.get(backlog.Topic, backlog.Partition)
+		if !ok && backlog.Lag > 0 {
+			//nothing processed since start, the next message to process is at the committed offset
+			next := backlog.Committed
+			if next < backlog.Low {
+				next = backlog.Low
+			}
+			processed, backlog.Error = probe.timestampAt(ctx, backlog.Topic, backlog.Partition, next)
+			if backlog.Error != nil {
+				continue
+			}
+		}
+		backlog.LastProcessedTimestamp = processed
+		if backlog.Lag > 0 && backlog.LatestTimestamp.After(processed) {
+			backlog.TimeLag = backlog.LatestTimestamp.Sub(processed)
+		}
+		if backlog.TimeLag > report.MaxTimeLag {
+			report.MaxTimeLag = backlog.TimeLag
+		}
+	}
+	return report, nil
+}
+
+func (kc *MessageConsumer) getTimestampProbe() (*timestampProbe, error) {
+	kc.probeMutex.Lock()
+	defer kc.probeMutex.Unlock()
+	if kc.probe == nil {
+		probe, err := newTimestampProbe(kc.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		kc.probe = probe
+	}
+	return kc.probe, nil
+}
@@ -0,0 +1,80 @@
+package confluent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+type nopMessageHandler struct{}
+
+func (h nopMessageHandler) Handle(context *okfwkafka.MessageContext, key []byte, value []byte) {}
+
+func testMessage(topic string, partition int32, timestamp time.Time, timestampType kafka.TimestampType) *kafka.Message {
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition},
+		Value:          []byte("v"),
+		Timestamp:      timestamp,
+		TimestampType:  timestampType,
+	}
+}
+
+func TestLastProcessedTimestamp(t *testing.T) {
+	kc := &MessageConsumer{ClientID: "timelag", Handler: nopMessageHandler{}, events: newEventLogger("timelag")}
+	created := time.Unix(1700000000, 0)
+	kc.handleMessage(testMessage("orders", 0, created, kafka.TimestampCreateTime))
+	kc.handleMessage(testMessage("orders", 1, created.Add(time.Second), kafka.TimestampLogAppendTime))
+
+	//messages without timestamp keep the timestamp of the last message with timestamp
+	kc.handleMessage(testMessage("orders", 0, time.Unix(0, -int64(time.Millisecond)), kafka.TimestampNotAvailable))
+	kc.handleMessage(testMessage("orders", 2, time.Unix(0, -int64(time.Millisecond)), kafka.TimestampNotAvailable))
+
+	tests := []struct {
+		partition int32
+		timestamp time.Time
+		ok        bool
+	}{
+		{0, created, true},
+		{1, created.Add(time.Second), true},
+		{2, time.Time{}, false},
+	}
+	for _, test := range tests {
+		timestamp, ok := kc.lastProcessed.get("orders", test.partition)
+		if ok != test.ok || !timestamp.Equal(test.timestamp) {
+			t.Errorf("partition [%d] expected last processed [%v] [%t] but was [%v] [%t]", test.partition, test.timestamp, test.ok, timestamp, ok)
+		}
+	}
+	latency := kc.GetLatency()
+	if len(latency) != 3 || latency[2].Handling.Count != 1 || latency[2].EndToEnd.Count != 0 {
+		t.Errorf("message without timestamp expected to count only the handling latency but was %+v", latency)
+	}
+}
+
+func TestLastProcessedClearedOnRevoke(t *testing.T) {
+	kc := &MessageConsumer{ClientID: "timelag", Handler: nopMessageHandler{}, events: newEventLogger("timelag")}
+	for partition := int32(0); partition < 3; partition++ {
+		kc.handleMessage(testMessage("orders", partition, time.Now(), kafka.TimestampCreateTime))
+	}
+	kc.handleMessage(testMessage("payments", 0, time.Now(), kafka.TimestampCreateTime))
+
+	orders := "orders"
+	kc.rebalanced(nil, kafka.RevokedPartitions{Partitions: []kafka.TopicPartition{{Topic: &orders, Partition: 0}, {Topic: &orders, Partition: 2}}})
+	for _, ref := range []PartitionRef{{"orders", 0}, {"orders", 2}} {
+		if _, ok := kc.lastProcessed.get(ref.Topic, ref.Partition); ok {
+			t.Errorf("revoked partition [%s] expected without last processed timestamp", ref)
+		}
+	}
+	for _, ref := range []PartitionRef{{"orders", 1}, {"payments", 0}} {
+		if _, ok := kc.lastProcessed.get(ref.Topic, ref.Partition); !ok {
+			t.Errorf("partition [%s] expected to keep the last processed timestamp", ref)
+		}
+	}
+
+	//an assignment does not bring back old timestamps
+	kc.rebalanced(nil, kafka.AssignedPartitions{Partitions: []kafka.TopicPartition{{Topic: &orders, Partition: 0}}})
+	if _, ok := kc.lastProcessed.get("orders", 0); ok {
+		t.Errorf("assigned partition expected without last processed timestamp")
+	}
+}
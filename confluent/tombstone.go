@@ -0,0 +1,63 @@
+package confluent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+//IsTombstone returns true if the message value marks the deletion of the key in a compacted topic
+func IsTombstone(value []byte) bool {
+	return value == nil
+}
+
+//EncodeKey encodes the key with the schema header, used to send tombstones
+func EncodeKey(keySchema okfwkafka.MessageSchema, key interface{}) []byte {
+	keyBuffer := &bytes.Buffer{}
+	keySchema.WriteHeader(keyBuffer)
+	keySchema.GetEncoder().Encode(key, keyBuffer)
+	return keyBuffer.Bytes()
+}
+
+//DecodeMessage decodes the message with the registry, tombstones are decoded without value
+func DecodeMessage(registry okfwkafka.Registry, context *MessageContext, key []byte, value []byte) (interface{}, interface{}, error) {
+	if !context.Tombstone {
+		return registry.DecodeMessage(&context.MessageContext, key, value)
+	}
+	decodedKey, err := DecodeKey(registry, key)
+	return decodedKey, nil, err
+}
+
+//DecodeKey decodes the key with the schema given in the header
+func DecodeKey(registry okfwkafka.Registry, key []byte) (interface{}, error) {
+	keyBuffer := bytes.NewBuffer(key)
+	schemaID, err := readSchemaID(keyBuffer)
+	if err != nil {
+		return nil, err
+	}
+	keySchema, err := registry.GetSchemaByID(int(schemaID))
+	if err != nil {
+		return nil, err
+	}
+	decoder := keySchema.GetDecoder()
+	if decoder == nil {
+		return nil, fmt.Errorf("no key decoder")
+	}
+	return decoder.Decode(keyBuffer)
+}
+
+//readSchemaID reads the magic byte and schema id header
+func readSchemaID(reader io.Reader) (uint32, error) {
+	headerBytes := [5]byte{}
+	len, err := io.ReadFull(reader, headerBytes[:])
+	if err != nil {
+		return 0, fmt.Errorf("header expected [5] but was [%d] bytes error [%v]", len, err)
+	}
+	if headerBytes[0] != 0 {
+		return 0, fmt.Errorf("header magic byte is not [0] but was [%d]", headerBytes[0])
+	}
+	return binary.BigEndian.Uint32(headerBytes[1:5]), nil
+}
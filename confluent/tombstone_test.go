@@ -0,0 +1,142 @@
+package confluent
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+//stringCodec encodes strings as their bytes
+type stringCodec struct{}
+
+func (c stringCodec) Decode(reader io.Reader) (interface{}, error) {
+	data, err := ioutil.ReadAll(reader)
+	return string(data), err
+}
+
+func (c stringCodec) Encode(value interface{}, writer io.Writer) {
+	writer.Write([]byte(value.(string)))
+}
+
+//recordingContextHandler keeps the context, key and value of the last message
+type recordingContextHandler struct {
+	context *MessageContext
+	key     []byte
+	value   []byte
+}
+
+func (h *recordingContextHandler) Handle(context *okfwkafka.MessageContext, key []byte, value []byte) {
+}
+
+func (h *recordingContextHandler) HandleMessage(context *MessageContext, key []byte, value []byte) {
+	h.context, h.key, h.value = context, key, value
+}
+
+func TestIsTombstone(t *testing.T) {
+	if !IsTombstone(nil) || IsTombstone([]byte{}) || IsTombstone([]byte("v")) {
+		t.Errorf("only a nil value expected to be a tombstone")
+	}
+	if copyBytes(nil) != nil || copyBytes([]byte{}) == nil {
+		t.Errorf("copy expected to keep nil and empty values apart")
+	}
+	original := []byte("v")
+	copied := copyBytes(original)
+	original[0] = 'x'
+	if string(copied) != "v" {
+		t.Errorf("copy expected to be independent of the original but was [%s]", copied)
+	}
+}
+
+func TestSendTombstone(t *testing.T) {
+	queue := &deliveringQueue{hold: true}
+	kp := &MessageProducer{TopicProducer: newDeliveringProducer(queue), Topic: "users"}
+	kp.SendTombstone([]byte("k"))
+	kp.SendKeyValue([]byte("k"), []byte{})
+	kp.TopicProducer.SendTombstone("orders", 2, []byte("k"))
+
+	if len(queue.pending) != 3 {
+		t.Fatalf("expected [3] messages but was [%d]", len(queue.pending))
+	}
+	tombstone, empty, other := queue.pending[0], queue.pending[1], queue.pending[2]
+	if tombstone.Value != nil || *tombstone.TopicPartition.Topic != "users" || string(tombstone.Key) != "k" {
+		t.Errorf("tombstone expected without value for topic users but was %v", tombstone)
+	}
+	if empty.Value == nil {
+		t.Errorf("empty value expected not to be a tombstone")
+	}
+	if other.Value != nil || *other.TopicPartition.Topic != "orders" || other.TopicPartition.Partition != 2 {
+		t.Errorf("tombstone expected without value for orders[2] but was %v", other)
+	}
+}
+
+func TestConsumeTombstone(t *testing.T) {
+	handler := &recordingContextHandler{}
+	kc := &MessageConsumer{ClientID: "tombstone", Handler: handler, events: newEventLogger("tombstone")}
+	topic := "users"
+	tests := []struct {
+		value     []byte
+		tombstone bool
+	}{
+		{nil, true},
+		{[]byte{}, false},
+		{[]byte("v"), false},
+	}
+	for _, test := range tests {
+		kc.handleMessage(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 7},
+			Key:            []byte("k"),
+			Value:          test.value,
+			Timestamp:      time.Now(),
+		})
+		if handler.context.Tombstone != test.tombstone || (handler.value == nil) != (test.value == nil) || !bytes.Equal(handler.value, test.value) {
+			t.Errorf("value %v expected tombstone [%t] but was [%t] with value %v", test.value, test.tombstone, handler.context.Tombstone, handler.value)
+		}
+		if handler.context.Topic != topic || handler.context.Partition != 1 || handler.context.Offset != 7 || string(handler.key) != "k" {
+			t.Errorf("unexpected message context %+v key [%s]", handler.context, handler.key)
+		}
+	}
+}
+
+func TestDecodeTombstone(t *testing.T) {
+	keySchema := &okfwkafka.AvroSchema{ID: 3, Decoder: stringCodec{}, Encoder: stringCodec{}}
+	valueSchema := &okfwkafka.AvroSchema{ID: 4, Decoder: stringCodec{}, Encoder: stringCodec{}}
+	registry := okfwkafka.SchemaRegistry{SchemasByID: map[int]*okfwkafka.AvroSchema{3: keySchema, 4: valueSchema}}
+
+	key := EncodeKey(keySchema, "user-1")
+	if !bytes.Equal(key, append([]byte{0, 0, 0, 0, 3}, "user-1"...)) {
+		t.Errorf("key expected with schema header but was %v", key)
+	}
+
+	decodedKey, decodedValue, err := DecodeMessage(registry, &MessageContext{Tombstone: true}, key, nil)
+	if err != nil || decodedKey != "user-1" || decodedValue != nil {
+		t.Errorf("tombstone expected key [user-1] without value but was [%v] [%v] error [%v]", decodedKey, decodedValue, err)
+	}
+	_, value := registry.EncodeMessage(keySchema, "user-1", valueSchema, "name")
+	decodedKey, decodedValue, err = DecodeMessage(registry, &MessageContext{}, key, value)
+	if err != nil || decodedKey != "user-1" || decodedValue != "name" {
+		t.Errorf("message expected key [user-1] and value [name] but was [%v] [%v] error [%v]", decodedKey, decodedValue, err)
+	}
+
+	invalid := []struct {
+		name string
+		key  []byte
+	}{
+		{"short header", []byte{0, 0}},
+		{"magic byte", []byte{1, 0, 0, 0, 3}},
+		{"unknown schema", []byte{0, 0, 0, 0, 9}},
+	}
+	for _, test := range invalid {
+		if _, err := DecodeKey(registry, test.key); err == nil {
+			t.Errorf("%s expected error", test.name)
+		}
+	}
+	registry.SchemasByID[5] = &okfwkafka.AvroSchema{ID: 5}
+	if _, err := DecodeKey(registry, []byte{0, 0, 0, 0, 5}); err == nil {
+		t.Errorf("schema without decoder expected error")
+	}
+}
@@ -0,0 +1,515 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//maxDeliveryErrors limits the delivery errors kept until the next flush
+const maxDeliveryErrors = 1000
+
+//flushPollInterval is the time a single librdkafka flush call may block
+const flushPollInterval = 100 * time.Millisecond
+
+//metadataTimeoutMs is the timeout to query the partition count of a topic
+const metadataTimeoutMs = 5000
+
+//partitionCountRefresh is the time after which a cached partition count is queried again
+const partitionCountRefresh = time.Minute
+
+//partitionCountRetry is the time after which a failed partition count query is repeated
+const partitionCountRetry = 5 * time.Second
+
+//PartitionAny lets the partitioner or librdkafka select the partition
+const PartitionAny = kafka.PartitionAny
+
+//Partitioner selects the partition of a message
+//returning PartitionAny leaves the selection to librdkafka
+type Partitioner interface {
+	Partition(topic string, key []byte, partitionCount int32) int32
+}
+
+//TopicProducer sends messages to any topic with a single kafka producer
+//SuccessCount and FailedCount are only changed by broker delivery reports,
+//MessageCount holds the messages enqueued but not yet acknowledged
+type TopicProducer struct {
+	SuccessCount    int64
+	FailedCount     int64
+	MessageCount    int64
+	ClientID        string
+	Producer        *kafka.Producer
+	configMutex     sync.RWMutex
+	partitioner     Partitioner
+	queueFull       QueueFullConfig
+	errorsMutex     sync.Mutex
+	deliveryErrors  []error
+	partitionsMutex sync.Mutex
+	partitionCounts map[string]partitionCount
+	partitionLookup func(topic string) (int32, error)
+	queue           messageQueue
+	outboxMutex     sync.Mutex
+	outbox          *Outbox
+	outboxRetries   []outboxRetry
+	outboxResending int
+	outboxWake      chan struct{}
+	outboxDone      chan struct{}
+	outboxStopped   bool
+	outboxWait      sync.WaitGroup
+	metrics         atomic.Value
+	stats           statsRecorder
+	events          *eventLogger
+	health          healthState
+	closeOnce       sync.Once
+	closeMutex      sync.RWMutex
+	closed          bool
+}
+
+//messageQueue is the local librdkafka queue of the producer, replaced in tests
+type messageQueue interface {
+	Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error
+	Flush(timeoutMs int) int
+}
+
+//deliveryOpaque is passed with the message to the delivery report
+type deliveryOpaque struct {
+	callback  DeliveryCallback
+	outbox    *Outbox
+	outboxSeq uint64
+	sent      time.Time
+	span      Span
+}
+
+//partitionCount caches the partition count or the error of the last query
+type partitionCount struct {
+	count     int32
+	err       error
+	queryTime time.Time
+	querying  bool
+}
+
+//DeliveryResult holds the broker acknowledgement of a single message
+type DeliveryResult struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Error     error
+}
+
+//DeliveryCallback is called from the delivery report handler and must not block
+type DeliveryCallback func(result DeliveryResult)
+
+//FlushResult holds the outcome of a flush
+type FlushResult struct {
+	Undelivered    int
+	DeliveryErrors []error
+}
+
+func newTopicProducer(clientID string) (*TopicProducer, error) {
+	tp := &TopicProducer{
+		ClientID:        clientID,
+		partitionCounts: map[string]partitionCount{},
+		events:          newEventLogger(clientID),
+	}
+
+	var err error
+
+	tp.Producer, err = kafka.NewProducer(
+		&kafka.ConfigMap{
+			"bootstrap.servers":                     bootstrapServers,
+			"acks":                                  "all",
+			"compression.type":                      "lz4",
+			"retries":                               10000000,
+			"client.id":                             clientID,
+			"max.in.flight.requests.per.connection": 5,
+			"enable.idempotence":                    true,
+			"statistics.interval.ms":                statisticsIntervalMs,
+			"go.logs.channel.enable":                true,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create new producer error [%#v]", err)
+	}
+	go tp.events.forwardLogs(tp.Producer.Logs())
+	go tp.serveEvents()
+
+	return tp, nil
+}
+
+//serveEvents handles the delivery reports, statistics and errors of the producer until it is closed
+func (tp *TopicProducer) serveEvents() {
+	for e := range tp.Producer.Events() {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			tp.handleDeliveryReport(ev)
+		case *kafka.Stats:
+			stats := tp.stats.handle(ev.String())
+			tp.events.logThrottle(stats)
+			tp.health.statsReceived(stats)
+		case kafka.Error:
+			tp.events.logEvent(ev)
+			tp.health.failed(time.Now(), ev)
+		}
+	}
+}
+
+//handleDeliveryReport updates the counters with the broker acknowledgement of a message
+//a failed message of the outbox is sent again and only reported when delivered
+func (tp *TopicProducer) handleDeliveryReport(m *kafka.Message) {
+	opaque, ok := m.Opaque.(*deliveryOpaque)
+	retried := ok && opaque.outbox != nil && m.TopicPartition.Error != nil
+	if ok && opaque.outbox != nil {
+		//schedule the retry before the message leaves the in-flight count so a flush keeps waiting
+		tp.handleOutboxDelivery(opaque, m)
+	}
+	if retried {
+		tp.events.logEvent(m)
+	} else if m.TopicPartition.Error != nil {
+		atomic.AddInt64(&tp.FailedCount, 1)
+		tp.addDeliveryError(fmt.Errorf("message delivery failed [%s] error [%v]", m.TopicPartition, m.TopicPartition.Error))
+		tp.events.logEvent(m)
+	} else {
+		atomic.AddInt64(&tp.SuccessCount, 1)
+	}
+	atomic.AddInt64(&tp.MessageCount, -1)
+	tp.health.delivered(time.Now(), m.TopicPartition.Error)
+
+	if metrics := tp.getMetrics(); metrics != nil && !retried {
+		var sent time.Time
+		if ok {
+			sent = opaque.sent
+		}
+		metrics.producerDelivered(tp, newDeliveryResult(m).Topic, sent, m.TopicPartition.Error)
+	}
+	if !ok {
+		return
+	}
+	if opaque.span != nil {
+		endProducerSpan(opaque.span, m)
+	}
+	if opaque.callback != nil && !retried {
+		opaque.callback(newDeliveryResult(m))
+	}
+}
+
+func newDeliveryResult(m *kafka.Message) DeliveryResult {
+	result := DeliveryResult{
+		Partition: m.TopicPartition.Partition,
+		Offset:    int64(m.TopicPartition.Offset),
+		Error:     m.TopicPartition.Error,
+	}
+	if m.TopicPartition.Topic != nil {
+		result.Topic = *m.TopicPartition.Topic
+	}
+	return result
+}
+
+func (tp *TopicProducer) addDeliveryError(err error) {
+	tp.errorsMutex.Lock()
+	defer tp.errorsMutex.Unlock()
+	if len(tp.deliveryErrors) < maxDeliveryErrors {
+		tp.deliveryErrors = append(tp.deliveryErrors, err)
+	}
+}
+
+//takeDeliveryErrors returns the collected delivery errors and resets them
+func (tp *TopicProducer) takeDeliveryErrors() []error {
+	tp.errorsMutex.Lock()
+	defer tp.errorsMutex.Unlock()
+	errs := tp.deliveryErrors
+	tp.deliveryErrors = nil
+	return errs
+}
+
+//Close the producer, messages not yet delivered stay in the outbox, closing again has no effect
+//waits for sends in progress, later sends return an error
+func (tp *TopicProducer) Close() {
+	tp.closeOnce.Do(func() {
+		tp.closeMutex.Lock()
+		tp.closed = true
+		tp.closeMutex.Unlock()
+		tp.stopOutboxRetry()
+		tp.Producer.Close()
+		tp.closeOutbox()
+		tp.health.close()
+	})
+}
+
+//produceOpen produces the message unless the producer is closed, the librdkafka handle is not used concurrently with its close
+func (tp *TopicProducer) produceOpen(m *kafka.Message) error {
+	tp.closeMutex.RLock()
+	defer tp.closeMutex.RUnlock()
+	if tp.closed {
+		return fmt.Errorf("producer closed [%s]", tp.ClientID)
+	}
+	return tp.getQueue().Produce(m, nil)
+}
+
+//flushOpen serves the delivery reports and returns the messages still queued, -1 if the producer is closed
+func (tp *TopicProducer) flushOpen(timeoutMs int) int {
+	tp.closeMutex.RLock()
+	defer tp.closeMutex.RUnlock()
+	if tp.closed {
+		return -1
+	}
+	return tp.getQueue().Flush(timeoutMs)
+}
+
+func (tp *TopicProducer) getQueue() messageQueue {
+	if tp.queue != nil {
+		return tp.queue
+	}
+	return tp.Producer
+}
+
+//GetMessageCounter returns the address to the message counter
+func (tp *TopicProducer) GetMessageCounter() *int64 {
+	return &tp.MessageCount
+}
+
+//GetInFlightCount returns the messages enqueued but not yet acknowledged by the broker
+//including the messages of the outbox waiting to be sent again
+func (tp *TopicProducer) GetInFlightCount() int64 {
+	return atomic.LoadInt64(&tp.MessageCount) + int64(tp.getOutboxRetryCount())
+}
+
+//SetPartitioner sets the partitioner used for messages sent with PartitionAny, sends in progress use the previous one
+func (tp *TopicProducer) SetPartitioner(partitioner Partitioner) {
+	tp.configMutex.Lock()
+	defer tp.configMutex.Unlock()
+	tp.partitioner = partitioner
+}
+
+func (tp *TopicProducer) getPartitioner() Partitioner {
+	tp.configMutex.RLock()
+	defer tp.configMutex.RUnlock()
+	return tp.partitioner
+}
+
+//Send sends message with key and value to the topic partition
+func (tp *TopicProducer) Send(topic string, partition int32, key []byte, value []byte) error {
+	return tp.SendAsync(topic, partition, key, value, nil)
+}
+
+//SendTombstone sends a message without value to delete the key from a compacted topic
+func (tp *TopicProducer) SendTombstone(topic string, partition int32, key []byte) error {
+	return tp.Send(topic, partition, key, nil)
+}
+
+//SendContext sends message with key and value to the topic partition, a send blocked by a full queue ends with the context
+func (tp *TopicProducer) SendContext(ctx context.Context, topic string, partition int32, key []byte, value []byte) error {
+	return tp.produce(ctx, tp.newMessage(topic, partition, key, value), nil)
+}
+
+//SendAsync sends message with key and value to the topic partition and calls the callback with the delivery result
+func (tp *TopicProducer) SendAsync(topic string, partition int32, key []byte, value []byte, callback DeliveryCallback) error {
+	return tp.produce(context.Background(), tp.newMessage(topic, partition, key, value), callback)
+}
+
+//SendSync sends message with key and value to the topic partition and blocks until the broker acknowledged the message or the context is done
+//a message still in flight when the context ends may be delivered later
+func (tp *TopicProducer) SendSync(ctx context.Context, topic string, partition int32, key []byte, value []byte) (DeliveryResult, error) {
+	delivered := make(chan DeliveryResult, 1)
+	err := tp.produce(ctx, tp.newMessage(topic, partition, key, value), func(result DeliveryResult) {
+		delivered <- result
+	})
+	if err != nil {
+		return DeliveryResult{Topic: topic, Partition: partition, Error: err}, err
+	}
+	select {
+	case result := <-delivered:
+		return result, result.Error
+	case <-ctx.Done():
+		err = fmt.Errorf("delivery not acknowledged [%s] [%d] error [%v]", topic, partition, ctx.Err())
+		return DeliveryResult{Topic: topic, Partition: partition, Error: err}, err
+	}
+}
+
+//SendMessage sends the prepared message with its timestamp and headers, the partitioner is used for PartitionAny
+func (tp *TopicProducer) SendMessage(ctx context.Context, m *kafka.Message, callback DeliveryCallback) error {
+	if m.TopicPartition.Topic == nil {
+		return fmt.Errorf("cannot send message without topic")
+	}
+	m.TopicPartition.Partition = tp.selectPartition(*m.TopicPartition.Topic, m.TopicPartition.Partition, m.Key)
+	return tp.produce(ctx, m, callback)
+}
+
+func (tp *TopicProducer) newMessage(topic string, partition int32, key []byte, value []byte) *kafka.Message {
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: tp.selectPartition(topic, partition, key),
+		},
+		Key:   key,
+		Value: value,
+	}
+}
+
+//produce journals the message in the outbox if enabled and enqueues it
+func (tp *TopicProducer) produce(ctx context.Context, m *kafka.Message, callback DeliveryCallback) error {
+	opaque := &deliveryOpaque{callback: callback}
+	if tp.getMetrics() != nil {
+		opaque.sent = time.Now()
+	}
+	opaque.span = startProducerSpan(ctx, tp.ClientID, m)
+	if outbox := tp.getOutbox(); outbox != nil {
+		seq, err := outbox.Append(OutboxMessage{
+			Topic:     *m.TopicPartition.Topic,
+			Partition: m.TopicPartition.Partition,
+			Key:       m.Key,
+			Value:     m.Value,
+			Timestamp: m.Timestamp,
+			Headers:   m.Headers,
+		})
+		if err != nil {
+			err = fmt.Errorf("cannot journal message in outbox error [%v]", err)
+			if opaque.span != nil {
+				opaque.span.RecordError(err)
+				opaque.span.End()
+			}
+			return err
+		}
+		opaque.outbox = outbox
+		opaque.outboxSeq = seq
+	}
+
+	err := tp.enqueueMessage(ctx, m, opaque, tp.getQueueFullConfig())
+	if err != nil && opaque.outbox != nil {
+		//the caller gets the error and stays responsible for the message
+		opaque.outbox.Ack(opaque.outboxSeq)
+	}
+	return err
+}
+
+//enqueueMessage enqueues the message with the queue full policy, the opaque is passed to the delivery report
+func (tp *TopicProducer) enqueueMessage(ctx context.Context, m *kafka.Message, opaque *deliveryOpaque, queueFull QueueFullConfig) error {
+	if opaque.callback != nil || opaque.outbox != nil || !opaque.sent.IsZero() || opaque.span != nil {
+		m.Opaque = opaque
+	}
+	if atomic.AddInt64(&tp.MessageCount, 1) == 1 {
+		tp.health.pending(time.Now())
+	}
+	err := tp.enqueue(ctx, m, queueFull)
+	if err != nil {
+		//message was not enqueued so there will be no delivery report
+		atomic.AddInt64(&tp.MessageCount, -1)
+		if metrics := tp.getMetrics(); metrics != nil {
+			metrics.producerFailed(tp, *m.TopicPartition.Topic)
+		}
+		if opaque.span != nil {
+			opaque.span.RecordError(err)
+			opaque.span.End()
+		}
+	}
+
+	return err
+}
+
+//selectPartition asks the partitioner in case no explicit partition is given
+func (tp *TopicProducer) selectPartition(topic string, partition int32, key []byte) int32 {
+	partitioner := tp.getPartitioner()
+	if partition != PartitionAny || partitioner == nil {
+		return partition
+	}
+	count, err := tp.getPartitionCount(topic)
+	if err != nil || count <= 0 {
+		//topic unknown yet, librdkafka will select the partition
+		return PartitionAny
+	}
+	return partitioner.Partition(topic, key, count)
+}
+
+//getPartitionCount returns the cached partition count of the topic
+//the metadata is queried without holding the lock, sends of the topic use the cached value meanwhile
+//a failed query is cached for partitionCountRetry so a missing topic does not block every send
+func (tp *TopicProducer) getPartitionCount(topic string) (int32, error) {
+	tp.partitionsMutex.Lock()
+	cached, ok := tp.partitionCounts[topic]
+	refresh := partitionCountRefresh
+	if cached.err != nil {
+		refresh = partitionCountRetry
+	}
+	if ok && (cached.querying || time.Since(cached.queryTime) < refresh) {
+		tp.partitionsMutex.Unlock()
+		if cached.err == nil && cached.queryTime.IsZero() {
+			return 0, fmt.Errorf("partition count of topic [%s] queried", topic)
+		}
+		return cached.count, cached.err
+	}
+	cached.querying = true
+	tp.partitionCounts[topic] = cached
+	tp.partitionsMutex.Unlock()
+
+	lookup := tp.partitionLookup
+	if lookup == nil {
+		lookup = tp.lookupPartitionCount
+	}
+	count, err := lookup(topic)
+
+	tp.partitionsMutex.Lock()
+	tp.partitionCounts[topic] = partitionCount{count: count, err: err, queryTime: time.Now()}
+	tp.partitionsMutex.Unlock()
+
+	return count, err
+}
+
+//lookupPartitionCount queries the partition count of the topic from the broker
+func (tp *TopicProducer) lookupPartitionCount(topic string) (int32, error) {
+	metadata, err := tp.Producer.GetMetadata(&topic, false, metadataTimeoutMs)
+	if err != nil {
+		return 0, fmt.Errorf("cannot get metadata for topic [%s] error [%v]", topic, err)
+	}
+	topicMetadata, ok := metadata.Topics[topic]
+	if !ok || topicMetadata.Error.Code() != kafka.ErrNoError {
+		return 0, fmt.Errorf("topic not available [%s] error [%v]", topic, topicMetadata.Error)
+	}
+	return int32(len(topicMetadata.Partitions)), nil
+}
+
+//Flush waits until all enqueued messages are acknowledged or the timeout expired
+func (tp *TopicProducer) Flush(timeout time.Duration) FlushResult {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return tp.FlushContext(ctx)
+}
+
+//FlushContext waits until all enqueued messages are acknowledged or the context is done
+//the result contains the undelivered messages and the delivery errors since the last flush
+func (tp *TopicProducer) FlushContext(ctx context.Context) FlushResult {
+	for tp.GetInFlightCount() > 0 {
+		wait := flushPollInterval
+		if deadline, ok := ctx.Deadline(); ok {
+			remaining := time.Until(deadline)
+			if remaining < wait {
+				wait = remaining
+			}
+		}
+		if ctx.Err() != nil || wait <= 0 {
+			break
+		}
+		queued := tp.flushOpen(int(wait / time.Millisecond))
+		if queued < 0 {
+			break
+		}
+		if queued == 0 {
+			//librdkafka queue is empty, give the delivery handler time to count the last reports
+			//or wait for the outbox to send failed messages again
+			idle := time.Millisecond
+			if tp.getOutboxRetryCount() > 0 {
+				idle = wait
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(idle):
+			}
+		}
+	}
+
+	return FlushResult{
+		Undelivered:    int(tp.GetInFlightCount()),
+		DeliveryErrors: tp.takeDeliveryErrors(),
+	}
+}
@@ -0,0 +1,341 @@
+package confluent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+func TestSendMessageWithoutTopic(t *testing.T) {
+	tp := &TopicProducer{partitionCounts: map[string]partitionCount{}}
+	err := tp.SendMessage(context.Background(), &kafka.Message{Value: []byte("v")}, nil)
+	if err == nil {
+		t.Errorf("message without topic expected error")
+	}
+}
+
+func TestPartitionCountCached(t *testing.T) {
+	lookups := 0
+	tp := &TopicProducer{
+		partitionCounts: map[string]partitionCount{},
+		partitionLookup: func(topic string) (int32, error) {
+			lookups++
+			if topic == "missing" {
+				return 0, fmt.Errorf("topic not available [%s]", topic)
+			}
+			return 6, nil
+		},
+	}
+	for i := 0; i < 3; i++ {
+		count, err := tp.getPartitionCount("orders")
+		if err != nil || count != 6 {
+			t.Errorf("partition count expected [6] but was [%d] error [%v]", count, err)
+		}
+		_, err = tp.getPartitionCount("missing")
+		if err == nil {
+			t.Errorf("missing topic expected error")
+		}
+	}
+	if lookups != 2 {
+		t.Errorf("partition count and failure expected to be cached but lookups were [%d]", lookups)
+	}
+
+	//a failure is queried again after the retry interval, a count after the refresh interval
+	tp.partitionCounts["missing"] = partitionCount{err: fmt.Errorf("failed"), queryTime: time.Now().Add(-partitionCountRetry)}
+	tp.partitionCounts["orders"] = partitionCount{count: 6, queryTime: time.Now().Add(-partitionCountRetry)}
+	tp.getPartitionCount("missing")
+	tp.getPartitionCount("orders")
+	if lookups != 3 {
+		t.Errorf("failure expected to be queried again but lookups were [%d]", lookups)
+	}
+}
+
+func TestPartitionCountLookupWithoutLock(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	tp := &TopicProducer{
+		partitionCounts: map[string]partitionCount{"orders": {count: 3, queryTime: time.Now().Add(-partitionCountRefresh)}},
+		partitionLookup: func(topic string) (int32, error) {
+			if topic == "orders" {
+				close(started)
+				<-release
+			}
+			return 6, nil
+		},
+	}
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		tp.getPartitionCount("orders")
+	}()
+	<-started
+
+	//other topics and the running query do not wait for the lookup
+	if count, err := tp.getPartitionCount("other"); err != nil || count != 6 {
+		t.Errorf("other topic expected [6] but was [%d] error [%v]", count, err)
+	}
+	if count, err := tp.getPartitionCount("orders"); err != nil || count != 3 {
+		t.Errorf("stale count expected during the query but was [%d] error [%v]", count, err)
+	}
+	close(release)
+	wait.Wait()
+	if count, _ := tp.getPartitionCount("orders"); count != 6 {
+		t.Errorf("refreshed count expected [6] but was [%d]", count)
+	}
+}
+
+//newMockClusterProducer returns a producer connected to an in process mock cluster of librdkafka
+func newMockClusterProducer(t *testing.T, config kafka.ConfigMap) *TopicProducer {
+	cluster, err := kafka.NewMockCluster(1)
+	if err != nil {
+		t.Fatalf("cannot create mock cluster error [%v]", err)
+	}
+	t.Cleanup(cluster.Close)
+
+	config["bootstrap.servers"] = cluster.BootstrapServers()
+	tp := &TopicProducer{ClientID: "mock", partitionCounts: map[string]partitionCount{}, events: newEventLogger("mock")}
+	tp.Producer, err = kafka.NewProducer(&config)
+	if err != nil {
+		t.Fatalf("cannot create producer error [%v]", err)
+	}
+	go tp.serveEvents()
+	t.Cleanup(tp.Close)
+	return tp
+}
+
+func TestSendConcurrentWithClose(t *testing.T) {
+	tp := newMockClusterProducer(t, kafka.ConfigMap{})
+	var wait sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for j := 0; j < 200; j++ {
+				tp.Send("orders", 0, []byte("k"), []byte("v"))
+			}
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	tp.Close()
+	wait.Wait()
+
+	err := tp.Send("orders", 0, []byte("k"), []byte("v"))
+	if err == nil {
+		t.Errorf("send after close expected error")
+	}
+	//messages enqueued before the close stay undelivered, flush must not use the closed handle
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tp.FlushContext(ctx)
+	if ctx.Err() != nil {
+		t.Errorf("flush after close expected to return immediately")
+	}
+}
+
+func TestSetConfigWhileSending(t *testing.T) {
+	queue := &fullQueue{}
+	tp := &TopicProducer{
+		partitionCounts: map[string]partitionCount{},
+		partitionLookup: func(topic string) (int32, error) { return 6, nil },
+		queue:           queue,
+	}
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for i := 0; i < 100; i++ {
+			tp.Send("orders", PartitionAny, []byte("k"), []byte("v"))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		tp.SetPartitioner(NewMurmur2Partitioner())
+		tp.SetQueueFullConfig(QueueFullConfig{Policy: QueueFullBlock})
+	}
+	wait.Wait()
+	if queue.produced != 100 {
+		t.Errorf("expected [100] messages produced but was [%d]", queue.produced)
+	}
+}
+
+//deliveringQueue reports the delivery of the messages like librdkafka, messages with a failing key are reported with the error
+//async delivers right after produce, hold keeps the messages queued
+type deliveringQueue struct {
+	mutex    sync.Mutex
+	tp       *TopicProducer
+	failures map[string]error
+	async    bool
+	hold     bool
+	pending  []*kafka.Message
+	offset   int64
+}
+
+func (q *deliveringQueue) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.async && !q.hold {
+		go q.tp.handleDeliveryReport(q.report(msg))
+		return nil
+	}
+	q.pending = append(q.pending, msg)
+	return nil
+}
+
+func (q *deliveringQueue) Flush(timeoutMs int) int {
+	q.mutex.Lock()
+	if q.hold {
+		queued := len(q.pending)
+		q.mutex.Unlock()
+		time.Sleep(time.Duration(timeoutMs) * time.Millisecond)
+		return queued
+	}
+	var reports []*kafka.Message
+	for _, m := range q.pending {
+		reports = append(reports, q.report(m))
+	}
+	q.pending = nil
+	q.mutex.Unlock()
+	for _, m := range reports {
+		q.tp.handleDeliveryReport(m)
+	}
+	return 0
+}
+
+//report sets offset and error of the message, the mutex must be held
+func (q *deliveringQueue) report(m *kafka.Message) *kafka.Message {
+	m.TopicPartition.Offset = kafka.Offset(q.offset)
+	q.offset++
+	m.TopicPartition.Error = q.failures[string(m.Key)]
+	return m
+}
+
+func newDeliveringProducer(q *deliveringQueue) *TopicProducer {
+	tp := &TopicProducer{ClientID: "delivering", partitionCounts: map[string]partitionCount{}, queue: q, events: newEventLogger("delivering")}
+	q.tp = tp
+	return tp
+}
+
+var errDeliveryFailed = kafka.NewError(kafka.ErrMsgTimedOut, "Local: Message timed out", false)
+
+func TestDeliveryAccounting(t *testing.T) {
+	tp := newDeliveringProducer(&deliveringQueue{failures: map[string]error{"bad": errDeliveryFailed}})
+	for _, key := range []string{"good", "bad", "good"} {
+		if err := tp.Send("orders", 0, []byte(key), []byte("v")); err != nil {
+			t.Fatalf("cannot send error [%v]", err)
+		}
+	}
+	//only the broker reports count as success or failure
+	if tp.MessageCount != 3 || tp.GetInFlightCount() != 3 || tp.SuccessCount != 0 || tp.FailedCount != 0 {
+		t.Errorf("expected [3] messages in flight before the reports but was in flight [%d] success [%d] failed [%d]", tp.GetInFlightCount(), tp.SuccessCount, tp.FailedCount)
+	}
+
+	result := tp.Flush(time.Second)
+	if result.Undelivered != 0 || len(result.DeliveryErrors) != 1 || tp.SuccessCount != 2 || tp.FailedCount != 1 || tp.MessageCount != 0 {
+		t.Errorf("expected [2] delivered and [1] failed but was %+v success [%d] failed [%d] in flight [%d]", result, tp.SuccessCount, tp.FailedCount, tp.MessageCount)
+	}
+	if len(result.DeliveryErrors) == 1 && !strings.Contains(result.DeliveryErrors[0].Error(), "timed out") {
+		t.Errorf("delivery error expected with the broker error but was [%v]", result.DeliveryErrors[0])
+	}
+
+	//errors are reported once
+	result = tp.Flush(time.Second)
+	if result.Undelivered != 0 || len(result.DeliveryErrors) != 0 {
+		t.Errorf("second flush expected without errors but was %+v", result)
+	}
+}
+
+func TestDeliveryErrorsLimited(t *testing.T) {
+	tp := &TopicProducer{}
+	for i := 0; i <= maxDeliveryErrors; i++ {
+		tp.addDeliveryError(fmt.Errorf("failed [%d]", i))
+	}
+	if errs := tp.takeDeliveryErrors(); len(errs) != maxDeliveryErrors {
+		t.Errorf("expected [%d] kept delivery errors but was [%d]", maxDeliveryErrors, len(errs))
+	}
+	if errs := tp.takeDeliveryErrors(); len(errs) != 0 {
+		t.Errorf("expected delivery errors reset but was [%d]", len(errs))
+	}
+}
+
+func TestFlushContext(t *testing.T) {
+	tp := newDeliveringProducer(&deliveringQueue{hold: true})
+	started := time.Now()
+	if result := tp.FlushContext(context.Background()); result.Undelivered != 0 || time.Since(started) > flushPollInterval {
+		t.Errorf("flush without messages expected to return immediately but was %+v after [%v]", result, time.Since(started))
+	}
+
+	tp.Send("orders", 0, []byte("k"), []byte("v"))
+	tp.Send("orders", 0, []byte("k"), []byte("v"))
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	started = time.Now()
+	result := tp.FlushContext(ctx)
+	elapsed := time.Since(started)
+	if result.Undelivered != 2 || elapsed < 100*time.Millisecond || elapsed > 150*time.Millisecond+flushPollInterval {
+		t.Errorf("flush expected to end with the deadline and [2] undelivered but was %+v after [%v]", result, elapsed)
+	}
+
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	started = time.Now()
+	if result := tp.FlushContext(canceled); result.Undelivered != 2 || time.Since(started) > flushPollInterval {
+		t.Errorf("flush with canceled context expected to return immediately but was %+v after [%v]", result, time.Since(started))
+	}
+}
+
+func TestSendAsync(t *testing.T) {
+	tp := newDeliveringProducer(&deliveringQueue{async: true, failures: map[string]error{"bad": errDeliveryFailed}})
+	results := make(chan DeliveryResult, 2)
+	callback := func(result DeliveryResult) { results <- result }
+	tp.SendAsync("orders", 3, []byte("good"), []byte("v"), callback)
+	tp.SendAsync("orders", 3, []byte("bad"), []byte("v"), callback)
+
+	received := map[error]DeliveryResult{}
+	for i := 0; i < 2; i++ {
+		select {
+		case result := <-results:
+			received[result.Error] = result
+		case <-time.After(5 * time.Second):
+			t.Fatalf("delivery callback expected")
+		}
+	}
+	if result, ok := received[nil]; !ok || result.Topic != "orders" || result.Partition != 3 || result.Offset < 0 {
+		t.Errorf("delivered message expected with topic, partition and offset but was %+v", result)
+	}
+	if _, ok := received[errDeliveryFailed]; !ok {
+		t.Errorf("failed message expected with the delivery error but was %v", received)
+	}
+}
+
+func TestSendSync(t *testing.T) {
+	tp := newDeliveringProducer(&deliveringQueue{async: true, failures: map[string]error{"bad": errDeliveryFailed}})
+	result, err := tp.SendSync(context.Background(), "orders", 1, []byte("good"), []byte("v"))
+	if err != nil || result.Topic != "orders" || result.Partition != 1 || result.Error != nil {
+		t.Errorf("delivered message expected but was %+v error [%v]", result, err)
+	}
+	result, err = tp.SendSync(context.Background(), "orders", 1, []byte("bad"), []byte("v"))
+	if err != errDeliveryFailed || result.Error != err {
+		t.Errorf("delivery error expected but was %+v error [%v]", result, err)
+	}
+
+	//the context ends the wait for the acknowledgement, the message stays in flight
+	tp = newDeliveringProducer(&deliveringQueue{async: true, hold: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err = tp.SendSync(ctx, "orders", 1, []byte("good"), []byte("v"))
+	if err == nil || !strings.Contains(err.Error(), "not acknowledged") || result.Error != err || tp.GetInFlightCount() != 1 {
+		t.Errorf("unacknowledged message expected error and in flight but was %+v error [%v] in flight [%d]", result, err, tp.GetInFlightCount())
+	}
+
+	//a message that cannot be enqueued returns at once
+	tp, _ = newFullQueueProducer(t, -1, QueueFullConfig{Policy: QueueFullFail})
+	result, err = tp.SendSync(context.Background(), "orders", 1, []byte("k"), []byte("v"))
+	if !isQueueFull(err) || result.Error != err || result.Partition != 1 || tp.GetInFlightCount() != 0 {
+		t.Errorf("queue full expected but was %+v error [%v]", result, err)
+	}
+}
@@ -0,0 +1,199 @@
+package confluent
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+//W3C trace context header names
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+//messaging semantic convention attributes
+const (
+	AttributeMessagingSystem      = "messaging.system"
+	AttributeMessagingDestination = "messaging.destination"
+	AttributeMessagingDestKind    = "messaging.destination_kind"
+	AttributeMessagingOperation   = "messaging.operation"
+	AttributeMessagingClientID    = "messaging.kafka.client_id"
+	AttributeMessagingGroup       = "messaging.kafka.consumer_group"
+	AttributeMessagingPartition   = "messaging.kafka.partition"
+	AttributeMessagingOffset      = "messaging.kafka.offset"
+	AttributeMessagingTombstone   = "messaging.kafka.tombstone"
+)
+
+//SpanKind is the role of a span in the message flow
+type SpanKind int
+
+const (
+	//SpanKindProducer is the span of a sent message
+	SpanKindProducer SpanKind = iota
+	//SpanKindConsumer is the span of a processed message
+	SpanKindConsumer
+)
+
+//SpanContext is the W3C trace context of a span
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+}
+
+//IsValid returns true if trace id and span id are set
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != [16]byte{} && c.SpanID != [8]byte{}
+}
+
+//TraceParent formats the span context as traceparent header value
+func (c SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(c.TraceID[:]), hex.EncodeToString(c.SpanID[:]), c.Flags)
+}
+
+//ParseTraceParent parses a traceparent header value
+func ParseTraceParent(traceParent string) (SpanContext, error) {
+	var c SpanContext
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return c, fmt.Errorf("traceparent invalid [%s]", traceParent)
+	}
+	if parts[0] == "ff" || parts[0] == "00" && len(parts) != 4 {
+		return c, fmt.Errorf("traceparent version invalid [%s]", traceParent)
+	}
+	_, err := hex.Decode(c.TraceID[:], []byte(parts[1]))
+	if err == nil {
+		_, err = hex.Decode(c.SpanID[:], []byte(parts[2]))
+	}
+	if err != nil {
+		return c, fmt.Errorf("traceparent invalid [%s] error [%v]", traceParent, err)
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return c, fmt.Errorf("traceparent flags invalid [%s] error [%v]", traceParent, err)
+	}
+	c.Flags = byte(flags)
+	if !c.IsValid() {
+		return c, fmt.Errorf("traceparent without trace or span id [%s]", traceParent)
+	}
+	return c, nil
+}
+
+//Span is a started span of the tracer
+type Span interface {
+	SpanContext() SpanContext
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+//Tracer starts spans, an implementation adapts the tracing library in use
+//producer spans get their parent from the context, consumer spans get the remote parent extracted from the message headers
+type Tracer interface {
+	Start(ctx context.Context, name string, kind SpanKind, remoteParent SpanContext) (context.Context, Span)
+}
+
+//tracer is used by all producers and consumers, nil disables tracing
+var tracer Tracer
+
+//SetTracer sets the tracer used by the producers and consumers
+func SetTracer(tracerImpl Tracer) {
+	tracer = tracerImpl
+}
+
+//startProducerSpan starts the send span and injects its trace context into the message headers
+func startProducerSpan(ctx context.Context, clientID string, m *kafka.Message) Span {
+	if tracer == nil {
+		return nil
+	}
+	topic := topicName(m.TopicPartition.Topic)
+	_, span := tracer.Start(ctx, topic+" send", SpanKindProducer, SpanContext{})
+	span.SetAttribute(AttributeMessagingSystem, "kafka")
+	span.SetAttribute(AttributeMessagingDestination, topic)
+	span.SetAttribute(AttributeMessagingDestKind, "topic")
+	span.SetAttribute(AttributeMessagingClientID, clientID)
+	if m.TopicPartition.Partition != PartitionAny {
+		span.SetAttribute(AttributeMessagingPartition, m.TopicPartition.Partition)
+	}
+	if m.Value == nil {
+		span.SetAttribute(AttributeMessagingTombstone, true)
+	}
+	injectTraceContext(m, span.SpanContext())
+	return span
+}
+
+//endProducerSpan ends the send span with the delivery report
+func endProducerSpan(span Span, m *kafka.Message) {
+	if m.TopicPartition.Error != nil {
+		span.RecordError(m.TopicPartition.Error)
+	} else {
+		span.SetAttribute(AttributeMessagingPartition, m.TopicPartition.Partition)
+		span.SetAttribute(AttributeMessagingOffset, int64(m.TopicPartition.Offset))
+	}
+	span.End()
+}
+
+//startConsumerSpan starts the process span with the trace context of the message as remote parent
+//the context of the message carries the span for the handler
+func startConsumerSpan(mc *MessageContext, clientID string, groupID string) Span {
+	mc.Context = context.Background()
+	if tracer == nil {
+		return nil
+	}
+	ctx, span := tracer.Start(mc.Context, mc.Topic+" process", SpanKindConsumer, mc.TraceContext)
+	span.SetAttribute(AttributeMessagingSystem, "kafka")
+	span.SetAttribute(AttributeMessagingDestination, mc.Topic)
+	span.SetAttribute(AttributeMessagingDestKind, "topic")
+	span.SetAttribute(AttributeMessagingOperation, "process")
+	span.SetAttribute(AttributeMessagingClientID, clientID)
+	span.SetAttribute(AttributeMessagingGroup, groupID)
+	span.SetAttribute(AttributeMessagingPartition, mc.Partition)
+	span.SetAttribute(AttributeMessagingOffset, mc.Offset)
+	if mc.Tombstone {
+		span.SetAttribute(AttributeMessagingTombstone, true)
+	}
+	mc.Context = ctx
+	return span
+}
+
+//injectTraceContext replaces the trace context headers of the message
+func injectTraceContext(m *kafka.Message, c SpanContext) {
+	if !c.IsValid() {
+		return
+	}
+	headers := make([]kafka.Header, 0, len(m.Headers)+2)
+	for _, header := range m.Headers {
+		if header.Key != TraceParentHeader && header.Key != TraceStateHeader {
+			headers = append(headers, header)
+		}
+	}
+	headers = append(headers, kafka.Header{Key: TraceParentHeader, Value: []byte(c.TraceParent())})
+	if c.TraceState != "" {
+		headers = append(headers, kafka.Header{Key: TraceStateHeader, Value: []byte(c.TraceState)})
+	}
+	m.Headers = headers
+}
+
+//extractTraceContext returns the trace context of the message headers, an invalid span context if there is none
+func extractTraceContext(headers []kafka.Header) SpanContext {
+	var c SpanContext
+	var traceState string
+	for _, header := range headers {
+		switch header.Key {
+		case TraceParentHeader:
+			c, _ = ParseTraceParent(string(header.Value))
+		case TraceStateHeader:
+			traceState = string(header.Value)
+		}
+	}
+	if c.IsValid() {
+		c.TraceState = traceState
+	}
+	return c
+}
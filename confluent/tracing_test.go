@@ -0,0 +1,239 @@
+package confluent
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	okfwkafka "github.com/rbock44/okfw-kafka-go/kafka"
+)
+
+//recordedSpan is a span kept in memory by the span recorder
+type recordedSpan struct {
+	Name       string
+	Kind       SpanKind
+	Parent     SpanContext
+	Context    SpanContext
+	Attributes map[string]interface{}
+	Errors     []error
+	Ended      bool
+}
+
+func (s *recordedSpan) SpanContext() SpanContext {
+	return s.Context
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.Attributes[key] = value
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	s.Errors = append(s.Errors, err)
+}
+
+func (s *recordedSpan) End() {
+	s.Ended = true
+}
+
+type spanKey struct{}
+
+//spanRecorder is a tracer that keeps all started spans in memory
+type spanRecorder struct {
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string, kind SpanKind, remoteParent SpanContext) (context.Context, Span) {
+	span := &recordedSpan{Name: name, Kind: kind, Parent: remoteParent, Attributes: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.Parent = parent.Context
+	}
+	if span.Parent.IsValid() {
+		span.Context.TraceID = span.Parent.TraceID
+		span.Context.TraceState = span.Parent.TraceState
+		span.Context.Flags = span.Parent.Flags
+	} else {
+		rand.Read(span.Context.TraceID[:])
+		span.Context.Flags = 1
+	}
+	rand.Read(span.Context.SpanID[:])
+
+	r.mutex.Lock()
+	r.spans = append(r.spans, span)
+	r.mutex.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (r *spanRecorder) get() []*recordedSpan {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]*recordedSpan{}, r.spans...)
+}
+
+type contextHandler struct {
+	contexts []*MessageContext
+}
+
+func (h *contextHandler) HandleMessage(context *MessageContext, key []byte, value []byte) {
+	h.contexts = append(h.contexts, context)
+}
+
+func (h *contextHandler) Handle(context *okfwkafka.MessageContext, key []byte, value []byte) {}
+
+func TestTraceParent(t *testing.T) {
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	c, err := ParseTraceParent(traceParent)
+	if err != nil {
+		t.Fatalf("parse failed [%v]", err)
+	}
+	if c.Flags != 1 || c.TraceID[0] != 0x4b || c.SpanID[7] != 0xb7 {
+		t.Errorf("parsed [%#v]", c)
+	}
+	if c.TraceParent() != traceParent {
+		t.Errorf("formatted [%s]", c.TraceParent())
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x",
+	} {
+		_, err := ParseTraceParent(invalid)
+		if err == nil {
+			t.Errorf("invalid traceparent accepted [%s]", invalid)
+		}
+	}
+}
+
+func TestTraceProducerSpan(t *testing.T) {
+	recorder := &spanRecorder{}
+	SetTracer(recorder)
+	defer SetTracer(nil)
+	tp := &TopicProducer{ClientID: "producer-1"}
+
+	ctx, parent := recorder.Start(context.Background(), "request", SpanKindConsumer, SpanContext{})
+	parent.(*recordedSpan).Context.TraceState = "vendor=1"
+	topic := "orders"
+	m := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: PartitionAny},
+		Value:          []byte("value"),
+		Headers: []kafka.Header{
+			{Key: "origin", Value: []byte("test")},
+			{Key: TraceParentHeader, Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")},
+		},
+	}
+	span := startProducerSpan(ctx, tp.ClientID, m)
+
+	spans := recorder.get()
+	if len(spans) != 2 {
+		t.Fatalf("spans [%d]", len(spans))
+	}
+	send := spans[1]
+	if send.Name != "orders send" || send.Kind != SpanKindProducer || send.Parent.SpanID != parent.SpanContext().SpanID {
+		t.Errorf("send span [%#v]", send)
+	}
+	if send.Attributes[AttributeMessagingSystem] != "kafka" || send.Attributes[AttributeMessagingDestination] != "orders" ||
+		send.Attributes[AttributeMessagingClientID] != "producer-1" {
+		t.Errorf("send attributes [%v]", send.Attributes)
+	}
+	if _, ok := send.Attributes[AttributeMessagingPartition]; ok {
+		t.Errorf("partition set before delivery [%v]", send.Attributes)
+	}
+
+	if len(m.Headers) != 3 || m.Headers[0].Key != "origin" {
+		t.Fatalf("headers [%v]", m.Headers)
+	}
+	extracted := extractTraceContext(m.Headers)
+	if extracted != send.Context || extracted.TraceState != "vendor=1" {
+		t.Errorf("extracted [%#v] expected [%#v]", extracted, send.Context)
+	}
+
+	m.Opaque = &deliveryOpaque{span: span}
+	m.TopicPartition.Partition = 2
+	m.TopicPartition.Offset = 42
+	tp.handleDeliveryReport(m)
+	if !send.Ended || send.Attributes[AttributeMessagingPartition] != int32(2) || send.Attributes[AttributeMessagingOffset] != int64(42) {
+		t.Errorf("delivered span [%#v]", send)
+	}
+
+	failed := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Error: fmt.Errorf("message timed out")}}
+	failed.Opaque = &deliveryOpaque{span: startProducerSpan(context.Background(), tp.ClientID, failed)}
+	tp.handleDeliveryReport(failed)
+	spans = recorder.get()
+	if len(spans) != 3 || !spans[2].Ended || len(spans[2].Errors) != 1 || spans[2].Parent.IsValid() {
+		t.Errorf("failed span [%#v]", spans[2])
+	}
+	if spans[2].Attributes[AttributeMessagingTombstone] != true {
+		t.Errorf("tombstone attribute missing [%v]", spans[2].Attributes)
+	}
+}
+
+func TestTraceConsumerSpan(t *testing.T) {
+	recorder := &spanRecorder{}
+	SetTracer(recorder)
+	defer SetTracer(nil)
+	handler := &contextHandler{}
+	kc := &MessageConsumer{ClientID: "consumer-1", GroupID: "group-1", Handler: handler}
+
+	remote, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("parse failed [%v]", err)
+	}
+	topic := "orders"
+	kc.handleMessage(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 3, Offset: 7},
+		Value:          []byte("value"),
+		Headers: []kafka.Header{
+			{Key: TraceParentHeader, Value: []byte(remote.TraceParent())},
+			{Key: TraceStateHeader, Value: []byte("vendor=1")},
+		},
+	})
+
+	spans := recorder.get()
+	if len(spans) != 1 || len(handler.contexts) != 1 {
+		t.Fatalf("spans [%d] contexts [%d]", len(spans), len(handler.contexts))
+	}
+	process := spans[0]
+	mc := handler.contexts[0]
+	remote.TraceState = "vendor=1"
+	if mc.TraceContext != remote {
+		t.Errorf("message trace context [%#v]", mc.TraceContext)
+	}
+	if process.Name != "orders process" || process.Kind != SpanKindConsumer || !process.Ended || process.Parent != remote {
+		t.Errorf("process span [%#v]", process)
+	}
+	if process.Context.TraceID != remote.TraceID {
+		t.Errorf("process span not in remote trace [%#v]", process.Context)
+	}
+	if mc.Context.Value(spanKey{}) != process {
+		t.Errorf("handler context without process span")
+	}
+	expected := map[string]interface{}{
+		AttributeMessagingSystem:      "kafka",
+		AttributeMessagingDestination: "orders",
+		AttributeMessagingOperation:   "process",
+		AttributeMessagingClientID:    "consumer-1",
+		AttributeMessagingGroup:       "group-1",
+		AttributeMessagingPartition:   int32(3),
+		AttributeMessagingOffset:      int64(7),
+	}
+	for key, value := range expected {
+		if process.Attributes[key] != value {
+			t.Errorf("attribute [%s] expected [%v] but was [%v]", key, value, process.Attributes[key])
+		}
+	}
+
+	SetTracer(nil)
+	kc.handleMessage(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 3, Offset: 8}})
+	if len(recorder.get()) != 1 || handler.contexts[1].Context == nil || handler.contexts[1].TraceContext.IsValid() {
+		t.Errorf("message without tracer [%#v]", handler.contexts[1])
+	}
+}